@@ -125,7 +125,7 @@ func (r *Result) String() string {
 func (f *fateChart) RollOdds(o Odds, chaos int) *Result {
 	chaos = max(min(chaos, MaxChaos), MinChaos)
 
-	odds := FateChart[o][MaxChaos-chaos]
+	odds := ChartValue(o, chaos)
 	roll := rand.Intn(100) + 1
 
 	r := evaluate(odds, roll)
@@ -140,6 +140,32 @@ func (f *fateChart) RollOdds(o Odds, chaos int) *Result {
 	return r
 }
 
+// Answer returns the answer, such as "Exceptional Yes", for a d100 roll
+// against a FateChart value.
+func Answer(odds, roll int) string {
+	return evaluate(odds, roll).Text
+}
+
+// ChartValue returns the FateChart value for the odds at a chaos factor,
+// clamped like RollOdds does.
+func ChartValue(o Odds, chaos int) int {
+	chaos = max(min(chaos, MaxChaos), MinChaos)
+	return FateChart[o][MaxChaos-chaos]
+}
+
+// EventChance returns the chance, in percent, that a Fate Chart roll at a
+// chaos factor raises a random event.
+func EventChance(chaos int) int {
+	chaos = max(min(chaos, MaxChaos), MinChaos)
+	n := 0
+	for roll := 11; roll <= 100; roll += 11 {
+		if roll/11 <= chaos {
+			n++
+		}
+	}
+	return n
+}
+
 func evaluate(odds, roll int) *Result {
 	var r = new(Result)
 
@@ -39,3 +39,20 @@ func TestEvaluate(t *testing.T) {
 		t.Errorf("Expected Yes, got %s", res.Text)
 	}
 }
+
+func TestChartValueAndEventChance(t *testing.T) {
+	if v := ChartValue(FiftyFifty, 4); v != 50 {
+		t.Errorf("ChartValue(FiftyFifty, 4) = %d, want 50", v)
+	}
+	if v := ChartValue(Certain, 12); v != 125 {
+		t.Errorf("ChartValue(Certain, 12) = %d, want 125", v)
+	}
+	if a := Answer(50, 10); a != "Exceptional Yes" {
+		t.Errorf("Answer(50, 10) = %q", a)
+	}
+	for chaos, want := range map[int]int{0: 0, 1: 1, 5: 5, 8: 8, 9: 8} {
+		if got := EventChance(chaos); got != want {
+			t.Errorf("EventChance(%d) = %d, want %d", chaos, got, want)
+		}
+	}
+}
@@ -0,0 +1,1159 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util/analytics"
+	"github.com/DMXMax/mge/util/journal"
+	"github.com/DMXMax/mge/util/plot"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// defaultDBPath is the database used by commands when -db is not given.
+const defaultDBPath = "mge.db"
+
+// command is a CLI subcommand. run receives the arguments after the command
+// name and returns the process exit code.
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"migrate":  {migrateUsage, runMigrate},
+	"export":   {exportUsage, runExport},
+	"import":   {importUsage, runImport},
+	"journal":  {journalUsage, runJournal},
+	"history":  {historyUsage, runHistory},
+	"undo":     {undoUsage, runUndo},
+	"redo":     {redoUsage, runRedo},
+	"search":   {searchUsage, runSearch},
+	"fork":     {forkUsage, runFork},
+	"forks":    {forksUsage, runForks},
+	"promote":  {promoteUsage, runPromote},
+	"delete":   {deleteUsage, runDelete},
+	"trash":    {trashUsage, runTrash},
+	"restore":  {restoreUsage, runRestore},
+	"purge":    {purgeUsage, runPurge},
+	"stats":    {statsUsage, runStats},
+	"players":  {playersUsage, runPlayers},
+	"triggers": {triggersUsage, runTriggers},
+	"dataset":  {datasetUsage, runDataset},
+	"backup":   {backupUsage, runBackup},
+}
+
+const (
+	exportUsage   = "export -game name [-o file] [-db path]"
+	importUsage   = "import [-name name] [-db path] file"
+	historyUsage  = "history -game name [-db path]"
+	undoUsage     = "undo -game name [-db path]"
+	redoUsage     = "redo -game name [-db path]"
+	searchUsage   = "search -game name [-kind log,thread,character,scene] [-type kind,...] [-scene N] [-from date] [-to date] [-n 20] [-db path] words..."
+	forkUsage     = "fork -game name (-scene N | -entry id) [-name name] [-db path]"
+	forksUsage    = "forks -game name [-db path]"
+	promoteUsage  = "promote -game name [-db path]"
+	deleteUsage   = "delete -game name [-db path]"
+	trashUsage    = "trash [-db path]"
+	restoreUsage  = "restore [-name name] [-db path] id"
+	purgeUsage    = "purge [-days 30] [-db path]"
+	statsUsage    = "stats -game name [-format text|md|json] [-top 10] [-o file] [-db path]"
+	playersUsage  = "players -game name [-add name] [-pc character -player name] [-db path]"
+	datasetUsage  = "dataset -game name [-set name] [-dir path] [-db path]"
+	triggersUsage = "triggers -game name [-add name -if condition -outcome text [-on scene|event] [-threshold N] [-value text] [-thread name] [-augment] [-repeat] [-disarmed]] [-arm name | -disarm name] [-db path]"
+	journalUsage  = "journal -game name [-format md|html] [-scenes N-M] [-from date] [-to date] [-o file] [-db path]"
+)
+
+const (
+	migrateUsage = "migrate status|up [-db path]"
+	backupUsage  = "backup create [-o file] | list | prune [-keep 20] [-days 0] | restore file [-db path]"
+)
+
+// runCommand runs the subcommand named by args[0], if there is one, and
+// reports whether it did.
+func runCommand(args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	return cmd.run(args[1:]), true
+}
+
+// dbFlagSet returns a flag set for a subcommand with the common -db flag.
+func dbFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return fs, fs.String("db", defaultDBPath, "database path or DSN, such as sqlite-pure:mge.db")
+}
+
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", migrateUsage)
+		return 2
+	}
+	fs, dbPath := dbFlagSet("migrate " + args[0])
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	switch args[0] {
+	case "status":
+		db, err := storage.OpenDatabase(*dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+			return 1
+		}
+		defer storage.CloseDatabase(db)
+		status, err := storage.GetMigrationStatus(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migration status: %v\n", err)
+			return 1
+		}
+		printMigrationStatus(os.Stdout, status)
+	case "up":
+		db, err := storage.InitDatabase(*dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate %s: %v\n", *dbPath, err)
+			return 1
+		}
+		defer storage.CloseDatabase(db)
+		version, err := storage.SchemaVersion(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "schema version: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s is at schema version %d\n", *dbPath, version)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\nusage: %s\n", args[0], migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+func runBackup(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", backupUsage)
+		return 2
+	}
+	fs, dbPath := dbFlagSet("backup " + args[0])
+	out := fs.String("o", "", "backup file, defaults to a snapshot in the backups directory next to the database")
+	keep := fs.Int("keep", storage.DefaultSnapshotRetention.Keep, "how many of the newest backups to keep")
+	days := fs.Int("days", 0, "also keep backups newer than this many days")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if backend, _ := storage.ParseDSN(*dbPath); backend == storage.BackendJSON || backend == storage.BackendYAML {
+		fmt.Fprintf(os.Stderr, "backup: %s is not a SQLite database\n", *dbPath)
+		return 1
+	}
+	_, file := storage.ParseDSN(*dbPath)
+
+	switch args[0] {
+	case "create":
+		db, err := storage.OpenDatabase(*dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+			return 1
+		}
+		defer storage.CloseDatabase(db)
+		path := *out
+		if path == "" {
+			var b *storage.Backup
+			if b, err = storage.Snapshot(db, storage.ManualBackup); err == nil {
+				path = b.Path
+			}
+		} else {
+			err = storage.BackupDatabase(db, path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return 1
+		}
+		fmt.Printf("backed up %s to %s\n", *dbPath, path)
+	case "list":
+		backups, err := storage.ListBackups(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup list: %v\n", err)
+			return 1
+		}
+		if len(backups) == 0 {
+			fmt.Printf("no backups in %s\n", storage.BackupDir(file))
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TAKEN\tREASON\tSIZE\tFILE")
+		for _, b := range backups {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", b.Time.Local().Format("2006-01-02 15:04:05"), b.Reason, b.Size, b.Path)
+		}
+		tw.Flush()
+	case "prune":
+		if *keep < 0 || *days < 0 {
+			fmt.Fprintf(os.Stderr, "usage: %s\n", backupUsage)
+			return 2
+		}
+		removed, err := storage.PruneBackups(file, storage.Retention{Keep: *keep, MaxAge: time.Duration(*days) * 24 * time.Hour})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup prune: %v\n", err)
+			return 1
+		}
+		fmt.Printf("removed %d backups\n", len(removed))
+	case "restore":
+		if fs.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "usage: %s\n", backupUsage)
+			return 2
+		}
+		snapshot, err := storage.RestoreBackup(*dbPath, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup restore: %v\n", err)
+			return 1
+		}
+		fmt.Printf("restored %s from %s\n", *dbPath, fs.Arg(0))
+		if snapshot != nil {
+			fmt.Printf("the replaced database was saved to %s\n", snapshot.Path)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown backup command %q\nusage: %s\n", args[0], backupUsage)
+		return 2
+	}
+	return 0
+}
+
+func printMigrationStatus(w io.Writer, status []storage.MigrationStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if s.Version > storage.LatestSchemaVersion() {
+			applied += " (unknown to this program)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	tw.Flush()
+}
+
+func runExport(args []string) int {
+	fs, dbPath := dbFlagSet("export")
+	name := fs.String("game", "", "name of the game to export")
+	out := fs.String("o", "", "archive file, defaults to the game name with .json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", exportUsage)
+		return 2
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	a, err := storage.ExportGame(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export %q: %v\n", g.Name, err)
+		return 1
+	}
+
+	path := *out
+	if path == "" {
+		path = storage.SanitizeFilename(g.Name) + ".json"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	if err := storage.WriteArchive(f, a); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	fmt.Printf("exported %q to %s\n", g.Name, path)
+	return 0
+}
+
+func runImport(args []string) int {
+	fs, dbPath := dbFlagSet("import")
+	name := fs.String("name", "", "import the game under this name")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", importUsage)
+		return 2
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	a, err := storage.ReadArchive(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import %s: %v\n", filepath.Base(fs.Arg(0)), err)
+		return 1
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := storage.ImportGame(db, a, storage.ImportOptions{Name: *name})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import %s: %v\n", filepath.Base(fs.Arg(0)), err)
+		return 1
+	}
+	fmt.Printf("imported %q\n", g.Name)
+	return 0
+}
+
+func runJournal(args []string) int {
+	fs, dbPath := dbFlagSet("journal")
+	name := fs.String("game", "", "name of the game")
+	format := fs.String("format", "md", "output format: md or html")
+	scenes := fs.String("scenes", "", "scene range, e.g. 3, 2-5, 4- or -6")
+	from := fs.String("from", "", "only entries logged on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only entries logged on or before this date (YYYY-MM-DD)")
+	out := fs.String("o", "", "output file, defaults to the game name with \"journal\"")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || (*format != "md" && *format != "html") {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", journalUsage)
+		return 2
+	}
+
+	var opts journal.Options
+	var err error
+	if opts.FirstScene, opts.LastScene, err = parseSceneRange(*scenes); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -scenes value: %v\n", err)
+		return 2
+	}
+	if opts.From, err = parseDate(*from, false); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from value: %v\n", err)
+		return 2
+	}
+	if opts.To, err = parseDate(*to, true); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -to value: %v\n", err)
+		return 2
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	j, err := journal.Build(db, g.ID, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "journal %q: %v\n", g.Name, err)
+		return 1
+	}
+
+	path := *out
+	if path == "" {
+		path = j.Filename("." + *format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "journal: %v\n", err)
+		return 1
+	}
+	render := j.Markdown
+	if *format == "html" {
+		render = j.HTML
+	}
+	if err := render(f); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "journal: %v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "journal: %v\n", err)
+		return 1
+	}
+	fmt.Printf("wrote the journal of %q to %s\n", g.Name, path)
+	return 0
+}
+
+// findGame looks up a game by name.
+func findGame(db *gorm.DB, name string) (*storage.Game, error) {
+	var g storage.Game
+	if err := db.Where("name = ?", storage.SanitizeGameName(name)).First(&g).Error; err != nil {
+		return nil, fmt.Errorf("game %q: %w", name, err)
+	}
+	return &g, nil
+}
+
+// parseSceneRange parses "N", "N-M", "N-" or "-M". Missing ends are 0.
+func parseSceneRange(s string) (first, last int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+	if lo != "" {
+		if first, err = strconv.Atoi(lo); err != nil || first < 1 {
+			return 0, 0, fmt.Errorf("bad scene number %q", lo)
+		}
+	}
+	if hi != "" {
+		if last, err = strconv.Atoi(hi); err != nil || last < 1 {
+			return 0, 0, fmt.Errorf("bad scene number %q", hi)
+		}
+	}
+	if last > 0 && first > last {
+		return 0, 0, fmt.Errorf("scene range %q ends before it starts", s)
+	}
+	return first, last, nil
+}
+
+// parseDate parses a local YYYY-MM-DD date. With endOfDay, the result is the
+// last moment of that day.
+func parseDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// openGame parses the flags of a command that works on one game, given by
+// -game, and opens the database and the game. The caller closes the
+// database with storage.CloseDatabase.
+func openGame(name, usage string, args []string) (*gorm.DB, *storage.Game, int) {
+	fs, dbPath := dbFlagSet(name)
+	game := fs.String("game", "", "name of the game")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, 2
+	}
+	if *game == "" || fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", usage)
+		return nil, nil, 2
+	}
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return nil, nil, 1
+	}
+	g, err := findGame(db, *game)
+	if err != nil {
+		storage.CloseDatabase(db)
+		fmt.Fprintln(os.Stderr, err)
+		return nil, nil, 1
+	}
+	return db, g, 0
+}
+
+func runHistory(args []string) int {
+	db, g, code := openGame("history", historyUsage, args)
+	if g == nil {
+		return code
+	}
+	defer storage.CloseDatabase(db)
+	ops, err := storage.History(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		return 1
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tWHEN\tOPERATION\tSTATE")
+	for _, op := range ops {
+		state := "done"
+		if op.UndoneAt != nil {
+			state = "undone"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", op.Seq, op.CreatedAt.Local().Format("2006-01-02 15:04:05"), op.Description, state)
+	}
+	tw.Flush()
+	return 0
+}
+
+func runUndo(args []string) int {
+	db, g, code := openGame("undo", undoUsage, args)
+	if g == nil {
+		return code
+	}
+	defer storage.CloseDatabase(db)
+	op, err := storage.Undo(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "undo: %v\n", err)
+		return 1
+	}
+	fmt.Printf("undid #%d: %s\n", op.Seq, op.Description)
+	return 0
+}
+
+func runRedo(args []string) int {
+	db, g, code := openGame("redo", redoUsage, args)
+	if g == nil {
+		return code
+	}
+	defer storage.CloseDatabase(db)
+	op, err := storage.Redo(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "redo: %v\n", err)
+		return 1
+	}
+	fmt.Printf("redid #%d: %s\n", op.Seq, op.Description)
+	return 0
+}
+
+func runSearch(args []string) int {
+	fs, dbPath := dbFlagSet("search")
+	name := fs.String("game", "", "name of the game")
+	kinds := fs.String("kind", "", "comma separated kinds: log, thread, character, scene")
+	logType := fs.String("type", "", "comma separated log entry kinds, e.g. fate_question,random_event")
+	scene := fs.Int("scene", 0, "only this scene's log entries and the scene itself")
+	from := fs.String("from", "", "only records created on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only records created on or before this date (YYYY-MM-DD)")
+	limit := fs.Int("n", storage.DefaultSearchLimit, "maximum number of results")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", searchUsage)
+		return 2
+	}
+
+	opts := storage.SearchOptions{Limit: *limit}
+	if *kinds != "" {
+		opts.Kinds = strings.Split(*kinds, ",")
+	}
+	if *logType != "" {
+		for _, name := range strings.Split(*logType, ",") {
+			kind, err := storage.ParseLogKind(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid -type value: %v\n", err)
+				return 2
+			}
+			opts.LogTypes = append(opts.LogTypes, kind)
+		}
+	}
+	var err error
+	if opts.From, err = parseDate(*from, false); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from value: %v\n", err)
+		return 2
+	}
+	if opts.To, err = parseDate(*to, true); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -to value: %v\n", err)
+		return 2
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *scene > 0 {
+		s, err := storage.GetScene(db, g.ID, *scene)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "scene %d: %v\n", *scene, err)
+			return 1
+		}
+		opts.SceneID = &s.ID
+	}
+
+	results, err := storage.Search(db, g.ID, strings.Join(fs.Args(), " "), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "search: %v\n", err)
+		return 1
+	}
+	if len(results) == 0 {
+		fmt.Println("no matches")
+		return 0
+	}
+	for _, r := range results {
+		label := r.Kind
+		if r.Title != "" {
+			label += " " + r.Title
+		}
+		fmt.Printf("%s  %s: %s\n", r.CreatedAt.Local().Format("2006-01-02 15:04"), label, r.Snippet)
+	}
+	return 0
+}
+
+func runFork(args []string) int {
+	fs, dbPath := dbFlagSet("fork")
+	name := fs.String("game", "", "name of the game to fork")
+	scene := fs.Int("scene", 0, "fork at the end of this scene")
+	entry := fs.String("entry", "", "fork right after this log entry")
+	forkName := fs.String("name", "", "name of the fork")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || fs.NArg() > 0 || (*scene == 0) == (*entry == "") {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", forkUsage)
+		return 2
+	}
+	opts := storage.ForkOptions{SceneNumber: *scene, Name: *forkName}
+	if *entry != "" {
+		id, err := uuid.Parse(*entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -entry value: %v\n", err)
+			return 2
+		}
+		opts.LogEntryID = &id
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fork, err := storage.ForkGame(db, g.ID, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fork: %v\n", err)
+		return 1
+	}
+	fmt.Printf("forked %q at %s as %q\n", g.Name, fork.ForkPoint, fork.Name)
+	return 0
+}
+
+func runForks(args []string) int {
+	db, g, code := openGame("forks", forksUsage, args)
+	if g == nil {
+		return code
+	}
+	defer storage.CloseDatabase(db)
+	forks, err := storage.ListForks(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "forks: %v\n", err)
+		return 1
+	}
+	if g.ForkOf != nil {
+		var parent storage.Game
+		if err := db.First(&parent, "id = ?", *g.ForkOf).Error; err == nil {
+			fmt.Printf("%s is a fork of %s at %s\n", g.Name, parent.Name, g.ForkPoint)
+		}
+	}
+	if len(forks) == 0 {
+		fmt.Printf("%s has no forks\n", g.Name)
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tFORKED AT\tCREATED")
+	for _, f := range forks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Name, f.ForkPoint, f.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	tw.Flush()
+	return 0
+}
+
+func runPromote(args []string) int {
+	db, g, code := openGame("promote", promoteUsage, args)
+	if g == nil {
+		return code
+	}
+	defer storage.CloseDatabase(db)
+	if err := storage.PromoteFork(db, g.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "promote: %v\n", err)
+		return 1
+	}
+	var promoted storage.Game
+	if err := db.First(&promoted, "id = ?", g.ID).Error; err != nil {
+		fmt.Fprintf(os.Stderr, "promote: %v\n", err)
+		return 1
+	}
+	fmt.Printf("promoted %q to the main line as %q\n", g.Name, promoted.Name)
+	return 0
+}
+
+func runDelete(args []string) int {
+	db, g, code := openGame("delete", deleteUsage, args)
+	if g == nil {
+		return code
+	}
+	defer storage.CloseDatabase(db)
+	if err := storage.TrashGame(db, g.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "delete: %v\n", err)
+		return 1
+	}
+	fmt.Printf("moved %q to the trash; restore it with: restore %s\n", g.Name, g.ID)
+	return 0
+}
+
+func runTrash(args []string) int {
+	fs, dbPath := dbFlagSet("trash")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", trashUsage)
+		return 2
+	}
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	items, err := storage.ListTrash(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trash: %v\n", err)
+		return 1
+	}
+	if len(items) == 0 {
+		fmt.Println("the trash is empty")
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tGAME\tNAME\tDELETED")
+	for _, item := range items {
+		name := item.Name
+		if item.Kind == storage.TrashGameKind {
+			name = fmt.Sprintf("with %d records", item.Records)
+		} else if len(name) > 40 {
+			name = name[:37] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.ID, item.Kind, item.GameName, name,
+			item.DeletedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	tw.Flush()
+	return 0
+}
+
+func runRestore(args []string) int {
+	fs, dbPath := dbFlagSet("restore")
+	name := fs.String("name", "", "restore a game under this name")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", restoreUsage)
+		return 2
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: bad id %q\n", fs.Arg(0))
+		return 2
+	}
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	item, err := storage.Restore(db, id, storage.RestoreOptions{Name: *name})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+	if item.Kind == storage.TrashGameKind {
+		fmt.Printf("restored game %q with %d records\n", item.Name, item.Records)
+	} else {
+		fmt.Printf("restored %s %q of %q\n", item.Kind, item.Name, item.GameName)
+	}
+	return 0
+}
+
+func runPurge(args []string) int {
+	fs, dbPath := dbFlagSet("purge")
+	days := fs.Int("days", int(storage.DefaultRetention/(24*time.Hour)), "keep what was deleted in the last `N` days; 0 empties the trash")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 || *days < 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", purgeUsage)
+		return 2
+	}
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	res, err := storage.Purge(db, time.Now().AddDate(0, 0, -*days))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "purge: %v\n", err)
+		return 1
+	}
+	fmt.Printf("purged %d games and %d records\n", res.Games, res.Records)
+	return 0
+}
+
+func runStats(args []string) int {
+	fs, dbPath := dbFlagSet("stats")
+	name := fs.String("game", "", "name of the game")
+	format := fs.String("format", "text", "output format: text, md or json")
+	top := fs.Int("top", analytics.DefaultTopWords, "how many of the most used meaning words to list")
+	out := fs.String("o", "", "output file, defaults to standard output")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || fs.NArg() > 0 || *top < 1 || (*format != "text" && *format != "md" && *format != "json") {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", statsUsage)
+		return 2
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	r, err := analytics.Build(db, g.ID, analytics.Options{TopWords: *top})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats %q: %v\n", g.Name, err)
+		return 1
+	}
+
+	render := r.Text
+	switch *format {
+	case "md":
+		render = r.Markdown
+	case "json":
+		render = r.JSON
+	}
+	if *out == "" {
+		if err := render(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+	if err := render(f); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "stats: %v\n", err)
+		return 1
+	}
+	fmt.Printf("wrote the statistics of %q to %s\n", g.Name, *out)
+	return 0
+}
+
+func runPlayers(args []string) int {
+	fs, dbPath := dbFlagSet("players")
+	name := fs.String("game", "", "name of the game")
+	add := fs.String("add", "", "add a player with this name")
+	pc := fs.String("pc", "", "make this character a player character of -player")
+	player := fs.String("player", "", "the player of -pc")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || fs.NArg() > 0 || (*pc == "") != (*player == "") {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", playersUsage)
+		return 2
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *add != "" {
+		p, err := storage.AddPlayer(db, g.ID, *add)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "players: %v\n", err)
+			return 1
+		}
+		fmt.Printf("added player %s to %s\n", p.Name, g.Name)
+	}
+	if *pc != "" {
+		var c storage.Character
+		if err := db.Where("game_id = ? AND name = ?", g.ID, *pc).First(&c).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "players: character %q: %v\n", *pc, err)
+			return 1
+		}
+		var p storage.Player
+		if err := db.Where("game_id = ? AND name = ?", g.ID, *player).First(&p).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "players: player %q: %v\n", *player, err)
+			return 1
+		}
+		if err := storage.AssignPC(db, &c, &p); err != nil {
+			fmt.Fprintf(os.Stderr, "players: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s is now a player character of %s\n", c.Name, p.Name)
+	}
+	if *add != "" || *pc != "" {
+		return 0
+	}
+
+	players, err := storage.ListPlayers(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "players: %v\n", err)
+		return 1
+	}
+	var pcs []storage.Character
+	if err := db.Where("game_id = ? AND is_player = ?", g.ID, true).Order("created_at").Find(&pcs).Error; err != nil {
+		fmt.Fprintf(os.Stderr, "players: %v\n", err)
+		return 1
+	}
+	if len(players) == 0 && len(pcs) == 0 {
+		fmt.Printf("%s has no players or player characters\n", g.Name)
+		return 0
+	}
+	names := map[uuid.UUID]string{}
+	for _, p := range players {
+		names[p.ID] = p.Name
+	}
+	played := map[string]bool{}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLAYER\tCHARACTER\tSTATUS")
+	for _, c := range pcs {
+		who := "-"
+		if c.PlayerID != nil && names[*c.PlayerID] != "" {
+			who = names[*c.PlayerID]
+			played[who] = true
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", who, c.Name, c.Status)
+	}
+	for _, p := range players {
+		if !played[p.Name] {
+			fmt.Fprintf(tw, "%s\t-\t\n", p.Name)
+		}
+	}
+	tw.Flush()
+	return 0
+}
+
+func runTriggers(args []string) int {
+	fs, dbPath := dbFlagSet("triggers")
+	name := fs.String("game", "", "name of the game")
+	add := fs.String("add", "", "add a trigger with this name")
+	cond := fs.String("if", "", "condition of -add: chaos, scene_count, event_focus, thread_status or scenes_elapsed")
+	outcome := fs.String("outcome", "", "what happens when -add fires")
+	on := fs.String("on", storage.TriggerOnScene, "when -add is checked: scene or event")
+	threshold := fs.Int("threshold", 0, "threshold of a chaos, scene_count or scenes_elapsed condition")
+	value := fs.String("value", "", "event focus or thread status of the condition")
+	thread := fs.String("thread", "", "thread of a thread_status or scenes_elapsed condition")
+	augment := fs.Bool("augment", false, "add the outcome to the scene or event instead of replacing it")
+	repeat := fs.Bool("repeat", false, "stay armed after firing")
+	disarmed := fs.Bool("disarmed", false, "add the trigger disarmed")
+	arm := fs.String("arm", "", "arm the trigger with this name")
+	disarm := fs.String("disarm", "", "disarm the trigger with this name")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || fs.NArg() > 0 || (*arm != "" && *disarm != "") || (*add != "") != (*cond != "" || *outcome != "") {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", triggersUsage)
+		return 2
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *add != "" {
+		t := &storage.Trigger{
+			GameID:     g.ID,
+			Name:       *add,
+			Checkpoint: *on,
+			Condition:  *cond,
+			Threshold:  *threshold,
+			Value:      *value,
+			Outcome:    *outcome,
+			Repeatable: *repeat,
+		}
+		if *augment {
+			t.Effect = storage.TriggerAugment
+		}
+		if *thread != "" {
+			var th storage.Thread
+			if err := db.Where("game_id = ? AND name = ?", g.ID, *thread).First(&th).Error; err != nil {
+				fmt.Fprintf(os.Stderr, "triggers: thread %q: %v\n", *thread, err)
+				return 1
+			}
+			t.ThreadID = &th.ID
+		}
+		if err := storage.AddTrigger(db, t, storage.TriggerOptions{Disarmed: *disarmed}); err != nil {
+			fmt.Fprintf(os.Stderr, "triggers: %v\n", err)
+			return 1
+		}
+		fmt.Printf("added trigger %s to %s\n", t.Name, g.Name)
+	}
+	if *arm != "" || *disarm != "" {
+		which := cmp.Or(*arm, *disarm)
+		var t storage.Trigger
+		if err := db.Where("game_id = ? AND name = ?", g.ID, which).First(&t).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "triggers: trigger %q: %v\n", which, err)
+			return 1
+		}
+		if err := storage.SetTriggerActive(db, &t, *arm != ""); err != nil {
+			fmt.Fprintf(os.Stderr, "triggers: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s is now %s\n", t.Name, triggerState(t))
+	}
+	if *add != "" || *arm != "" || *disarm != "" {
+		return 0
+	}
+
+	triggers, err := storage.ListTriggers(db, g.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "triggers: %v\n", err)
+		return 1
+	}
+	if len(triggers) == 0 {
+		fmt.Printf("%s has no triggers\n", g.Name)
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tON\tCONDITION\tEFFECT\tSTATE\tOUTCOME")
+	for _, t := range triggers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, t.Checkpoint, triggerCondition(t), t.Effect, triggerState(t), t.Outcome)
+	}
+	tw.Flush()
+	return 0
+}
+
+// triggerCondition describes a trigger's condition for listing.
+func triggerCondition(t storage.Trigger) string {
+	switch t.Condition {
+	case storage.TriggerChaos, storage.TriggerSceneCount, storage.TriggerScenesElapsed:
+		return fmt.Sprintf("%s >= %d", t.Condition, t.Threshold)
+	case storage.TriggerEventFocus, storage.TriggerThreadStatus:
+		return fmt.Sprintf("%s = %s", t.Condition, t.Value)
+	}
+	return t.Condition
+}
+
+// triggerState describes whether a trigger is armed, and whether it stays
+// armed after firing.
+func triggerState(t storage.Trigger) string {
+	switch {
+	case !t.Active:
+		return "disarmed"
+	case t.Repeatable:
+		return "armed, repeats"
+	}
+	return "armed"
+}
+
+func runDataset(args []string) int {
+	fs, dbPath := dbFlagSet("dataset")
+	name := fs.String("game", "", "name of the game")
+	set := fs.String("set", "", "roll the game's plot points on this dataset")
+	dir := fs.String("dir", "", "directory of plot points dataset files to load")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s\n", datasetUsage)
+		return 2
+	}
+	if *dir != "" {
+		if _, err := plot.LoadDatasetDir(*dir); err != nil {
+			fmt.Fprintf(os.Stderr, "dataset: %v\n", err)
+			return 1
+		}
+	}
+
+	db, err := storage.InitDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *dbPath, err)
+		return 1
+	}
+	defer storage.CloseDatabase(db)
+	g, err := findGame(db, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *set != "" {
+		if err := plot.SetDataset(db, g, *set); err != nil {
+			fmt.Fprintf(os.Stderr, "dataset: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s now uses the %s plot points dataset\n", g.Name, *set)
+		return 0
+	}
+
+	selected := cmp.Or(g.PlotDataset, plot.DefaultDataset)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tNAME\tVERSION\tDESCRIPTION")
+	found := false
+	for _, n := range plot.DatasetNames() {
+		ds, _ := plot.GetDataset(n)
+		mark := ""
+		if n == selected {
+			mark, found = "*", true
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", mark, ds.Name, ds.Version, ds.Description)
+	}
+	if !found {
+		fmt.Fprintf(tw, "*\t%s\t\tnot loaded, see -dir\n", selected)
+	}
+	tw.Flush()
+	return 0
+}
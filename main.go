@@ -21,6 +21,10 @@ import (
 //hint: use the util.Subject map
 
 func main() {
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	// Flags: -o for odds (name/prefix or index 0-8), -c for chaos
 	oddsFlag := flag.String("o", "fifty", "odds name or prefix (e.g., 'unlikely', 'very', 'nearly certain')")
 	chaos := flag.Int("c", 6, "chaos factor (0-8)")
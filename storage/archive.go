@@ -0,0 +1,365 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ArchiveFormat identifies game archives written by ExportGame.
+const ArchiveFormat = "mge-game-archive"
+
+// ArchiveVersion is the version of the archive layout. It changes only when
+// the layout itself changes; model changes are covered by SchemaVersion.
+const ArchiveVersion = 1
+
+// ErrInvalidArchive is returned when reading data that is not a game archive
+// this program can import.
+var ErrInvalidArchive = errors.New("invalid game archive")
+
+// Archive is a self-describing, portable copy of one game with all of its data.
+// Game includes its Log, Threads, Characters, Players, Scenes, Triggers and
+// Plotlines.
+type Archive struct {
+	Format        string         `json:"format"`
+	Version       int            `json:"version"`
+	SchemaVersion int            `json:"schema_version"` // Database schema the game was exported from
+	ExportedAt    time.Time      `json:"exported_at"`
+	Game          Game           `json:"game"`
+	TurningPoints []TurningPoint `json:"turning_points"` // With their PlotPoints
+}
+
+// ImportOptions controls ImportGame.
+type ImportOptions struct {
+	// Name imports the game under a different name. If empty, the archived
+	// name is used, with a number added when that name is taken.
+	Name string
+}
+
+// ExportGame builds an archive of the game and everything that belongs to it.
+// Deleted records are not exported.
+func ExportGame(db *gorm.DB, gameID uuid.UUID) (*Archive, error) {
+	return exportGame(db, gameID, false)
+}
+
+// exportGame builds an archive of the game, including deleted records of the
+// game when withDeleted is set.
+func exportGame(db *gorm.DB, gameID uuid.UUID, withDeleted bool) (*Archive, error) {
+	a := &Archive{Format: ArchiveFormat, Version: ArchiveVersion, ExportedAt: time.Now()}
+	var err error
+	if a.SchemaVersion, err = SchemaVersion(db); err != nil {
+		return nil, err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if withDeleted {
+			return db.Unscoped()
+		}
+		return db
+	}
+	byCreation := func(db *gorm.DB) *gorm.DB { return scope(db).Order("created_at") }
+	err = db.Preload("Log", byCreation).
+		Preload("Threads", byCreation).
+		Preload("Characters", byCreation).
+		Preload("Players", byCreation).
+		Preload("Scenes", func(db *gorm.DB) *gorm.DB { return scope(db).Order("number") }).
+		Preload("Triggers", byCreation).
+		Preload("Plotlines", byCreation).
+		First(&a.Game, "id = ?", gameID).Error
+	if err != nil {
+		return nil, err
+	}
+	if !withDeleted {
+		a.TurningPoints, err = ListTurningPoints(db, gameID)
+		return a, err
+	}
+	err = db.Unscoped().Preload("PlotPoints", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Order("position")
+	}).Where("game_id = ?", gameID).Order("number").Find(&a.TurningPoints).Error
+	return a, err
+}
+
+// WriteArchive writes the archive as indented JSON.
+func WriteArchive(w io.Writer, a *Archive) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// ReadArchive reads an archive written by WriteArchive, checking that its
+// format and version can be imported.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	var a Archive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if a.Format != ArchiveFormat {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidArchive, a.Format)
+	}
+	if a.Version < 1 || a.Version > ArchiveVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, a.Version)
+	}
+	if latest := LatestSchemaVersion(); a.SchemaVersion > latest {
+		return nil, fmt.Errorf("%w: exported from schema version %d, this program supports up to %d",
+			ErrSchemaTooNew, a.SchemaVersion, latest)
+	}
+	return &a, nil
+}
+
+// ImportGame imports an archived game in a single transaction and returns it.
+// The name is validated with ValidateGameName. When the name is already taken
+// or the game's ID is already in use, every record gets a new UUID and all
+// references between them, including those in log payloads, are remapped;
+// otherwise the archived IDs are kept. The imported game is not a fork, as its
+// parent is not in the archive. An explicitly requested name that is taken fails with ErrDuplicateName.
+// The database is snapshotted first, see AutoSnapshot.
+func ImportGame(db *gorm.DB, a *Archive, opts ImportOptions) (*Game, error) {
+	// An archive holds a single game, so a fork's parent is never part of it
+	// and may not exist in this database, or be an unrelated game with the
+	// same ID.
+	g := a.Game
+	g.ForkOf, g.ForkPoint, g.ForkedAt = nil, "", nil
+	return importGame(db, g, a.TurningPoints, opts)
+}
+
+// importGame imports the game as ImportGame does, keeping its fork fields.
+func importGame(db *gorm.DB, g Game, turningPoints []TurningPoint, opts ImportOptions) (*Game, error) {
+	archivedName := g.Name
+	g.Name = SanitizeGameName(opts.Name)
+	if g.Name == "" {
+		g.Name = SanitizeGameName(archivedName)
+	}
+	if err := ValidateGameName(g.Name); err != nil {
+		return nil, err
+	}
+	if err := AutoSnapshot(db, "import"); err != nil {
+		return nil, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		taken, err := gameNameTaken(tx, g.Name)
+		if err != nil {
+			return err
+		}
+		if taken && opts.Name != "" {
+			return ErrDuplicateName
+		}
+		if taken {
+			if g.Name, err = freeGameName(tx, g.Name); err != nil {
+				return err
+			}
+		}
+		var idInUse int64
+		if err := tx.Unscoped().Model(&Game{}).Where("id = ?", g.ID).Count(&idInUse).Error; err != nil {
+			return err
+		}
+
+		ids := idMap{}
+		if taken || idInUse > 0 {
+			ids = idMap{remap: map[uuid.UUID]uuid.UUID{}}
+		}
+		return importRecords(tx, &g, turningPoints, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// importRecords inserts the game and its records with IDs mapped through ids.
+// Hooks are skipped so IDs and plotline statuses are kept as archived.
+func importRecords(tx *gorm.DB, g *Game, turningPoints []TurningPoint, ids idMap) error {
+	tx = tx.Session(&gorm.Session{SkipHooks: true})
+
+	// Copy the records so the archive itself is left unchanged.
+	g.ID = ids.get(g.ID)
+	log, threads, characters := slices.Clone(g.Log), slices.Clone(g.Threads), slices.Clone(g.Characters)
+	scenes, triggers, plotlines := slices.Clone(g.Scenes), slices.Clone(g.Triggers), slices.Clone(g.Plotlines)
+	players := slices.Clone(g.Players)
+	turningPoints = slices.Clone(turningPoints)
+	for i := range scenes {
+		scenes[i].ID, scenes[i].GameID = ids.get(scenes[i].ID), g.ID
+	}
+	for i := range threads {
+		threads[i].ID, threads[i].GameID = ids.get(threads[i].ID), g.ID
+	}
+	for i := range players {
+		players[i].ID, players[i].GameID = ids.get(players[i].ID), g.ID
+	}
+	for i := range characters {
+		characters[i].ID, characters[i].GameID = ids.get(characters[i].ID), g.ID
+		characters[i].PlayerID = ids.getPtr(characters[i].PlayerID)
+	}
+	for i := range plotlines {
+		plotlines[i].ID, plotlines[i].GameID = ids.get(plotlines[i].ID), g.ID
+	}
+	for i := range triggers {
+		triggers[i].ID, triggers[i].GameID = ids.get(triggers[i].ID), g.ID
+		triggers[i].ThreadID = ids.getPtr(triggers[i].ThreadID)
+	}
+	for i := range log {
+		log[i].ID, log[i].GameID = ids.get(log[i].ID), g.ID
+		log[i].SceneID = ids.getPtr(log[i].SceneID)
+		if err := ids.payload(&log[i]); err != nil {
+			return err
+		}
+	}
+	var plotPoints []PlotPointEntry
+	for i := range turningPoints {
+		tp := &turningPoints[i]
+		tp.ID, tp.GameID = ids.get(tp.ID), g.ID
+		tp.PlotlineID, tp.SceneID = ids.getPtr(tp.PlotlineID), ids.getPtr(tp.SceneID)
+		for _, p := range tp.PlotPoints {
+			p.ID, p.TurningPointID = ids.get(p.ID), tp.ID
+			plotPoints = append(plotPoints, p)
+		}
+	}
+
+	if err := insertAll(tx, []Game{*g}); err != nil {
+		return translateError(err)
+	}
+	g.Log, g.Threads, g.Characters, g.Scenes, g.Triggers, g.Plotlines = log, threads, characters, scenes, triggers, plotlines
+	g.Players = players
+	for _, insert := range []func() error{
+		func() error { return insertAll(tx, scenes) },
+		func() error { return insertAll(tx, threads) },
+		func() error { return insertAll(tx, players) },
+		func() error { return insertAll(tx, characters) },
+		func() error { return insertAll(tx, plotlines) },
+		func() error { return insertAll(tx, triggers) },
+		func() error { return insertAll(tx, log) },
+		func() error { return insertAll(tx, turningPoints) },
+		func() error { return insertAll(tx, plotPoints) },
+	} {
+		if err := insert(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gameNameTaken reports whether a game that is not in the trash has the name.
+func gameNameTaken(tx *gorm.DB, name string) (bool, error) {
+	var n int64
+	err := tx.Model(&Game{}).Where("name = ?", name).Count(&n).Error
+	return n > 0, err
+}
+
+// freeGameName returns name with the lowest number from 2 up added that is not
+// taken, shortening name to keep within MaxGameNameLength.
+func freeGameName(tx *gorm.DB, name string) (string, error) {
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf(" %d", n)
+		base := name
+		if len(base)+len(suffix) > MaxGameNameLength {
+			base = base[:MaxGameNameLength-len(suffix)]
+		}
+		candidate := SanitizeGameName(base + suffix)
+		taken, err := gameNameTaken(tx, candidate)
+		if err != nil || !taken {
+			return candidate, err
+		}
+	}
+}
+
+// idMap maps archived IDs to the IDs used on import. With a nil remap map,
+// IDs are kept.
+type idMap struct {
+	remap map[uuid.UUID]uuid.UUID
+}
+
+func (m idMap) get(id uuid.UUID) uuid.UUID {
+	if m.remap == nil || id == uuid.Nil {
+		return id
+	}
+	if mapped, ok := m.remap[id]; ok {
+		return mapped
+	}
+	mapped := uuid.New()
+	m.remap[id] = mapped
+	return mapped
+}
+
+func (m idMap) getPtr(id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	mapped := m.get(*id)
+	return &mapped
+}
+
+// payload maps the record IDs in the entry's payload, such as the thread of a
+// list change.
+func (m idMap) payload(l *LogEntry) error {
+	if m.remap == nil {
+		return nil
+	}
+	p, err := l.DecodePayload()
+	if err != nil {
+		return err
+	}
+	switch p := p.(type) {
+	case *ListChangePayload:
+		p.RecordID = m.get(p.RecordID)
+	case *FateQuestionPayload:
+		p.PlayerID = m.getPtr(p.PlayerID)
+	case *RandomEventPayload:
+		p.TargetID = m.getPtr(p.TargetID)
+	default:
+		return nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	l.Payload = b
+	return nil
+}
+
+// insertAll inserts records with every column, then sets back fields that
+// were zero but took their column default on insert, such as an ended
+// scene's IsActive.
+func insertAll[T any](tx *gorm.DB, records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(new(T)); err != nil {
+		return err
+	}
+	ctx := tx.Statement.Context
+	zeros := map[*schema.Field][]any{}
+	for _, f := range stmt.Schema.Fields {
+		if !f.HasDefaultValue || f.DefaultValueInterface == nil || f.PrimaryKey {
+			continue
+		}
+		for i := range records {
+			rv := reflect.ValueOf(&records[i]).Elem()
+			if _, zero := f.ValueOf(ctx, rv); zero {
+				id, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(ctx, rv)
+				zeros[f] = append(zeros[f], id)
+			}
+		}
+	}
+
+	if err := tx.Select("*").Omit(clause.Associations).CreateInBatches(records, 100).Error; err != nil {
+		return err
+	}
+	for f, ids := range zeros {
+		err := tx.Model(new(T)).Where("id IN ?", ids).UpdateColumn(f.DBName, reflect.Zero(f.FieldType).Interface()).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DMXMax/mge/util/theme"
+	"github.com/google/uuid"
+)
+
+func TestExportImportGame(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Voyage", Chaos: 6, StoryThemes: theme.Themes{theme.ThemeAction, theme.ThemeTension, theme.ThemeMystery, theme.ThemeSocial, theme.ThemePersonal}}
+	db.Create(g)
+	ended := time.Now()
+	sc := &Scene{GameID: g.ID, Number: 1, Title: "Docks", EndedAt: &ended}
+	db.Create(sc)
+	db.Model(sc).Update("is_active", false)
+	th := &Thread{GameID: g.ID, Name: "Find the map", Weight: 2}
+	db.Create(th)
+	ana := &Player{GameID: g.ID, Name: "Ana"}
+	db.Create(ana)
+	db.Create(&Character{GameID: g.ID, Name: "Mara", IsPlayer: true, PlayerID: &ana.ID})
+	gone := &Character{GameID: g.ID, Name: "Gone", Status: "inactive"}
+	db.Create(gone)
+	db.Model(gone).Update("weight", 0)
+	db.Create(&Trigger{GameID: g.ID, Name: "Storm", Condition: TriggerThreadStatus, ThreadID: &th.ID, Value: "resolved"})
+	pl := &Plotline{GameID: g.ID, Name: "Mutiny"}
+	db.Create(pl)
+	AddLogEntry(db, &LogEntry{GameID: g.ID, Msg: "Set sail", SceneID: &sc.ID})
+	weighted, _ := NewLogEntry(g.ID, "Find the map weighs more", &ListChangePayload{List: ThreadsList, RecordID: th.ID, Name: th.Name, OldWeight: 1, NewWeight: 2})
+	AddLogEntry(db, weighted)
+	// The game is a fork of a game that is not exported with it.
+	forkedAt := time.Now()
+	db.Model(g).Updates(map[string]any{"fork_of": uuid.New(), "fork_point": "scene 1", "forked_at": forkedAt})
+	SaveTurningPoint(db, &TurningPoint{GameID: g.ID, PlotlineID: &pl.ID, SceneID: &sc.ID, Plotline: "Mutiny", Kind: "development",
+		PlotPoints: []PlotPointEntry{{Name: "CONCLUSION", Accepted: true}}})
+
+	a, err := ExportGame(db, g.ID)
+	if err != nil {
+		t.Fatalf("ExportGame: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, a); err != nil {
+		t.Fatalf("WriteArchive: %v", err)
+	}
+	read, err := ReadArchive(&buf)
+	if err != nil {
+		t.Fatalf("ReadArchive: %v", err)
+	}
+	if read.SchemaVersion != LatestSchemaVersion() || len(read.Game.Log) != 2 || len(read.TurningPoints) != 1 {
+		t.Fatalf("archive = %+v", read)
+	}
+
+	// Importing next to the original renames the copy and gives it new IDs.
+	imported, err := ImportGame(db, read, ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportGame: %v", err)
+	}
+	if imported.Name != "Voyage 2" || imported.ID == g.ID {
+		t.Fatalf("imported game = %s %s", imported.Name, imported.ID)
+	}
+	copied, err := ExportGame(db, imported.ID)
+	if err != nil {
+		t.Fatalf("ExportGame(copy): %v", err)
+	}
+	cg := copied.Game
+	if cg.StoryThemes != g.StoryThemes || cg.Chaos != 6 || len(cg.Scenes) != 1 || len(cg.Threads) != 1 || len(cg.Characters) != 2 {
+		t.Fatalf("copied game = %+v", cg)
+	}
+	if cg.Scenes[0].IsActive || cg.Scenes[0].ID == sc.ID || cg.Scenes[0].EndedAt == nil {
+		t.Fatalf("copied scene = %+v", cg.Scenes[0])
+	}
+	if *cg.Log[0].SceneID != cg.Scenes[0].ID || *cg.Triggers[0].ThreadID != cg.Threads[0].ID {
+		t.Fatalf("references not remapped: log %v, trigger %v", cg.Log[0].SceneID, cg.Triggers[0].ThreadID)
+	}
+	if p, err := cg.Log[1].DecodePayload(); err != nil || p.(*ListChangePayload).RecordID != cg.Threads[0].ID {
+		t.Fatalf("list change payload not remapped: %+v, %v", p, err)
+	}
+	if cg.ForkOf != nil || cg.ForkPoint != "" || cg.ForkedAt != nil {
+		t.Fatalf("imported game kept its fork parent: %v %q %v", cg.ForkOf, cg.ForkPoint, cg.ForkedAt)
+	}
+	if len(cg.Players) != 1 || cg.Players[0].ID == ana.ID || *cg.Characters[0].PlayerID != cg.Players[0].ID {
+		t.Fatalf("players not remapped: %+v, PC played by %v", cg.Players, cg.Characters[0].PlayerID)
+	}
+	if cg.Plotlines[0].Status != "concluded" || !cg.Characters[0].IsPlayer || cg.Characters[1].Weight != 0 {
+		t.Fatalf("values not kept: %+v %+v", cg.Plotlines[0], cg.Characters[0])
+	}
+	tp := copied.TurningPoints[0]
+	if *tp.PlotlineID != cg.Plotlines[0].ID || len(tp.PlotPoints) != 1 || tp.PlotPoints[0].TurningPointID != tp.ID {
+		t.Fatalf("copied turning point = %+v", tp)
+	}
+
+	if _, err := ImportGame(db, read, ImportOptions{Name: "Voyage"}); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("import under a taken name error = %v, want ErrDuplicateName", err)
+	}
+	if _, err := ImportGame(db, read, ImportOptions{Name: "list"}); err == nil {
+		t.Fatalf("import under a reserved name succeeded")
+	}
+
+	// Into an empty database the archived IDs are kept.
+	other, err := InitDatabase(filepath.Join(t.TempDir(), "other.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	moved, err := ImportGame(other, read, ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportGame(other): %v", err)
+	}
+	if moved.ID != g.ID || moved.Name != "Voyage" || moved.Scenes[0].ID != sc.ID || moved.ForkOf != nil {
+		t.Fatalf("moved game = %s %s", moved.Name, moved.ID)
+	}
+}
+
+func TestReadArchiveRejects(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`{"format": "something-else", "version": 1}`,
+		`{"format": "mge-game-archive", "version": 99}`,
+	}
+	for _, in := range tests {
+		if _, err := ReadArchive(strings.NewReader(in)); !errors.Is(err, ErrInvalidArchive) {
+			t.Fatalf("ReadArchive(%q) error = %v, want ErrInvalidArchive", in, err)
+		}
+	}
+	newer := `{"format": "mge-game-archive", "version": 1, "schema_version": 1000}`
+	if _, err := ReadArchive(strings.NewReader(newer)); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("ReadArchive(newer schema) error = %v, want ErrSchemaTooNew", err)
+	}
+}
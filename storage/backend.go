@@ -0,0 +1,103 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Backend names accepted in a DSN, e.g. "sqlite-pure:games/mge.db" or
+// "yaml:campaign". A DSN without a backend name is a path for the default
+// SQLite backend.
+const (
+	BackendSQLite     = "sqlite"      // SQLite through the cgo driver in builds with -tags sqlite_fts5, the pure Go driver otherwise
+	BackendSQLitePure = "sqlite-pure" // SQLite through a pure Go driver
+	BackendJSON       = "json"        // A directory of JSON files, see FileStore
+	BackendYAML       = "yaml"        // A directory of YAML files, see FileStore
+)
+
+// ErrNotSQL is returned when a flat-file DSN is opened as a SQL database. The
+// flat-file backends only support Store, opened with OpenStore; see FileStore
+// for what they do not support.
+var ErrNotSQL = errors.New("not a SQL database; flat-file backends only keep games, lists, players, scenes and the log")
+
+// BusyTimeout is how long a connection waits for another one, possibly in
+// another process, to release the database before failing with "database is
+// locked".
+const BusyTimeout = 5 * time.Second
+
+// withParams adds query parameters to the DSN of a SQLite driver.
+func withParams(path string, params ...string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + strings.Join(params, "&")
+}
+
+// sqlBackends open a GORM dialector for the database at a path. The SQLite
+// backends register themselves depending on the build. They open databases
+// in WAL mode, so that readers do not block the writer, with BusyTimeout, and
+// start transactions with the write lock taken, so that a transaction that
+// reads before it writes waits for other writers instead of failing. A
+// database opened read-only is opened as an immutable file instead, so that
+// nothing is written to it, not even its journal mode or -wal and -shm files.
+var sqlBackends = map[string]func(path string, readOnly bool) gorm.Dialector{}
+
+// Backends returns the names of the backends available in this build.
+func Backends() []string {
+	names := append(slices.Collect(maps.Keys(sqlBackends)), BackendJSON, BackendYAML)
+	slices.Sort(names)
+	return names
+}
+
+// ParseDSN splits a DSN into its backend and the path of the database, file
+// or directory. A DSN that does not start with the name of a backend and a
+// colon is a path for BackendSQLite.
+func ParseDSN(dsn string) (backend, path string) {
+	if name, rest, ok := strings.Cut(dsn, ":"); ok {
+		if _, sql := sqlBackends[name]; sql || name == BackendJSON || name == BackendYAML {
+			return name, rest
+		}
+	}
+	return BackendSQLite, dsn
+}
+
+// openDialector returns the GORM dialector for a DSN of a SQL backend.
+func openDialector(dsn string, readOnly bool) (gorm.Dialector, string, error) {
+	backend, path := ParseDSN(dsn)
+	open, ok := sqlBackends[backend]
+	if !ok {
+		return nil, "", fmt.Errorf("%s backend: %w", backend, ErrNotSQL)
+	}
+	return open(path, readOnly), path, nil
+}
+
+// readOnlyURI returns the SQLite URI that opens the file at path read-only
+// and immutable.
+func readOnlyURI(path string) string {
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro&immutable=1"
+}
+
+// OpenStore opens the Store for a DSN. SQL backends are opened with
+// InitDatabase, applying migrations; the file backends open or create a
+// FileStore directory.
+func OpenStore(dsn string) (Store, error) {
+	backend, path := ParseDSN(dsn)
+	switch backend {
+	case BackendJSON, BackendYAML:
+		return NewFileStore(path, backend)
+	}
+	db, err := InitDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewGormStore(db), nil
+}
@@ -0,0 +1,24 @@
+//go:build cgo && sqlite_fts5
+
+package storage
+
+import (
+	"fmt"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The cgo driver is used only in builds with -tags sqlite_fts5, which build
+// it with the FTS5 module the search index needs.
+func init() {
+	sqlBackends[BackendSQLite] = func(path string, readOnly bool) gorm.Dialector { return sqlite.Open(cgoParams(path, readOnly)) }
+}
+
+// cgoParams adds the connection settings to a path for the cgo driver.
+func cgoParams(path string, readOnly bool) string {
+	if readOnly {
+		return readOnlyURI(path)
+	}
+	return withParams(path, fmt.Sprintf("_busy_timeout=%d", BusyTimeout.Milliseconds()), "_journal_mode=WAL", "_txlock=immediate")
+}
@@ -0,0 +1,12 @@
+//go:build !cgo || !sqlite_fts5
+
+package storage
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	sqlBackends[BackendSQLite] = func(path string, readOnly bool) gorm.Dialector { return sqlite.Open(pureParams(path, readOnly)) }
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	sqlBackends[BackendSQLitePure] = func(path string, readOnly bool) gorm.Dialector { return sqlite.Open(pureParams(path, readOnly)) }
+}
+
+// pureParams adds the connection settings to a path for the pure Go driver.
+func pureParams(path string, readOnly bool) string {
+	if readOnly {
+		return readOnlyURI(path)
+	}
+	return withParams(path, fmt.Sprintf("_pragma=busy_timeout(%d)", BusyTimeout.Milliseconds()), "_pragma=journal_mode(WAL)", "_txlock=immediate")
+}
@@ -0,0 +1,310 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BackupDirName is the directory, next to the database file, that snapshots
+// of the database are written to.
+const BackupDirName = "backups"
+
+// backupTimeFormat stamps backup file names. It sorts in time order and is
+// precise enough for snapshots taken in quick succession not to collide.
+const backupTimeFormat = "20060102T150405.000000Z"
+
+// Retention decides which backups PruneBackups keeps: the Keep newest, and
+// any newer than MaxAge if MaxAge is set.
+type Retention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+// DefaultSnapshotRetention is the retention of automatic snapshots.
+var DefaultSnapshotRetention = Retention{Keep: 20}
+
+// AutoSnapshots turns the automatic snapshots taken before migrations and
+// destructive operations on or off. SnapshotRetention is applied to the
+// database's automatic snapshots after each one.
+var (
+	AutoSnapshots     = true
+	SnapshotRetention = DefaultSnapshotRetention
+)
+
+// ManualBackup is the reason of backups taken on request rather than
+// automatically.
+const ManualBackup = "manual"
+
+// ErrIntegrity is returned when a database fails SQLite's integrity check.
+var ErrIntegrity = errors.New("database integrity check failed")
+
+// Backup is a backup file of a database.
+type Backup struct {
+	Path   string
+	Time   time.Time // When the backup was taken
+	Reason string    // Why, e.g. "purge" or ManualBackup
+	Size   int64
+}
+
+// DatabaseFile returns the path of the file of the main database of db, or
+// an empty path for an in-memory database.
+func DatabaseFile(db *gorm.DB) (string, error) {
+	var rows []struct {
+		Name string
+		File string
+	}
+	if err := db.Raw("PRAGMA database_list").Scan(&rows).Error; err != nil {
+		return "", err
+	}
+	for _, r := range rows {
+		if r.Name == "main" {
+			return r.File, nil
+		}
+	}
+	return "", nil
+}
+
+// BackupDir returns the directory that snapshots of the database file at
+// path are written to.
+func BackupDir(path string) string {
+	return filepath.Join(filepath.Dir(path), BackupDirName)
+}
+
+// BackupDatabase writes a consistent copy of the database to dest with
+// VACUUM INTO, which is safe while the database is in use. Like
+// InitDatabase, it creates the directory of dest if it doesn't exist. It
+// fails if dest exists.
+func BackupDatabase(db *gorm.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup %s: %w", dest, os.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return db.Exec("VACUUM INTO ?", dest).Error
+}
+
+var backupReason = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Snapshot backs the database up into its backup directory, naming the file
+// after the database, the time and the reason. It returns nil for an
+// in-memory database, which has no file to keep a backup next to.
+func Snapshot(db *gorm.DB, reason string) (*Backup, error) {
+	file, err := DatabaseFile(db)
+	if err != nil || file == "" {
+		return nil, err
+	}
+	reason = strings.Trim(backupReason.ReplaceAllString(strings.ToLower(reason), "-"), "-")
+	b := &Backup{Time: time.Now().UTC(), Reason: cmp.Or(reason, ManualBackup)}
+	b.Path = filepath.Join(BackupDir(file), backupPrefix(file)+b.Time.Format(backupTimeFormat)+"."+b.Reason+".db")
+	if err := BackupDatabase(db, b.Path); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(b.Path); err == nil {
+		b.Size = fi.Size()
+	}
+	return b, nil
+}
+
+// AutoSnapshot takes a snapshot of the database before a migration or a
+// destructive operation, then prunes its snapshots to SnapshotRetention;
+// backups taken for ManualBackup are left for PruneBackups. It
+// does nothing when AutoSnapshots is off, for in-memory databases, and
+// within a transaction, where the caller is responsible for the snapshot.
+func AutoSnapshot(db *gorm.DB, reason string) error {
+	if !AutoSnapshots {
+		return nil
+	}
+	if _, inTx := db.Statement.ConnPool.(*sql.Tx); inTx {
+		return nil
+	}
+	b, err := Snapshot(db, reason)
+	if err != nil {
+		return fmt.Errorf("snapshot before %s: %w", reason, err)
+	}
+	if b == nil {
+		return nil
+	}
+	file, err := DatabaseFile(db)
+	if err != nil {
+		return err
+	}
+	backups, err := ListBackups(file)
+	if err != nil {
+		return err
+	}
+	automatic := slices.DeleteFunc(backups, func(b Backup) bool { return b.Reason == ManualBackup })
+	_, err = pruneBackups(automatic, SnapshotRetention)
+	return err
+}
+
+// backupPrefix is the start of the names of the database file's backups.
+func backupPrefix(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + "."
+}
+
+// ListBackups lists the backups of the database file in its backup
+// directory, newest first.
+func ListBackups(file string) ([]Backup, error) {
+	dir := BackupDir(file)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := backupPrefix(file)
+	var backups []Backup
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		stamp, reason, _ := strings.Cut(strings.TrimSuffix(name, ".db"), "Z.")
+		t, err := time.Parse(backupTimeFormat, stamp+"Z")
+		if err != nil {
+			continue // Another database whose name starts the same way
+		}
+		b := Backup{Path: filepath.Join(dir, e.Name()), Time: t, Reason: reason}
+		if fi, err := e.Info(); err == nil {
+			b.Size = fi.Size()
+		}
+		backups = append(backups, b)
+	}
+	slices.SortFunc(backups, func(a, b Backup) int { return b.Time.Compare(a.Time) })
+	return backups, nil
+}
+
+// PruneBackups removes the backups of the database file that r does not keep
+// and returns them.
+func PruneBackups(file string, r Retention) ([]Backup, error) {
+	backups, err := ListBackups(file)
+	if err != nil {
+		return nil, err
+	}
+	return pruneBackups(backups, r)
+}
+
+// pruneBackups removes the backups, newest first, that r does not keep.
+func pruneBackups(backups []Backup, r Retention) ([]Backup, error) {
+	var removed []Backup
+	for i, b := range backups {
+		if i < r.Keep || (r.MaxAge > 0 && time.Since(b.Time) < r.MaxAge) {
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b)
+	}
+	return removed, nil
+}
+
+// VerifyBackup opens the database file at path, which may be a DSN naming
+// the SQLite backend, read-only and checks that it passes SQLite's integrity check and
+// that its schema is not newer than this program.
+func VerifyBackup(path string) error {
+	if _, err := os.Stat(pathOf(path)); err != nil {
+		return err
+	}
+	db, err := openReadOnly(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIntegrity, err)
+	}
+	defer CloseDatabase(db)
+
+	var result []string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("%w: %v", ErrIntegrity, err)
+	}
+	if len(result) != 1 || result[0] != "ok" {
+		return fmt.Errorf("%w: %s", ErrIntegrity, strings.Join(result, "; "))
+	}
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return fmt.Errorf("%w: not a game database", ErrIntegrity)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return fmt.Errorf("%w: backup is at version %d, this program supports up to %d", ErrSchemaTooNew, version, latest)
+	}
+	return nil
+}
+
+// RestoreBackup replaces the database of the DSN with the backup file after
+// verifying the backup with VerifyBackup. The database is snapshotted first,
+// and the snapshot is returned; it is nil if there was no database. No other
+// connection to the database may be open while it is restored.
+func RestoreBackup(dsn, backup string) (*Backup, error) {
+	backend, path := ParseDSN(dsn)
+	backupDSN := backup
+	if backend != BackendSQLite {
+		backupDSN = backend + ":" + backup
+	}
+	if err := VerifyBackup(backupDSN); err != nil {
+		return nil, fmt.Errorf("backup %s: %w", backup, err)
+	}
+
+	var snapshot *Backup
+	if fi, err := os.Stat(path); err == nil && fi.Size() > 0 {
+		db, err := OpenDatabase(dsn)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, err = Snapshot(db, "restore")
+		CloseDatabase(db)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot before restore: %w", err)
+		}
+	}
+
+	// Copy the backup next to the database, then move it into place.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".restore-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name())
+	src, err := openReadOnly(backupDSN)
+	if err != nil {
+		return nil, err
+	}
+	err = BackupDatabase(src, tmp.Name())
+	CloseDatabase(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// pathOf returns the file path of a DSN of a SQLite backend.
+func pathOf(dsn string) string {
+	_, path := ParseDSN(dsn)
+	return path
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupSnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data", "mge.db")
+	db, err := InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Keep"}
+	db.Create(g)
+
+	b, err := Snapshot(db, "Before the storm!")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if b.Reason != "before-the-storm" || filepath.Dir(b.Path) != filepath.Join(dir, "data", BackupDirName) || b.Size == 0 {
+		t.Fatalf("snapshot = %+v", b)
+	}
+	if err := VerifyBackup(b.Path); err != nil {
+		t.Fatalf("VerifyBackup: %v", err)
+	}
+	if err := BackupDatabase(db, b.Path); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("BackupDatabase over an existing file error = %v, want ErrExist", err)
+	}
+
+	// Destructive operations snapshot the database first.
+	db.Create(&Game{Name: "Lose"})
+	if _, err := Purge(db, time.Now()); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	backups, err := ListBackups(path)
+	if err != nil {
+		t.Fatalf("ListBackups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].Reason != "purge" || backups[1].Path != b.Path {
+		t.Fatalf("backups = %+v", backups)
+	}
+	AutoSnapshots = false
+	Purge(db, time.Now())
+	AutoSnapshots = true
+	if backups, _ := ListBackups(path); len(backups) != 2 {
+		t.Fatalf("snapshot taken with AutoSnapshots off: %+v", backups)
+	}
+
+	removed, err := PruneBackups(path, Retention{Keep: 1})
+	if err != nil {
+		t.Fatalf("PruneBackups: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Path != b.Path {
+		t.Fatalf("pruned %+v, want the oldest", removed)
+	}
+	if removed, _ := PruneBackups(path, Retention{MaxAge: time.Hour}); len(removed) != 0 {
+		t.Fatalf("pruned %+v newer than MaxAge", removed)
+	}
+
+	// Automatic rotation leaves manual backups alone.
+	manual, err := Snapshot(db, "")
+	if err != nil || manual.Reason != ManualBackup {
+		t.Fatalf("manual Snapshot = %+v, %v", manual, err)
+	}
+	SnapshotRetention = Retention{Keep: 1}
+	Purge(db, time.Now())
+	SnapshotRetention = DefaultSnapshotRetention
+	if backups, _ := ListBackups(path); len(backups) != 2 || backups[0].Reason != "purge" || backups[1].Path != manual.Path {
+		t.Fatalf("backups after rotation = %+v", backups)
+	}
+
+	// Verifying a backup leaves the file as it is.
+	backups, _ = ListBackups(path)
+	data, _ := os.ReadFile(backups[0].Path)
+	odd := filepath.Join(dir, "odd name #1?.db")
+	os.WriteFile(odd, data, 0644)
+	for _, file := range []string{backups[0].Path, odd} {
+		if err := VerifyBackup(file); err != nil {
+			t.Fatalf("VerifyBackup(%s): %v", file, err)
+		}
+		if after, _ := os.ReadFile(file); !bytes.Equal(after, data) {
+			t.Fatalf("VerifyBackup changed %s", file)
+		}
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if _, err := os.Stat(file + suffix); err == nil {
+				t.Fatalf("VerifyBackup left %s%s", file, suffix)
+			}
+		}
+	}
+
+	// Restoring brings back the backup and snapshots what it replaces.
+	CloseDatabase(db)
+	snapshot, err := RestoreBackup(path, backups[0].Path)
+	if err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if snapshot == nil || snapshot.Reason != "restore" {
+		t.Fatalf("snapshot before restore = %+v", snapshot)
+	}
+	db, err = InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase after restore: %v", err)
+	}
+	defer CloseDatabase(db)
+	var names []string
+	db.Model(&Game{}).Order("name").Pluck("name", &names)
+	if len(names) != 2 || names[0] != "Keep" || names[1] != "Lose" {
+		t.Fatalf("games after restore = %v", names)
+	}
+
+	bad := filepath.Join(dir, "bad.db")
+	os.WriteFile(bad, []byte("not a database"), 0644)
+	if _, err := RestoreBackup(path, bad); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("restoring a damaged backup error = %v, want ErrIntegrity", err)
+	}
+}
@@ -5,29 +5,51 @@ import (
 	"os"
 	"path/filepath"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 // InitDatabase initializes a SQLite database connection at the specified path.
-// It creates the database directory if it doesn't exist and returns a configured
-// GORM database instance with silent logging.
+// The path may be a DSN naming the SQLite backend, see ParseDSN.
+// It creates the database directory if it doesn't exist, applies any pending
+// migrations and returns a configured GORM database instance with silent logging.
+// It fails with ErrSchemaTooNew if the database is newer than this program.
 //
 // Parameters:
-//   - dbPath: The path to the SQLite database file
+//   - dbPath: The path to the SQLite database file, or a DSN such as "sqlite-pure:mge.db"
 //
 // Returns:
 //   - *gorm.DB: The configured database connection
 //   - error: Any error that occurred during initialization
 func InitDatabase(dbPath string) (*gorm.DB, error) {
+	db, err := OpenDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(db); err != nil {
+		CloseDatabase(db)
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// OpenDatabase opens the SQLite database like InitDatabase, but without
+// applying migrations. Use it to inspect a database, e.g. with GetMigrationStatus.
+func OpenDatabase(dbPath string) (*gorm.DB, error) {
+	dialector, path, err := openDialector(dbPath, false)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure the database directory exists
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, err
 	}
 
 	// Open SQLite database connection
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
@@ -37,3 +59,23 @@ func InitDatabase(dbPath string) (*gorm.DB, error) {
 	return db, nil
 }
 
+// openReadOnly opens the SQLite database file of a DSN read-only and
+// immutable, without applying migrations, so that inspecting the file, such
+// as a backup, leaves it unchanged.
+func openReadOnly(dsn string) (*gorm.DB, error) {
+	dialector, _, err := openDialector(dsn, true)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+// CloseDatabase closes the connections of a database opened with
+// InitDatabase or OpenDatabase.
+func CloseDatabase(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
@@ -0,0 +1,374 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"sigs.k8s.io/yaml"
+)
+
+// FileStore is a Store kept in a directory of flat files, one JSON or YAML
+// file per game holding the game with its threads, characters, scenes and
+// log, so that a group can keep a campaign in git. Records are written in
+// creation order and soft-deleted records are kept, as in a database.
+//
+// The files are read when the store is opened. While open, the store works
+// like MemoryStore, and every change is written back to the game's file.
+// Only one process should have a directory open at a time.
+//
+// A FileStore keeps only what Store covers: games, the Threads and
+// Characters Lists, players, scenes and the log. Everything that works on a
+// *gorm.DB needs a SQL backend and is not available on the flat-file
+// backends: the operation history with undo and redo, keyed scenes and events
+// (triggers), plotlines and turning points, full-text search, forks, the
+// trash, backups, migrations, scene.Manager and the plot package. Opening a
+// flat-file DSN for those fails with ErrNotSQL; export a game from a SQLite
+// database and keep the archive in git instead if you need them.
+type FileStore struct {
+	mu     sync.Mutex // Serializes changes and file writes
+	dir    string
+	format string // BackendJSON or BackendYAML
+	mem    *MemoryStore
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore opens the store in dir, creating the directory if needed.
+// format is BackendJSON or BackendYAML; files of the other format are ignored.
+func NewFileStore(dir, format string) (*FileStore, error) {
+	if format != BackendJSON && format != BackendYAML {
+		return nil, fmt.Errorf("unknown file store format %q", format)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, format: format, mem: NewMemoryStore()}
+	files, err := filepath.Glob(filepath.Join(dir, "*."+format))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if err := s.load(file); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return s, nil
+}
+
+// load adds the game in file to the store.
+func (s *FileStore) load(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if s.format == BackendYAML {
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return err
+		}
+	}
+	var g Game
+	if err := json.Unmarshal(b, &g); err != nil {
+		return err
+	}
+	m := s.mem
+	m.threads.rows = append(m.threads.rows, g.Threads...)
+	m.characters.rows = append(m.characters.rows, g.Characters...)
+	m.players.rows = append(m.players.rows, g.Players...)
+	m.scenes.rows = append(m.scenes.rows, g.Scenes...)
+	m.log.rows = append(m.log.rows, g.Log...)
+	m.games.rows = append(m.games.rows, m.games.copy(&g))
+	return nil
+}
+
+// save writes the game's file, replacing it atomically.
+func (s *FileStore) save(gameID uuid.UUID) error {
+	m := s.mem
+	m.mu.RLock()
+	g := m.games.findUnscoped(func(g *Game) bool { return g.ID == gameID })
+	if g == nil {
+		m.mu.RUnlock()
+		return ErrNotFound
+	}
+	game := m.games.copy(g)
+	game.Threads = unscopedRows(&m.threads, func(t *Thread) bool { return t.GameID == gameID })
+	game.Characters = unscopedRows(&m.characters, func(c *Character) bool { return c.GameID == gameID })
+	game.Players = unscopedRows(&m.players, func(p *Player) bool { return p.GameID == gameID })
+	game.Scenes = unscopedRows(&m.scenes, func(sc *Scene) bool { return sc.GameID == gameID })
+	game.Log = unscopedRows(&m.log, func(l *LogEntry) bool { return l.GameID == gameID })
+	m.mu.RUnlock()
+
+	b, err := json.MarshalIndent(game, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.format == BackendYAML {
+		if b, err = yaml.JSONToYAML(b); err != nil {
+			return err
+		}
+	} else {
+		b = append(b, '\n')
+	}
+	file := filepath.Join(s.dir, gameID.String()+"."+s.format)
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// unscopedRows returns copies of the matching rows, including deleted ones,
+// in creation order.
+func unscopedRows[T any](t *memTable[T], match func(*T) bool) []T {
+	var rows []T
+	for i := range t.rows {
+		if match(&t.rows[i]) {
+			rows = append(rows, t.copy(&t.rows[i]))
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b T) int {
+		return t.meta(&a).createdAt.Compare(*t.meta(&b).createdAt)
+	})
+	return rows
+}
+
+// change runs fn, which changes the game's data, and saves the game's file.
+func (s *FileStore) change(fn func() (gameID uuid.UUID, err error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gameID, err := fn()
+	if err != nil {
+		return err
+	}
+	return s.save(gameID)
+}
+
+// gameOf returns the game of the record with the given ID, deleted or not.
+func gameOf[T any](m *MemoryStore, t *memTable[T], id uuid.UUID, game func(*T) uuid.UUID) uuid.UUID {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if rec := t.findUnscoped(func(r *T) bool { return *t.meta(r).id == id }); rec != nil {
+		return game(rec)
+	}
+	return uuid.Nil
+}
+
+// CreateGame implements GameStore.
+func (s *FileStore) CreateGame(ctx context.Context, g *Game) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.CreateGame(ctx, g)
+		return g.ID, err
+	})
+}
+
+// GetGame implements GameStore.
+func (s *FileStore) GetGame(ctx context.Context, id uuid.UUID) (*Game, error) {
+	return s.mem.GetGame(ctx, id)
+}
+
+// GetGameByName implements GameStore.
+func (s *FileStore) GetGameByName(ctx context.Context, name string) (*Game, error) {
+	return s.mem.GetGameByName(ctx, name)
+}
+
+// ListGames implements GameStore.
+func (s *FileStore) ListGames(ctx context.Context) ([]Game, error) {
+	return s.mem.ListGames(ctx)
+}
+
+// UpdateGame implements GameStore.
+func (s *FileStore) UpdateGame(ctx context.Context, g *Game) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.UpdateGame(ctx, g)
+		return g.ID, err
+	})
+}
+
+// DeleteGame implements GameStore.
+func (s *FileStore) DeleteGame(ctx context.Context, id uuid.UUID) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.DeleteGame(ctx, id)
+		return id, err
+	})
+}
+
+// CreateThread implements ThreadStore.
+func (s *FileStore) CreateThread(ctx context.Context, t *Thread) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.CreateThread(ctx, t)
+		return t.GameID, err
+	})
+}
+
+// GetThread implements ThreadStore.
+func (s *FileStore) GetThread(ctx context.Context, id uuid.UUID) (*Thread, error) {
+	return s.mem.GetThread(ctx, id)
+}
+
+// ListThreads implements ThreadStore.
+func (s *FileStore) ListThreads(ctx context.Context, gameID uuid.UUID) ([]Thread, error) {
+	return s.mem.ListThreads(ctx, gameID)
+}
+
+// UpdateThread implements ThreadStore.
+func (s *FileStore) UpdateThread(ctx context.Context, t *Thread) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.UpdateThread(ctx, t)
+		return t.GameID, err
+	})
+}
+
+// DeleteThread implements ThreadStore.
+func (s *FileStore) DeleteThread(ctx context.Context, id uuid.UUID) error {
+	return s.change(func() (uuid.UUID, error) {
+		gameID := gameOf(s.mem, &s.mem.threads, id, func(t *Thread) uuid.UUID { return t.GameID })
+		return gameID, s.mem.DeleteThread(ctx, id)
+	})
+}
+
+// CreateCharacter implements CharacterStore.
+func (s *FileStore) CreateCharacter(ctx context.Context, c *Character) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.CreateCharacter(ctx, c)
+		return c.GameID, err
+	})
+}
+
+// GetCharacter implements CharacterStore.
+func (s *FileStore) GetCharacter(ctx context.Context, id uuid.UUID) (*Character, error) {
+	return s.mem.GetCharacter(ctx, id)
+}
+
+// ListCharacters implements CharacterStore.
+func (s *FileStore) ListCharacters(ctx context.Context, gameID uuid.UUID) ([]Character, error) {
+	return s.mem.ListCharacters(ctx, gameID)
+}
+
+// UpdateCharacter implements CharacterStore.
+func (s *FileStore) UpdateCharacter(ctx context.Context, c *Character) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.UpdateCharacter(ctx, c)
+		return c.GameID, err
+	})
+}
+
+// DeleteCharacter implements CharacterStore.
+func (s *FileStore) DeleteCharacter(ctx context.Context, id uuid.UUID) error {
+	return s.change(func() (uuid.UUID, error) {
+		gameID := gameOf(s.mem, &s.mem.characters, id, func(c *Character) uuid.UUID { return c.GameID })
+		return gameID, s.mem.DeleteCharacter(ctx, id)
+	})
+}
+
+// CreatePlayer implements PlayerStore.
+func (s *FileStore) CreatePlayer(ctx context.Context, p *Player) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.CreatePlayer(ctx, p)
+		return p.GameID, err
+	})
+}
+
+// GetPlayer implements PlayerStore.
+func (s *FileStore) GetPlayer(ctx context.Context, id uuid.UUID) (*Player, error) {
+	return s.mem.GetPlayer(ctx, id)
+}
+
+// ListPlayers implements PlayerStore.
+func (s *FileStore) ListPlayers(ctx context.Context, gameID uuid.UUID) ([]Player, error) {
+	return s.mem.ListPlayers(ctx, gameID)
+}
+
+// UpdatePlayer implements PlayerStore.
+func (s *FileStore) UpdatePlayer(ctx context.Context, p *Player) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.UpdatePlayer(ctx, p)
+		return p.GameID, err
+	})
+}
+
+// DeletePlayer implements PlayerStore.
+func (s *FileStore) DeletePlayer(ctx context.Context, id uuid.UUID) error {
+	return s.change(func() (uuid.UUID, error) {
+		gameID := gameOf(s.mem, &s.mem.players, id, func(p *Player) uuid.UUID { return p.GameID })
+		return gameID, s.mem.DeletePlayer(ctx, id)
+	})
+}
+
+// CreateScene implements SceneStore.
+func (s *FileStore) CreateScene(ctx context.Context, sc *Scene) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.CreateScene(ctx, sc)
+		return sc.GameID, err
+	})
+}
+
+// GetScene implements SceneStore.
+func (s *FileStore) GetScene(ctx context.Context, id uuid.UUID) (*Scene, error) {
+	return s.mem.GetScene(ctx, id)
+}
+
+// ListScenes implements SceneStore.
+func (s *FileStore) ListScenes(ctx context.Context, gameID uuid.UUID) ([]Scene, error) {
+	return s.mem.ListScenes(ctx, gameID)
+}
+
+// ActiveScene implements SceneStore.
+func (s *FileStore) ActiveScene(ctx context.Context, gameID uuid.UUID) (*Scene, error) {
+	return s.mem.ActiveScene(ctx, gameID)
+}
+
+// UpdateScene implements SceneStore.
+func (s *FileStore) UpdateScene(ctx context.Context, sc *Scene) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.UpdateScene(ctx, sc)
+		return sc.GameID, err
+	})
+}
+
+// DeleteScene implements SceneStore.
+func (s *FileStore) DeleteScene(ctx context.Context, id uuid.UUID) error {
+	return s.change(func() (uuid.UUID, error) {
+		gameID := gameOf(s.mem, &s.mem.scenes, id, func(sc *Scene) uuid.UUID { return sc.GameID })
+		return gameID, s.mem.DeleteScene(ctx, id)
+	})
+}
+
+// AddLogEntry implements LogStore.
+func (s *FileStore) AddLogEntry(ctx context.Context, l *LogEntry) error {
+	return s.change(func() (uuid.UUID, error) {
+		err := s.mem.AddLogEntry(ctx, l)
+		return l.GameID, err
+	})
+}
+
+// ListLog implements LogStore.
+func (s *FileStore) ListLog(ctx context.Context, gameID uuid.UUID, n int) ([]LogEntry, error) {
+	return s.mem.ListLog(ctx, gameID, n)
+}
+
+// ListSceneLog implements LogStore.
+func (s *FileStore) ListSceneLog(ctx context.Context, sceneID uuid.UUID) ([]LogEntry, error) {
+	return s.mem.ListSceneLog(ctx, sceneID)
+}
+
+// DeleteLogEntry implements LogStore.
+func (s *FileStore) DeleteLogEntry(ctx context.Context, id uuid.UUID) error {
+	return s.change(func() (uuid.UUID, error) {
+		gameID := gameOf(s.mem, &s.mem.log, id, func(l *LogEntry) uuid.UUID { return l.GameID })
+		return gameID, s.mem.DeleteLogEntry(ctx, id)
+	})
+}
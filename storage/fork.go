@@ -0,0 +1,296 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotAFork is returned when promoting a game that is not a fork.
+var ErrNotAFork = errors.New("game is not a fork")
+
+// ForkOptions selects where to fork a game. Set exactly one of LogEntryID and
+// SceneNumber.
+type ForkOptions struct {
+	LogEntryID  *uuid.UUID // Fork right after this log entry was written
+	SceneNumber int        // Fork at the end of this scene
+	Name        string     // Name of the fork; defaults to the game's name with "fork" added
+}
+
+// ForkGame copies the game as it was at the fork point into a new game whose
+// ForkOf is the original. Log entries, scenes, lists and plot data created
+// after the fork point are left out, and recorded operations after it are
+// rolled back in the copy, so the fork continues independently from there.
+func ForkGame(db *gorm.DB, gameID uuid.UUID, opts ForkOptions) (*Game, error) {
+	if (opts.LogEntryID == nil) == (opts.SceneNumber == 0) {
+		return nil, fmt.Errorf("fork at either a log entry or a scene")
+	}
+
+	var fork *Game
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var point string
+		entryID := opts.LogEntryID
+		if entryID != nil {
+			point = "log entry " + entryID.String()
+		} else {
+			s, err := GetScene(tx, gameID, opts.SceneNumber)
+			if err != nil {
+				return err
+			}
+			var last LogEntry
+			if err := tx.Where("scene_id = ?", s.ID).Order("created_at DESC").First(&last).Error; err != nil {
+				return fmt.Errorf("scene %d has no log entries: %w", s.Number, err)
+			}
+			entryID = &last.ID
+			point = fmt.Sprintf("scene %d", s.Number)
+		}
+
+		cutoff, err := forkCutoff(tx, gameID, *entryID)
+		if err != nil {
+			return err
+		}
+		a, err := exportGame(tx, gameID, true)
+		if err != nil {
+			return err
+		}
+		if err := rollBack(tx, a, cutoff); err != nil {
+			return err
+		}
+		trimArchive(a, cutoff)
+
+		name := opts.Name
+		if name == "" {
+			base := a.Game.Name
+			if len(base) > MaxGameNameLength-len(" fork") {
+				base = base[:MaxGameNameLength-len(" fork")]
+			}
+			a.Game.Name = SanitizeGameName(base + " fork")
+		}
+		a.Game.ForkOf = &gameID
+		a.Game.ForkPoint = point
+		a.Game.ForkedAt = &cutoff
+		fork, err = importGame(tx, a.Game, a.TurningPoints, ImportOptions{Name: name})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
+// forkCutoff returns the time to fork at for a log entry: the end of the
+// operation that wrote it, or the entry's own time if it was not recorded.
+func forkCutoff(tx *gorm.DB, gameID, entryID uuid.UUID) (time.Time, error) {
+	var entry LogEntry
+	if err := tx.First(&entry, "id = ? AND game_id = ?", entryID, gameID).Error; err != nil {
+		return time.Time{}, err
+	}
+	var ops []Operation
+	if err := tx.Where("game_id = ? AND created_at >= ?", gameID, entry.CreatedAt).Order("seq").Find(&ops).Error; err != nil {
+		return time.Time{}, err
+	}
+	for _, op := range ops {
+		if slices.ContainsFunc(op.Changes, func(c Change) bool { return c.Action == ChangeCreate && c.RecordID == entryID }) {
+			return op.CreatedAt, nil
+		}
+	}
+	return entry.CreatedAt, nil
+}
+
+// rollBack reverts, in the archive, the updates made by operations recorded
+// after cutoff that are still in effect.
+func rollBack(tx *gorm.DB, a *Archive, cutoff time.Time) error {
+	var ops []Operation
+	err := tx.Where("game_id = ? AND created_at > ? AND undone_at IS NULL", a.Game.ID, cutoff).Order("seq DESC").Find(&ops).Error
+	if err != nil {
+		return err
+	}
+	records, err := archiveRecords(tx, a)
+	if err != nil {
+		return err
+	}
+	ctx := tx.Statement.Context
+	for _, op := range ops {
+		for i := len(op.Changes) - 1; i >= 0; i-- {
+			c := op.Changes[i]
+			rec, ok := records[c.RecordID]
+			if c.Action != ChangeUpdate || !ok {
+				continue
+			}
+			for column, value := range c.Before {
+				field := rec.schema.LookUpField(column)
+				if field == nil {
+					continue
+				}
+				if err := field.Set(ctx, rec.value, fromJSON(field, value)); err != nil {
+					return fmt.Errorf("roll back %s.%s: %w", c.Table, column, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type archiveRecord struct {
+	schema *schema.Schema
+	value  reflect.Value
+}
+
+// fromJSON converts a column value that went through JSON back to a type
+// the field can be set from.
+func fromJSON(field *schema.Field, value any) any {
+	switch v := value.(type) {
+	case float64:
+		if field.FieldType.Kind() == reflect.Bool {
+			return v != 0
+		}
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case string:
+		if field.FieldType == reflect.TypeOf(time.Time{}) || field.FieldType == reflect.TypeOf(&time.Time{}) {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	}
+	return value
+}
+
+func parseSchema(tx *gorm.DB, model any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: tx}
+	err := stmt.Parse(model)
+	return stmt.Schema, err
+}
+
+// archiveRecords indexes the records of an archive by ID.
+func archiveRecords(tx *gorm.DB, a *Archive) (map[uuid.UUID]archiveRecord, error) {
+	records := map[uuid.UUID]archiveRecord{}
+	add := func(model any, id uuid.UUID) error {
+		s, err := parseSchema(tx, model)
+		if err != nil {
+			return err
+		}
+		records[id] = archiveRecord{schema: s, value: reflect.ValueOf(model).Elem()}
+		return nil
+	}
+	var errs []error
+	errs = append(errs, add(&a.Game, a.Game.ID))
+	for i := range a.Game.Log {
+		errs = append(errs, add(&a.Game.Log[i], a.Game.Log[i].ID))
+	}
+	for i := range a.Game.Threads {
+		errs = append(errs, add(&a.Game.Threads[i], a.Game.Threads[i].ID))
+	}
+	for i := range a.Game.Characters {
+		errs = append(errs, add(&a.Game.Characters[i], a.Game.Characters[i].ID))
+	}
+	for i := range a.Game.Players {
+		errs = append(errs, add(&a.Game.Players[i], a.Game.Players[i].ID))
+	}
+	for i := range a.Game.Scenes {
+		errs = append(errs, add(&a.Game.Scenes[i], a.Game.Scenes[i].ID))
+	}
+	for i := range a.Game.Triggers {
+		errs = append(errs, add(&a.Game.Triggers[i], a.Game.Triggers[i].ID))
+	}
+	for i := range a.Game.Plotlines {
+		errs = append(errs, add(&a.Game.Plotlines[i], a.Game.Plotlines[i].ID))
+	}
+	for i := range a.TurningPoints {
+		tp := &a.TurningPoints[i]
+		errs = append(errs, add(tp, tp.ID))
+		for j := range tp.PlotPoints {
+			errs = append(errs, add(&tp.PlotPoints[j], tp.PlotPoints[j].ID))
+		}
+	}
+	return records, errors.Join(errs...)
+}
+
+// trimArchive leaves out the records created after cutoff and restores the
+// ones deleted after it.
+func trimArchive(a *Archive, cutoff time.Time) {
+	g := &a.Game
+	g.Log = keepUntil(g.Log, cutoff, func(r *LogEntry) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	g.Threads = keepUntil(g.Threads, cutoff, func(r *Thread) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	g.Characters = keepUntil(g.Characters, cutoff, func(r *Character) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	g.Players = keepUntil(g.Players, cutoff, func(r *Player) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	g.Scenes = keepUntil(g.Scenes, cutoff, func(r *Scene) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	g.Triggers = keepUntil(g.Triggers, cutoff, func(r *Trigger) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	g.Plotlines = keepUntil(g.Plotlines, cutoff, func(r *Plotline) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	a.TurningPoints = keepUntil(a.TurningPoints, cutoff, func(r *TurningPoint) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	for i := range a.TurningPoints {
+		tp := &a.TurningPoints[i]
+		tp.PlotPoints = keepUntil(tp.PlotPoints, cutoff, func(r *PlotPointEntry) (time.Time, *gorm.DeletedAt) { return r.CreatedAt, &r.DeletedAt })
+	}
+}
+
+func keepUntil[T any](records []T, cutoff time.Time, times func(*T) (time.Time, *gorm.DeletedAt)) []T {
+	kept := records[:0]
+	for i := range records {
+		created, deleted := times(&records[i])
+		if created.After(cutoff) || (deleted.Valid && !deleted.Time.After(cutoff)) {
+			continue
+		}
+		*deleted = gorm.DeletedAt{}
+		kept = append(kept, records[i])
+	}
+	return kept
+}
+
+// ListForks returns the games forked from the game, oldest first.
+func ListForks(db *gorm.DB, gameID uuid.UUID) ([]Game, error) {
+	var forks []Game
+	if err := db.Where("fork_of = ?", gameID).Order("created_at").Find(&forks).Error; err != nil {
+		return nil, err
+	}
+	return forks, nil
+}
+
+// PromoteFork makes a fork the main line in place of the game it was forked
+// from. The two games swap names, so the fork takes over the original name,
+// and the original becomes a fork of the promoted game, as do its other forks.
+// The promotion is recorded on the fork as an operation that can be undone.
+func PromoteFork(db *gorm.DB, forkID uuid.UUID) error {
+	var fork, parent Game
+	if err := db.First(&fork, "id = ?", forkID).Error; err != nil {
+		return err
+	}
+	if fork.ForkOf == nil {
+		return ErrNotAFork
+	}
+	if err := db.First(&parent, "id = ?", *fork.ForkOf).Error; err != nil {
+		return err
+	}
+
+	desc := fmt.Sprintf("Promote %s over %s", fork.Name, parent.Name)
+	forkLine := map[string]any{"name": parent.Name, "fork_of": parent.ForkOf, "fork_point": parent.ForkPoint, "forked_at": parent.ForkedAt}
+	parentLine := map[string]any{"name": fork.Name, "fork_of": fork.ID, "fork_point": fork.ForkPoint, "forked_at": fork.ForkedAt}
+	return Record(db, fork.ID, desc, func(tx *gorm.DB, rec *Recorder) error {
+		var siblings []Game
+		if err := tx.Where("fork_of = ? AND id <> ?", parent.ID, fork.ID).Find(&siblings).Error; err != nil {
+			return err
+		}
+		for i := range siblings {
+			if err := rec.Update(&siblings[i], map[string]any{"fork_of": fork.ID}); err != nil {
+				return err
+			}
+		}
+
+		// Names are unique, so move the parent's name out of the way first.
+		if err := rec.Update(&parent, map[string]any{"name": uuid.NewString()}); err != nil {
+			return err
+		}
+		if err := rec.Update(&fork, forkLine); err != nil {
+			return err
+		}
+		return rec.Update(&parent, parentLine)
+	})
+}
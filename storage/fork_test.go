@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestForkGame(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Main", Chaos: 5}
+	db.Create(g)
+
+	var scene1, scene2 *Scene
+	var question, later *LogEntry
+	err = Record(db, g.ID, "Start scene 1", func(tx *gorm.DB, rec *Recorder) error {
+		scene1 = &Scene{GameID: g.ID, Number: 1, Title: "Docks", StartedAt: time.Now(), IsActive: true}
+		if err := rec.Create(scene1); err != nil {
+			return err
+		}
+		question = &LogEntry{GameID: g.ID, SceneID: &scene1.ID, Msg: "Is the smuggler here? Yes"}
+		return rec.AddLogEntry(question)
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	th := &Thread{GameID: g.ID, Name: "Find the smuggler"}
+	if err := Record(db, g.ID, "Add thread", func(tx *gorm.DB, rec *Recorder) error { return rec.Create(th) }); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	err = Record(db, g.ID, "End scene 1", func(tx *gorm.DB, rec *Recorder) error {
+		if err := rec.Update(scene1, map[string]any{"is_active": false, "ended_at": time.Now(), "summary": "Found him"}); err != nil {
+			return err
+		}
+		if err := rec.Update(g, map[string]any{"chaos": int8(4)}); err != nil {
+			return err
+		}
+		later = &LogEntry{GameID: g.ID, SceneID: &scene1.ID, Msg: "Scene 1 ended"}
+		return rec.AddLogEntry(later)
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := Record(db, g.ID, "Drop thread", func(tx *gorm.DB, rec *Recorder) error { return rec.Delete(th) }); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	err = Record(db, g.ID, "Start scene 2", func(tx *gorm.DB, rec *Recorder) error {
+		scene2 = &Scene{GameID: g.ID, Number: 2, Title: "Warehouse", StartedAt: time.Now(), IsActive: true}
+		if err := rec.Create(scene2); err != nil {
+			return err
+		}
+		return rec.AddLogEntry(&LogEntry{GameID: g.ID, SceneID: &scene2.ID, Msg: "Scene 2 started"})
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	// What if the scene had gone on after the question?
+	fork, err := ForkGame(db, g.ID, ForkOptions{LogEntryID: &question.ID})
+	if err != nil {
+		t.Fatalf("ForkGame: %v", err)
+	}
+	if fork.Name != "Main fork" || fork.ForkOf == nil || *fork.ForkOf != g.ID || fork.ForkPoint != "log entry "+question.ID.String() {
+		t.Fatalf("fork = %q of %v at %q", fork.Name, fork.ForkOf, fork.ForkPoint)
+	}
+	if fork.Chaos != 5 {
+		t.Fatalf("fork chaos = %d, want 5", fork.Chaos)
+	}
+	var log []LogEntry
+	db.Where("game_id = ?", fork.ID).Find(&log)
+	if len(log) != 1 || log[0].Msg != question.Msg || log[0].ID == question.ID {
+		t.Fatalf("fork log = %+v", log)
+	}
+	var scenes []Scene
+	db.Where("game_id = ?", fork.ID).Find(&scenes)
+	if len(scenes) != 1 || !scenes[0].IsActive || scenes[0].EndedAt != nil || scenes[0].Summary != "" || *log[0].SceneID != scenes[0].ID {
+		t.Fatalf("fork scenes = %+v", scenes)
+	}
+	if n := db.Where("game_id = ?", fork.ID).Find(&[]Thread{}).RowsAffected; n != 0 {
+		t.Fatalf("fork has %d threads, want 0", n)
+	}
+
+	// The original is untouched.
+	var main Game
+	db.First(&main, "id = ?", g.ID)
+	if main.Chaos != 4 || main.ForkOf != nil {
+		t.Fatalf("main chaos = %d, fork of %v", main.Chaos, main.ForkOf)
+	}
+
+	// Forking at the end of scene 1 keeps the scene ending and brings back the
+	// thread, which was only dropped afterwards.
+	fork2, err := ForkGame(db, g.ID, ForkOptions{SceneNumber: 1})
+	if err != nil {
+		t.Fatalf("ForkGame: %v", err)
+	}
+	if fork2.Name != "Main fork 2" || fork2.ForkPoint != "scene 1" || fork2.Chaos != 4 {
+		t.Fatalf("fork = %q at %q with chaos %d", fork2.Name, fork2.ForkPoint, fork2.Chaos)
+	}
+	var threads []Thread
+	db.Where("game_id = ?", fork2.ID).Find(&threads)
+	if len(threads) != 1 || threads[0].Name != th.Name {
+		t.Fatalf("fork threads = %+v", threads)
+	}
+	scenes = nil
+	db.Where("game_id = ?", fork2.ID).Find(&scenes)
+	if len(scenes) != 1 || scenes[0].IsActive || scenes[0].Summary != "Found him" {
+		t.Fatalf("fork scenes = %+v", scenes)
+	}
+
+	forks, err := ListForks(db, g.ID)
+	if err != nil {
+		t.Fatalf("ListForks: %v", err)
+	}
+	if len(forks) != 2 || forks[0].ID != fork.ID || forks[1].ID != fork2.ID {
+		t.Fatalf("ListForks = %+v", forks)
+	}
+
+	if _, err := ForkGame(db, g.ID, ForkOptions{LogEntryID: &question.ID, Name: "Main"}); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("ForkGame with taken name error = %v, want ErrDuplicateName", err)
+	}
+	if _, err := ForkGame(db, g.ID, ForkOptions{}); err == nil {
+		t.Fatalf("ForkGame without a fork point succeeded")
+	}
+}
+
+func TestPromoteFork(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Main", Chaos: 5}
+	db.Create(g)
+	entry := &LogEntry{GameID: g.ID, Msg: "Start"}
+	db.Create(entry)
+
+	fork, err := ForkGame(db, g.ID, ForkOptions{LogEntryID: &entry.ID, Name: "What if"})
+	if err != nil {
+		t.Fatalf("ForkGame: %v", err)
+	}
+	sibling, err := ForkGame(db, g.ID, ForkOptions{LogEntryID: &entry.ID})
+	if err != nil {
+		t.Fatalf("ForkGame: %v", err)
+	}
+
+	if err := PromoteFork(db, g.ID); !errors.Is(err, ErrNotAFork) {
+		t.Fatalf("PromoteFork of main line error = %v, want ErrNotAFork", err)
+	}
+	if err := PromoteFork(db, fork.ID); err != nil {
+		t.Fatalf("PromoteFork: %v", err)
+	}
+
+	var promoted, old, other Game
+	db.First(&promoted, "id = ?", fork.ID)
+	db.First(&old, "id = ?", g.ID)
+	db.First(&other, "id = ?", sibling.ID)
+	if promoted.Name != "Main" || promoted.ForkOf != nil || promoted.ForkedAt != nil {
+		t.Fatalf("promoted = %q, fork of %v", promoted.Name, promoted.ForkOf)
+	}
+	if old.Name != "What if" || old.ForkOf == nil || *old.ForkOf != fork.ID || old.ForkPoint != fork.ForkPoint {
+		t.Fatalf("old main line = %q, fork of %v at %q", old.Name, old.ForkOf, old.ForkPoint)
+	}
+	if other.ForkOf == nil || *other.ForkOf != fork.ID {
+		t.Fatalf("sibling fork of %v, want %v", other.ForkOf, fork.ID)
+	}
+
+	if _, err := Undo(db, fork.ID); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	promoted, old, other = Game{}, Game{}, Game{}
+	db.First(&promoted, "id = ?", fork.ID)
+	db.First(&old, "id = ?", g.ID)
+	db.First(&other, "id = ?", sibling.ID)
+	if promoted.Name != "What if" || old.Name != "Main" || old.ForkOf != nil || *promoted.ForkOf != g.ID || *other.ForkOf != g.ID {
+		t.Fatalf("after undo promoted = %q of %v, old = %q of %v", promoted.Name, promoted.ForkOf, old.Name, old.ForkOf)
+	}
+}
@@ -0,0 +1,294 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormStore implements Store on a GORM database, such as one opened with InitDatabase.
+type GormStore struct {
+	DB *gorm.DB
+}
+
+// NewGormStore returns a Store backed by db.
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{DB: db}
+}
+
+var _ Store = (*GormStore)(nil)
+
+// CreateGame implements GameStore.
+func (s *GormStore) CreateGame(ctx context.Context, g *Game) error {
+	return translateError(s.DB.WithContext(ctx).Omit(clause.Associations).Create(g).Error)
+}
+
+// GetGame implements GameStore.
+func (s *GormStore) GetGame(ctx context.Context, id uuid.UUID) (*Game, error) {
+	return gormFirst[Game](ctx, s.DB, "id = ?", id)
+}
+
+// GetGameByName implements GameStore.
+func (s *GormStore) GetGameByName(ctx context.Context, name string) (*Game, error) {
+	return gormFirst[Game](ctx, s.DB, "name = ?", name)
+}
+
+// ListGames implements GameStore.
+func (s *GormStore) ListGames(ctx context.Context) ([]Game, error) {
+	var games []Game
+	if err := s.DB.WithContext(ctx).Order("name").Find(&games).Error; err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+// UpdateGame implements GameStore, recording the change in the game's history.
+// If it fails, g's UpdatedAt is put back so that the update can be retried.
+func (s *GormStore) UpdateGame(ctx context.Context, g *Game) error {
+	version := g.UpdatedAt
+	err := gormRecordUpdate(ctx, s.DB, g.ID, fmt.Sprintf("Update game %s", g.Name), g)
+	if err != nil {
+		g.UpdatedAt = version
+	}
+	return translateError(err)
+}
+
+// DeleteGame implements GameStore.
+func (s *GormStore) DeleteGame(ctx context.Context, id uuid.UUID) error {
+	return TrashGame(s.DB.WithContext(ctx), id)
+}
+
+// CreateThread implements ThreadStore, recording the creation in the game's history.
+func (s *GormStore) CreateThread(ctx context.Context, t *Thread) error {
+	return Record(s.DB.WithContext(ctx), t.GameID, fmt.Sprintf("Add thread %s", t.Name), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Create(t)
+	})
+}
+
+// GetThread implements ThreadStore.
+func (s *GormStore) GetThread(ctx context.Context, id uuid.UUID) (*Thread, error) {
+	return gormFirst[Thread](ctx, s.DB, "id = ?", id)
+}
+
+// ListThreads implements ThreadStore.
+func (s *GormStore) ListThreads(ctx context.Context, gameID uuid.UUID) ([]Thread, error) {
+	return gormFind[Thread](ctx, s.DB, "created_at", "game_id = ?", gameID)
+}
+
+// UpdateThread implements ThreadStore, recording the change in the game's history.
+func (s *GormStore) UpdateThread(ctx context.Context, t *Thread) error {
+	return gormRecordUpdate(ctx, s.DB, t.GameID, fmt.Sprintf("Update thread %s", t.Name), t)
+}
+
+// DeleteThread implements ThreadStore, recording the deletion in the game's history.
+func (s *GormStore) DeleteThread(ctx context.Context, id uuid.UUID) error {
+	t, err := gormFirst[Thread](ctx, s.DB, "id = ?", id)
+	if err != nil {
+		return err
+	}
+	return Record(s.DB.WithContext(ctx), t.GameID, fmt.Sprintf("Delete thread %s", t.Name), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Delete(t)
+	})
+}
+
+// CreateCharacter implements CharacterStore, recording the creation in the game's history.
+func (s *GormStore) CreateCharacter(ctx context.Context, c *Character) error {
+	return Record(s.DB.WithContext(ctx), c.GameID, fmt.Sprintf("Add character %s", c.Name), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Create(c)
+	})
+}
+
+// GetCharacter implements CharacterStore.
+func (s *GormStore) GetCharacter(ctx context.Context, id uuid.UUID) (*Character, error) {
+	return gormFirst[Character](ctx, s.DB, "id = ?", id)
+}
+
+// ListCharacters implements CharacterStore.
+func (s *GormStore) ListCharacters(ctx context.Context, gameID uuid.UUID) ([]Character, error) {
+	return gormFind[Character](ctx, s.DB, "created_at", "game_id = ?", gameID)
+}
+
+// UpdateCharacter implements CharacterStore, recording the change in the game's history.
+func (s *GormStore) UpdateCharacter(ctx context.Context, c *Character) error {
+	return gormRecordUpdate(ctx, s.DB, c.GameID, fmt.Sprintf("Update character %s", c.Name), c)
+}
+
+// DeleteCharacter implements CharacterStore, recording the deletion in the game's history.
+func (s *GormStore) DeleteCharacter(ctx context.Context, id uuid.UUID) error {
+	c, err := gormFirst[Character](ctx, s.DB, "id = ?", id)
+	if err != nil {
+		return err
+	}
+	return Record(s.DB.WithContext(ctx), c.GameID, fmt.Sprintf("Delete character %s", c.Name), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Delete(c)
+	})
+}
+
+// CreatePlayer implements PlayerStore, recording the creation in the game's history.
+func (s *GormStore) CreatePlayer(ctx context.Context, p *Player) error {
+	return Record(s.DB.WithContext(ctx), p.GameID, fmt.Sprintf("Add player %s", p.Name), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Create(p)
+	})
+}
+
+// GetPlayer implements PlayerStore.
+func (s *GormStore) GetPlayer(ctx context.Context, id uuid.UUID) (*Player, error) {
+	return gormFirst[Player](ctx, s.DB, "id = ?", id)
+}
+
+// ListPlayers implements PlayerStore.
+func (s *GormStore) ListPlayers(ctx context.Context, gameID uuid.UUID) ([]Player, error) {
+	return gormFind[Player](ctx, s.DB, "created_at", "game_id = ?", gameID)
+}
+
+// UpdatePlayer implements PlayerStore, recording the change in the game's history.
+func (s *GormStore) UpdatePlayer(ctx context.Context, p *Player) error {
+	return gormRecordUpdate(ctx, s.DB, p.GameID, fmt.Sprintf("Update player %s", p.Name), p)
+}
+
+// DeletePlayer implements PlayerStore, recording the deletion in the game's history.
+func (s *GormStore) DeletePlayer(ctx context.Context, id uuid.UUID) error {
+	p, err := gormFirst[Player](ctx, s.DB, "id = ?", id)
+	if err != nil {
+		return err
+	}
+	return Record(s.DB.WithContext(ctx), p.GameID, fmt.Sprintf("Delete player %s", p.Name), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Delete(p)
+	})
+}
+
+// CreateScene implements SceneStore, recording the creation in the game's history.
+func (s *GormStore) CreateScene(ctx context.Context, sc *Scene) error {
+	return Record(s.DB.WithContext(ctx), sc.GameID, fmt.Sprintf("Add scene %d", sc.Number), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Create(sc)
+	})
+}
+
+// GetScene implements SceneStore.
+func (s *GormStore) GetScene(ctx context.Context, id uuid.UUID) (*Scene, error) {
+	return gormFirst[Scene](ctx, s.DB, "id = ?", id)
+}
+
+// ListScenes implements SceneStore.
+func (s *GormStore) ListScenes(ctx context.Context, gameID uuid.UUID) ([]Scene, error) {
+	return gormFind[Scene](ctx, s.DB, "number", "game_id = ?", gameID)
+}
+
+// ActiveScene implements SceneStore.
+func (s *GormStore) ActiveScene(ctx context.Context, gameID uuid.UUID) (*Scene, error) {
+	return gormFirst[Scene](ctx, s.DB, "game_id = ? AND is_active = ?", gameID, true)
+}
+
+// UpdateScene implements SceneStore, recording the change in the game's history.
+func (s *GormStore) UpdateScene(ctx context.Context, sc *Scene) error {
+	return gormRecordUpdate(ctx, s.DB, sc.GameID, fmt.Sprintf("Update scene %d", sc.Number), sc)
+}
+
+// DeleteScene implements SceneStore, recording the deletion in the game's history.
+func (s *GormStore) DeleteScene(ctx context.Context, id uuid.UUID) error {
+	sc, err := gormFirst[Scene](ctx, s.DB, "id = ?", id)
+	if err != nil {
+		return err
+	}
+	return Record(s.DB.WithContext(ctx), sc.GameID, fmt.Sprintf("Delete scene %d", sc.Number), func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Delete(sc)
+	})
+}
+
+// AddLogEntry implements LogStore, recording the entry in the game's history.
+// See the AddLogEntry function.
+func (s *GormStore) AddLogEntry(ctx context.Context, l *LogEntry) error {
+	return Record(s.DB.WithContext(ctx), l.GameID, "Add log entry", func(tx *gorm.DB, rec *Recorder) error {
+		return rec.AddLogEntry(l)
+	})
+}
+
+// ListLog implements LogStore.
+func (s *GormStore) ListLog(ctx context.Context, gameID uuid.UUID, n int) ([]LogEntry, error) {
+	var entries []LogEntry
+	err := s.DB.WithContext(ctx).Where("game_id = ?", gameID).Order("created_at DESC").Limit(n).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListSceneLog implements LogStore.
+func (s *GormStore) ListSceneLog(ctx context.Context, sceneID uuid.UUID) ([]LogEntry, error) {
+	return SceneTranscript(s.DB.WithContext(ctx), sceneID)
+}
+
+// DeleteLogEntry implements LogStore, recording the deletion in the game's history.
+func (s *GormStore) DeleteLogEntry(ctx context.Context, id uuid.UUID) error {
+	l, err := gormFirst[LogEntry](ctx, s.DB, "id = ?", id)
+	if err != nil {
+		return err
+	}
+	return Record(s.DB.WithContext(ctx), l.GameID, "Delete log entry", func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Delete(l)
+	})
+}
+
+func gormFirst[T any](ctx context.Context, db *gorm.DB, query string, args ...any) (*T, error) {
+	var rec T
+	err := db.WithContext(ctx).Where(query, args...).First(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func gormFind[T any](ctx context.Context, db *gorm.DB, order string, query string, args ...any) ([]T, error) {
+	var recs []T
+	if err := db.WithContext(ctx).Where(query, args...).Order(order).Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// gormRecordUpdate saves every field of an existing record of the game,
+// without its associations, and records the change in the game's history.
+func gormRecordUpdate[T any](ctx context.Context, db *gorm.DB, gameID uuid.UUID, desc string, rec *T) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(rec); err != nil {
+		return err
+	}
+	v := reflect.Indirect(reflect.ValueOf(rec))
+	columns := map[string]any{}
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName == "" || f.PrimaryKey || f.AutoCreateTime != 0 || f.AutoUpdateTime != 0 || f.DBName == "deleted_at" {
+			continue
+		}
+		columns[f.DBName], _ = f.ValueOf(ctx, v)
+	}
+	id, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(ctx, v)
+
+	return Record(db.WithContext(ctx), gameID, desc, func(tx *gorm.DB, r *Recorder) error {
+		var n int64
+		if err := tx.Model(new(T)).Where("id = ?", id).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return r.Update(rec, columns)
+	})
+}
+
+// translateError maps unique constraint violations on games to ErrDuplicateName.
+func translateError(err error) error {
+	if err != nil && (errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "UNIQUE constraint failed")) {
+		return ErrDuplicateName
+	}
+	return err
+}
@@ -0,0 +1,408 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrNothingToUndo is returned by Undo when the game has no operation to undo.
+	ErrNothingToUndo = errors.New("nothing to undo")
+	// ErrNothingToRedo is returned by Redo when the game has no undone operation.
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Change actions stored in Change.Action.
+const (
+	ChangeCreate = "create" // The record was created; undone by soft deleting it
+	ChangeUpdate = "update" // Columns were changed from Before to After
+	ChangeDelete = "delete" // The record was soft deleted; undone by restoring it
+)
+
+// Change is one reversible change to a record, part of an Operation.
+type Change struct {
+	Table    string         `json:"table"`
+	RecordID uuid.UUID      `json:"record_id"`
+	Action   string         `json:"action"`
+	Before   map[string]any `json:"before,omitempty"` // Column values before an update
+	After    map[string]any `json:"after,omitempty"`  // Column values after an update
+}
+
+// Changes is a list of changes stored as JSON.
+type Changes []Change
+
+// Value implements driver.Valuer, storing the changes as JSON.
+func (c Changes) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner, reading changes stored by Value.
+func (c *Changes) Scan(value any) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("cannot scan %T into Changes", value)
+	}
+	return json.Unmarshal(b, c)
+}
+
+// Operation is a recorded, reversible change to a game's state. Operations
+// are numbered per game; undone operations can be redone until a new
+// operation is recorded, which discards them.
+type Operation struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time      // When the operation was recorded
+	UpdatedAt   time.Time      // When the operation was last undone or redone
+	DeletedAt   gorm.DeletedAt `gorm:"index"`           // Set when an undone operation is discarded
+	GameID      uuid.UUID      `gorm:"type:uuid;index"` // Foreign key to the game
+	Seq         int            // Sequential operation number within the game
+	Description string         // What the operation did, e.g. "End scene 3"
+	Changes     Changes        `gorm:"type:text"` // The changes, in the order they were made
+	UndoneAt    *time.Time     // When the operation was undone, nil while in effect
+}
+
+// BeforeCreate is a GORM hook that generates a UUID for the operation before creation.
+func (o *Operation) BeforeCreate(tx *gorm.DB) (err error) {
+	o.ID = uuid.New()
+	return
+}
+
+// Recorder collects the changes of an operation. Make changes to the game
+// through its methods so they can be undone.
+type Recorder struct {
+	tx          *gorm.DB
+	description string
+	changes     Changes
+}
+
+// Record runs fn in a transaction and records the changes it makes through
+// rec as one operation on the game. Any undone operations of the game are
+// discarded. Nothing is recorded if fn makes no changes.
+func Record(db *gorm.DB, gameID uuid.UUID, description string, fn func(tx *gorm.DB, rec *Recorder) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		rec := &Recorder{tx: tx, description: description}
+		if err := fn(tx, rec); err != nil {
+			return err
+		}
+		if len(rec.changes) == 0 {
+			return nil
+		}
+
+		if err := tx.Where("game_id = ? AND undone_at IS NOT NULL", gameID).Delete(&Operation{}).Error; err != nil {
+			return err
+		}
+		var last int
+		err := tx.Model(&Operation{}).Unscoped().Where("game_id = ?", gameID).
+			Select("COALESCE(MAX(seq), 0)").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&Operation{GameID: gameID, Seq: last + 1, Description: rec.description, Changes: rec.changes}).Error
+	})
+}
+
+// Describe replaces the description the operation was started with, for an
+// operation described by what it reads in the transaction.
+func (r *Recorder) Describe(description string) {
+	r.description = description
+}
+
+// Create creates the record and records its creation.
+func (r *Recorder) Create(value any) error {
+	if err := r.tx.Create(value).Error; err != nil {
+		return err
+	}
+	return r.Created(value)
+}
+
+// Created records the creation of a record that was created by other code
+// in the same transaction.
+func (r *Recorder) Created(value any) error {
+	table, id, err := r.identify(value)
+	if err != nil {
+		return err
+	}
+	r.changes = append(r.changes, Change{Table: table, RecordID: id, Action: ChangeCreate})
+	return nil
+}
+
+// AddLogEntry adds an entry to the game log, as AddLogEntry does, and records it.
+func (r *Recorder) AddLogEntry(entry *LogEntry) error {
+	if err := AddLogEntry(r.tx, entry); err != nil {
+		return err
+	}
+	return r.Created(entry)
+}
+
+// Update sets columns of the record model, which must have its ID set, and
+// records their old and new values. Updating a game fails with ErrConflict if
+// the game changed since it was loaded.
+func (r *Recorder) Update(model any, columns map[string]any) error {
+	table, id, err := r.identify(model)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if g, ok := model.(*Game); ok {
+		if err := checkGameUnchanged(r.tx, g); err != nil {
+			return err
+		}
+	}
+	before := map[string]any{}
+	if err := r.tx.Table(table).Select(names).Where("id = ?", id).Take(&before).Error; err != nil {
+		return err
+	}
+	if err := r.tx.Model(model).Updates(columns).Error; err != nil {
+		return err
+	}
+	r.changes = append(r.changes, Change{Table: table, RecordID: id, Action: ChangeUpdate,
+		Before: jsonValues(before), After: jsonValues(columns)})
+	return nil
+}
+
+// Delete soft deletes the record model, which must have its ID set, and records it.
+func (r *Recorder) Delete(model any) error {
+	table, id, err := r.identify(model)
+	if err != nil {
+		return err
+	}
+	if err := r.tx.Delete(model, "id = ?", id).Error; err != nil {
+		return err
+	}
+	r.changes = append(r.changes, Change{Table: table, RecordID: id, Action: ChangeDelete})
+	return nil
+}
+
+// identify returns the table and ID of a model pointer.
+func (r *Recorder) identify(model any) (string, uuid.UUID, error) {
+	stmt := &gorm.Statement{DB: r.tx}
+	if err := stmt.Parse(model); err != nil {
+		return "", uuid.Nil, err
+	}
+	value, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(r.tx.Statement.Context, reflect.Indirect(reflect.ValueOf(model)))
+	id, ok := value.(uuid.UUID)
+	if !ok || id == uuid.Nil {
+		return "", uuid.Nil, fmt.Errorf("%s record has no ID", stmt.Schema.Name)
+	}
+	return stmt.Schema.Table, id, nil
+}
+
+// jsonValues converts column values read from or written to the database into
+// values that survive a JSON round trip.
+func jsonValues(columns map[string]any) map[string]any {
+	out := make(map[string]any, len(columns))
+	for k, v := range columns {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			out[k] = nil
+			continue
+		}
+		switch val := v.(type) {
+		case []byte:
+			out[k] = string(val)
+		case driver.Valuer:
+			dv, err := val.Value()
+			if err != nil {
+				dv = nil
+			}
+			out[k] = dv
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// History returns the game's operations in order, including undone ones
+// that can still be redone.
+func History(db *gorm.DB, gameID uuid.UUID) ([]Operation, error) {
+	var ops []Operation
+	if err := db.Where("game_id = ?", gameID).Order("seq").Find(&ops).Error; err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// Undo reverts the game's most recent operation that is in effect and returns
+// it, or ErrNothingToUndo. Game values already loaded are not refreshed. It
+// fails with ErrGameInTrash for a game in the trash, see TrashGame.
+func Undo(db *gorm.DB, gameID uuid.UUID) (*Operation, error) {
+	var op Operation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkGameNotInTrash(tx, gameID); err != nil {
+			return err
+		}
+		err := tx.Where("game_id = ? AND undone_at IS NULL", gameID).Order("seq DESC").First(&op).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNothingToUndo
+		}
+		if err != nil {
+			return err
+		}
+		for i := len(op.Changes) - 1; i >= 0; i-- {
+			if err := applyChange(tx, op.Changes[i], true); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		op.UndoneAt = &now
+		return tx.Model(&op).Update("undone_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// Redo applies the game's earliest undone operation again and returns it, or
+// ErrNothingToRedo. It fails with ErrGameInTrash for a game in the trash.
+func Redo(db *gorm.DB, gameID uuid.UUID) (*Operation, error) {
+	var op Operation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkGameNotInTrash(tx, gameID); err != nil {
+			return err
+		}
+		err := tx.Where("game_id = ? AND undone_at IS NOT NULL", gameID).Order("seq").First(&op).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNothingToRedo
+		}
+		if err != nil {
+			return err
+		}
+		for _, c := range op.Changes {
+			if err := applyChange(tx, c, false); err != nil {
+				return err
+			}
+		}
+		op.UndoneAt = nil
+		return tx.Model(&op).Update("undone_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// applyChange makes a change again, or reverts it when undo is set.
+// Created records are soft deleted on undo and restored on redo.
+func applyChange(tx *gorm.DB, c Change, undo bool) error {
+	row := tx.Table(c.Table).Where("id = ?", c.RecordID)
+	switch c.Action {
+	case ChangeCreate, ChangeDelete:
+		deleted := (c.Action == ChangeCreate) == undo
+		var deletedAt any
+		if deleted {
+			deletedAt = time.Now()
+		}
+		return row.Update("deleted_at", deletedAt).Error
+	case ChangeUpdate:
+		values := c.After
+		if undo {
+			values = c.Before
+		}
+		values, err := decodeColumns(tx, c.Table, values)
+		if err != nil {
+			return err
+		}
+		values["updated_at"] = time.Now()
+		return row.Updates(values).Error
+	default:
+		return fmt.Errorf("unknown change action %q", c.Action)
+	}
+}
+
+// recordedModels are the models whose changes can be recorded in operations.
+var recordedModels = []any{&Game{}, &Thread{}, &Character{}, &Player{}, &Scene{}, &LogEntry{},
+	&Trigger{}, &Plotline{}, &TurningPoint{}, &PlotPointEntry{}}
+
+// decodeColumns converts column values read back from an operation's JSON into
+// the types of the table's model fields, so that e.g. a time stored as an
+// RFC 3339 string or an int decoded as float64 is written as it was read.
+// Values of fields that scan themselves, such as UUIDs and theme state, are
+// already in their database form and are kept.
+func decodeColumns(tx *gorm.DB, table string, columns map[string]any) (map[string]any, error) {
+	var sch *schema.Schema
+	for _, model := range recordedModels {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		if stmt.Schema.Table == table {
+			sch = stmt.Schema
+			break
+		}
+	}
+	if sch == nil {
+		return nil, fmt.Errorf("cannot apply a change to table %q", table)
+	}
+
+	out := make(map[string]any, len(columns)+1)
+	for name, v := range columns {
+		f := sch.LookUpField(name)
+		if f == nil {
+			return nil, fmt.Errorf("%s has no column %q", table, name)
+		}
+		dv, err := decodeColumn(f.FieldType, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", table, name, err)
+		}
+		out[name] = dv
+	}
+	return out, nil
+}
+
+// decodeColumn converts a JSON-decoded value into a value of type t.
+func decodeColumn(t reflect.Type, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if reflect.PointerTo(t).Implements(reflect.TypeFor[sql.Scanner]()) {
+		return v, nil
+	}
+	if s, ok := v.(string); ok && (t == reflect.TypeFor[time.Time]() || t == reflect.TypeFor[*time.Time]()) {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"} {
+			if tm, err := time.Parse(layout, s); err == nil {
+				return tm, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot parse time %q", s)
+	}
+	if n, ok := v.(float64); ok && t.Kind() == reflect.Bool {
+		return n != 0, nil // SQLite reads booleans back as integers
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := reflect.New(t)
+	if err := json.Unmarshal(b, out.Interface()); err != nil {
+		return nil, err
+	}
+	return out.Elem().Interface(), nil
+}
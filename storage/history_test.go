@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DMXMax/mge/util/theme"
+	"gorm.io/gorm"
+)
+
+func TestUndoRedo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "History", Chaos: 5}
+	db.Create(g)
+	th := &Thread{GameID: g.ID, Name: "Find the key"}
+	db.Create(th)
+
+	if err := g.SaveChaos(db, 6); err != nil {
+		t.Fatalf("SaveChaos: %v", err)
+	}
+	if err := th.SetStatus(db, "resolved"); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	var note *LogEntry
+	err = Record(db, g.ID, "Add note", func(tx *gorm.DB, rec *Recorder) error {
+		note = &LogEntry{GameID: g.ID, Msg: "A note"}
+		return rec.AddLogEntry(note)
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	// Reopen to undo in a later session.
+	db, err = InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	for _, want := range []string{"Add note", "Thread Find the key: active -> resolved", "Set chaos factor 5 -> 6"} {
+		op, err := Undo(db, g.ID)
+		if err != nil {
+			t.Fatalf("Undo: %v", err)
+		}
+		if op.Description != want {
+			t.Fatalf("undid %q, want %q", op.Description, want)
+		}
+	}
+	if _, err := Undo(db, g.ID); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("Undo with nothing left error = %v, want ErrNothingToUndo", err)
+	}
+
+	var got Game
+	db.First(&got, "id = ?", g.ID)
+	var thread Thread
+	db.First(&thread, "id = ?", th.ID)
+	if got.Chaos != 5 || thread.Status != "active" {
+		t.Fatalf("after undo chaos = %d, thread status = %q", got.Chaos, thread.Status)
+	}
+	if err := db.First(&LogEntry{}, "id = ?", note.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("undone log entry still visible: %v", err)
+	}
+
+	if _, err := Redo(db, g.ID); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	db.First(&got, "id = ?", g.ID)
+	if got.Chaos != 6 {
+		t.Fatalf("after redo chaos = %d, want 6", got.Chaos)
+	}
+
+	ops, err := History(db, g.ID)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(ops) != 3 || ops[0].UndoneAt != nil || ops[1].UndoneAt == nil || ops[2].Seq != 3 {
+		t.Fatalf("History = %+v", ops)
+	}
+
+	// g predates the undo and redo, so saving it would lose them.
+	if err := g.SaveChaos(db, 8); !errors.Is(err, ErrConflict) {
+		t.Fatalf("SaveChaos on a stale game error = %v, want ErrConflict", err)
+	}
+
+	// A new operation discards the ones that were undone.
+	if err := got.SaveChaos(db, 8); err != nil {
+		t.Fatalf("SaveChaos: %v", err)
+	}
+	if _, err := Redo(db, g.ID); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("Redo after a new operation error = %v, want ErrNothingToRedo", err)
+	}
+	ops, _ = History(db, g.ID)
+	if len(ops) != 2 || ops[1].Seq != 4 || ops[1].Description != "Set chaos factor 6 -> 8" {
+		t.Fatalf("History = %+v", ops)
+	}
+
+	// Restoring a deleted record.
+	err = Record(db, g.ID, "Delete thread", func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Delete(th)
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	Undo(db, g.ID)
+	if err := db.First(&Thread{}, "id = ?", th.ID).Error; err != nil {
+		t.Fatalf("deleted thread not restored: %v", err)
+	}
+}
+
+func TestUndoPlotsAndThemes(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Plots", Chaos: 5, StoryThemes: theme.Themes{theme.ThemeAction, theme.ThemeTension, theme.ThemeMystery, theme.ThemeSocial, theme.ThemePersonal}}
+	db.Create(g)
+	cult := &Plotline{GameID: g.ID, Name: "Stop the cult"}
+	heist := &Plotline{GameID: g.ID, Name: "Rob the bank"}
+	db.Create(cult)
+	db.Create(heist)
+	status := func(pl *Plotline) string {
+		var got Plotline
+		db.First(&got, "id = ?", pl.ID)
+		return got.Status
+	}
+	undo := func(want string) {
+		t.Helper()
+		op, err := Undo(db, g.ID)
+		if err != nil {
+			t.Fatalf("Undo: %v", err)
+		}
+		if op.Description != want {
+			t.Fatalf("undid %q, want %q", op.Description, want)
+		}
+	}
+
+	// Saving a turning point with an accepted conclusion concludes its plotline.
+	tp := &TurningPoint{GameID: g.ID, PlotlineID: &cult.ID, Plotline: cult.Name, PlotPoints: []PlotPointEntry{
+		{Theme: "Action", Name: "CONCLUSION", Accepted: true},
+	}}
+	if err := SaveTurningPoint(db, tp); err != nil {
+		t.Fatalf("SaveTurningPoint: %v", err)
+	}
+	if status(cult) != "concluded" {
+		t.Fatalf("plotline not concluded by the turning point")
+	}
+	undo("Save turning point")
+	if tps, _ := ListTurningPoints(db, g.ID); len(tps) != 0 || status(cult) != "active" {
+		t.Fatalf("after undo turning points = %+v, plotline %s", tps, status(cult))
+	}
+	if err := db.First(&PlotPointEntry{}, "id = ?", tp.PlotPoints[0].ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("undone plot point still visible: %v", err)
+	}
+
+	// The number of an undone turning point is not given out again.
+	tp = &TurningPoint{GameID: g.ID, PlotlineID: &cult.ID, Plotline: cult.Name, PlotPoints: []PlotPointEntry{
+		{Theme: "Action", Name: "CONCLUSION"},
+	}}
+	if err := SaveTurningPoint(db, tp); err != nil {
+		t.Fatalf("SaveTurningPoint: %v", err)
+	}
+	if tp.Number != 2 {
+		t.Fatalf("turning point number = %d, want 2", tp.Number)
+	}
+	if err := AcceptPlotPoint(db, tp.PlotPoints[0].ID); err != nil {
+		t.Fatalf("AcceptPlotPoint: %v", err)
+	}
+	if status(cult) != "concluded" {
+		t.Fatalf("plotline not concluded by accepting the conclusion")
+	}
+	undo("Accept plot point CONCLUSION of turning point 2")
+	var p PlotPointEntry
+	db.First(&p, "id = ?", tp.PlotPoints[0].ID)
+	if p.Accepted || status(cult) != "active" {
+		t.Fatalf("after undo accepted = %v, plotline %s", p.Accepted, status(cult))
+	}
+
+	if err := ConcludePlotline(db, heist.ID); err != nil {
+		t.Fatalf("ConcludePlotline: %v", err)
+	}
+	undo("Conclude plotline Rob the bank")
+	if status(heist) != "active" {
+		t.Fatalf("after undo plotline %s", status(heist))
+	}
+
+	db.First(g, "id = ?", g.ID)
+	g.NextTheme()
+	if err := g.SaveThemes(db); err != nil {
+		t.Fatalf("SaveThemes: %v", err)
+	}
+	undo("Save story themes")
+	var got Game
+	db.First(&got, "id = ?", g.ID)
+	if len(got.ThemeState.History) != 0 {
+		t.Fatalf("after undo theme history = %v", got.ThemeState.History)
+	}
+}
+
+func TestUndoStoreChanges(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	ctx := context.Background()
+	s := NewGormStore(db)
+	g := &Game{Name: "Store", Chaos: 5}
+	if err := s.CreateGame(ctx, g); err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	undo := func() {
+		t.Helper()
+		if _, err := Undo(db, g.ID); err != nil {
+			t.Fatalf("Undo: %v", err)
+		}
+	}
+
+	th := &Thread{GameID: g.ID, Name: "Find the key"}
+	c := &Character{GameID: g.ID, Name: "Mara"}
+	sc := &Scene{GameID: g.ID, Number: 1, Title: "Docks", IsActive: true}
+	if err := s.CreateThread(ctx, th); err != nil {
+		t.Fatalf("CreateThread: %v", err)
+	}
+	if err := s.CreateCharacter(ctx, c); err != nil {
+		t.Fatalf("CreateCharacter: %v", err)
+	}
+	if err := s.CreateScene(ctx, sc); err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+
+	th.Status, c.Notes, sc.Title = "resolved", "A smuggler", "Harbour"
+	if err := s.UpdateThread(ctx, th); err != nil {
+		t.Fatalf("UpdateThread: %v", err)
+	}
+	if err := s.UpdateCharacter(ctx, c); err != nil {
+		t.Fatalf("UpdateCharacter: %v", err)
+	}
+	if err := s.UpdateScene(ctx, sc); err != nil {
+		t.Fatalf("UpdateScene: %v", err)
+	}
+	undo()
+	undo()
+	undo()
+	gotTh, _ := s.GetThread(ctx, th.ID)
+	gotC, _ := s.GetCharacter(ctx, c.ID)
+	gotSc, _ := s.GetScene(ctx, sc.ID)
+	if gotTh.Status != "active" || gotC.Notes != "" || gotSc.Title != "Docks" {
+		t.Fatalf("after undoing updates thread %q, character %q, scene %q", gotTh.Status, gotC.Notes, gotSc.Title)
+	}
+
+	if err := s.DeleteThread(ctx, th.ID); err != nil {
+		t.Fatalf("DeleteThread: %v", err)
+	}
+	if err := s.DeleteCharacter(ctx, c.ID); err != nil {
+		t.Fatalf("DeleteCharacter: %v", err)
+	}
+	if err := s.DeleteScene(ctx, sc.ID); err != nil {
+		t.Fatalf("DeleteScene: %v", err)
+	}
+	undo()
+	undo()
+	undo()
+	for _, get := range []func() error{
+		func() error { _, err := s.GetThread(ctx, th.ID); return err },
+		func() error { _, err := s.GetCharacter(ctx, c.ID); return err },
+		func() error { _, err := s.GetScene(ctx, sc.ID); return err },
+	} {
+		if err := get(); err != nil {
+			t.Fatalf("deleted record not restored: %v", err)
+		}
+	}
+
+	// Undoing the creations removes the records, but the scene number stays
+	// taken, so that the scene keeps a unique number when it is redone.
+	undo()
+	undo()
+	undo()
+	if threads, _ := s.ListThreads(ctx, g.ID); len(threads) != 0 {
+		t.Fatalf("after undo threads = %+v", threads)
+	}
+	if chars, _ := s.ListCharacters(ctx, g.ID); len(chars) != 0 {
+		t.Fatalf("after undo characters = %+v", chars)
+	}
+	if n, err := NextSceneNumber(db, g.ID); err != nil || n != 2 {
+		t.Fatalf("NextSceneNumber after undoing scene 1 = %d, %v; want 2", n, err)
+	}
+	for range 3 {
+		if _, err := Redo(db, g.ID); err != nil {
+			t.Fatalf("Redo: %v", err)
+		}
+	}
+	redone, err := s.GetScene(ctx, sc.ID)
+	if err != nil {
+		t.Fatalf("GetScene after redo: %v", err)
+	}
+	redone.IsActive = false
+	if err := s.UpdateScene(ctx, redone); err != nil {
+		t.Fatalf("UpdateScene: %v", err)
+	}
+	if err := s.CreateScene(ctx, &Scene{GameID: g.ID, Number: 1, Title: "Again"}); err == nil {
+		t.Fatalf("CreateScene with a taken number succeeded")
+	}
+	next, err := NextSceneNumber(db, g.ID)
+	if err != nil {
+		t.Fatalf("NextSceneNumber: %v", err)
+	}
+	if err := s.CreateScene(ctx, &Scene{GameID: g.ID, Number: next, Title: "Warehouse"}); err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+	scenes, _ := s.ListScenes(ctx, g.ID)
+	if len(scenes) != 2 || scenes[0].ID != sc.ID || scenes[0].Number != 1 || scenes[1].Number != 2 {
+		t.Fatalf("scenes after redo and a new scene = %+v", scenes)
+	}
+
+	g.Chaos = 7
+	if err := s.UpdateGame(ctx, g); err != nil {
+		t.Fatalf("UpdateGame: %v", err)
+	}
+	l := &LogEntry{GameID: g.ID, Msg: "Arrived at the docks"}
+	if err := s.AddLogEntry(ctx, l); err != nil {
+		t.Fatalf("AddLogEntry: %v", err)
+	}
+	if err := s.DeleteLogEntry(ctx, l.ID); err != nil {
+		t.Fatalf("DeleteLogEntry: %v", err)
+	}
+	undo()
+	if log, _ := s.ListLog(ctx, g.ID, 10); len(log) != 1 {
+		t.Fatalf("after undoing the deletion log = %+v", log)
+	}
+	undo()
+	if log, _ := s.ListLog(ctx, g.ID, 10); len(log) != 0 {
+		t.Fatalf("after undoing the entry log = %+v", log)
+	}
+	undo()
+	if got, _ := s.GetGame(ctx, g.ID); got.Chaos != 5 {
+		t.Fatalf("after undoing the game update chaos = %d, want 5", got.Chaos)
+	}
+}
+
+func TestUndoKeepsColumnTypes(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Types", Chaos: 5}
+	db.Create(g)
+	tr := &Trigger{GameID: g.ID, Name: "Storm", Condition: TriggerChaos, Threshold: 7, Outcome: "A storm hits"}
+	if err := AddTrigger(db, tr, TriggerOptions{}); err != nil {
+		t.Fatalf("AddTrigger: %v", err)
+	}
+	fired := time.Date(2026, 3, 1, 19, 30, 0, 123456789, time.FixedZone("CET", 3600))
+	err = Record(db, g.ID, "Fire trigger", func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Update(tr, map[string]any{"threshold": 8, "fired_at": fired})
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	type columns struct {
+		Threshold, ThresholdType string
+		FiredAt, FiredAtType     *string
+	}
+	read := func() columns {
+		t.Helper()
+		var c columns
+		err := db.Raw("SELECT CAST(threshold AS TEXT) AS threshold, typeof(threshold) AS threshold_type, fired_at, typeof(fired_at) AS fired_at_type FROM triggers WHERE id = ?", tr.ID).Scan(&c).Error
+		if err != nil {
+			t.Fatalf("read trigger: %v", err)
+		}
+		return c
+	}
+	written := read()
+
+	if _, err := Undo(db, g.ID); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if c := read(); c.Threshold != "7" || c.ThresholdType != "integer" || c.FiredAt != nil {
+		t.Fatalf("after undo threshold %s (%s), fired at %v", c.Threshold, c.ThresholdType, c.FiredAt)
+	}
+	if _, err := Redo(db, g.ID); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	c := read()
+	if c.Threshold != "8" || c.ThresholdType != "integer" || c.FiredAt == nil || *c.FiredAt != *written.FiredAt || *c.FiredAtType != *written.FiredAtType {
+		t.Fatalf("after redo threshold %s (%s), fired at %v; written as %v", c.Threshold, c.ThresholdType, *c.FiredAt, *written.FiredAt)
+	}
+	var got Trigger
+	db.First(&got, "id = ?", tr.ID)
+	if got.FiredAt == nil || !got.FiredAt.Equal(fired) {
+		t.Fatalf("after redo FiredAt = %v, want %v", got.FiredAt, fired)
+	}
+
+	// Values come back from an operation's JSON as float64 and strings.
+	values, err := decodeColumns(db, "triggers", map[string]any{"threshold": 8.0, "fired_at": fired.Format(time.RFC3339Nano), "active": 1.0})
+	if err != nil {
+		t.Fatalf("decodeColumns: %v", err)
+	}
+	if v, ok := values["threshold"].(int); !ok || v != 8 {
+		t.Errorf("threshold decoded as %T %v", values["threshold"], values["threshold"])
+	}
+	if v, ok := values["fired_at"].(time.Time); !ok || !v.Equal(fired) {
+		t.Errorf("fired_at decoded as %T %v", values["fired_at"], values["fired_at"])
+	}
+	if v, ok := values["active"].(bool); !ok || !v {
+		t.Errorf("active decoded as %T %v", values["active"], values["active"])
+	}
+}
@@ -0,0 +1,90 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AddLogEntry writes a log entry for its game. Unless the entry already names a
+// scene, it is linked to the game's active scene, so that fate questions,
+// events and narration all land in the scene they happened in.
+// The entry's kind and payload are validated first.
+func AddLogEntry(db *gorm.DB, entry *LogEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	if entry.SceneID == nil {
+		var scene Scene
+		err := db.Where("game_id = ? AND is_active = ?", entry.GameID, true).Limit(1).Find(&scene).Error
+		if err != nil {
+			return err
+		}
+		if scene.ID != uuid.Nil {
+			entry.SceneID = &scene.ID
+		}
+	}
+	return db.Create(entry).Error
+}
+
+// NextSceneNumber returns the number the game's next scene should get. The
+// numbers of scenes in the trash or whose start was undone are not given out
+// again.
+func NextSceneNumber(db *gorm.DB, gameID uuid.UUID) (int, error) {
+	last, err := lastNumber(db, &Scene{}, gameID)
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// ListScenes returns the game's scenes in scene number order.
+func ListScenes(db *gorm.DB, gameID uuid.UUID) ([]Scene, error) {
+	var scenes []Scene
+	if err := db.Where("game_id = ?", gameID).Order("number").Find(&scenes).Error; err != nil {
+		return nil, err
+	}
+	return scenes, nil
+}
+
+// GetScene returns the game's scene with the given number.
+func GetScene(db *gorm.DB, gameID uuid.UUID, number int) (*Scene, error) {
+	var scene Scene
+	err := db.Where("game_id = ? AND number = ?", gameID, number).First(&scene).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("scene %d not found", number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
+
+// SceneTranscript returns every log entry linked to the scene, oldest first.
+func SceneTranscript(db *gorm.DB, sceneID uuid.UUID) ([]LogEntry, error) {
+	var entries []LogEntry
+	if err := db.Where("scene_id = ?", sceneID).Order("created_at").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LogSinceScene returns the game's log entries from the start of the given
+// scene number onwards, oldest first. Entries written between scenes are included.
+func LogSinceScene(db *gorm.DB, gameID uuid.UUID, number int) ([]LogEntry, error) {
+	scene, err := GetScene(db, gameID, number)
+	if err != nil {
+		return nil, err
+	}
+	var entries []LogEntry
+	err = db.Where("game_id = ? AND (scene_id = ? OR created_at >= ?)", gameID, scene.ID, scene.StartedAt).
+		Order("created_at").
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
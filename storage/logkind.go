@@ -0,0 +1,510 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DMXMax/mge/chart"
+	"github.com/DMXMax/mge/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LogKind is the kind of a log entry, stored in LogEntry.Type.
+// Narration and dice rolls keep the values of the original story and dice
+// roll types.
+type LogKind int
+
+// Log entry kinds.
+const (
+	LogNarration    LogKind = iota // Narrative text and prompts
+	LogDiceRoll                    // Dice rolls other than fate questions and scene chaos die rolls
+	LogFateQuestion                // A Fate Chart question and its answer
+	LogRandomEvent                 // A random event
+	LogSceneStart                  // A scene started, with its chaos die roll
+	LogSceneEnd                    // A scene ended
+	LogChaosChange                 // The chaos factor was set
+	LogListChange                  // A Threads, Characters or Plotlines List entry changed
+	LogPlotPoint                   // A plot point of a turning point
+	LogNote                        // A player's note
+)
+
+var logKindNames = []string{
+	LogNarration:    "narration",
+	LogDiceRoll:     "dice_roll",
+	LogFateQuestion: "fate_question",
+	LogRandomEvent:  "random_event",
+	LogSceneStart:   "scene_start",
+	LogSceneEnd:     "scene_end",
+	LogChaosChange:  "chaos_change",
+	LogListChange:   "list_change",
+	LogPlotPoint:    "plot_point",
+	LogNote:         "note",
+}
+
+// ErrInvalidPayload is returned for a log entry whose payload does not match its kind.
+var ErrInvalidPayload = errors.New("invalid log entry payload")
+
+// LogKinds returns every log entry kind in order.
+func LogKinds() []LogKind {
+	kinds := make([]LogKind, len(logKindNames))
+	for i := range kinds {
+		kinds[i] = LogKind(i)
+	}
+	return kinds
+}
+
+// Valid reports whether k is a known kind.
+func (k LogKind) Valid() bool {
+	return k >= 0 && int(k) < len(logKindNames)
+}
+
+func (k LogKind) String() string {
+	if !k.Valid() {
+		return fmt.Sprintf("LogKind(%d)", int(k))
+	}
+	return logKindNames[k]
+}
+
+// ParseLogKind returns the kind with the given name, such as "fate_question".
+func ParseLogKind(name string) (LogKind, error) {
+	i := slices.Index(logKindNames, strings.ToLower(strings.TrimSpace(name)))
+	if i < 0 {
+		return 0, fmt.Errorf("unknown log entry kind %q (must be one of %s)", name, strings.Join(logKindNames, ", "))
+	}
+	return LogKind(i), nil
+}
+
+// Payload is the JSON encoded structured data of a log entry. It is stored
+// as text and embedded as is in JSON.
+type Payload json.RawMessage
+
+// Value implements the driver.Valuer interface for Gorm.
+func (p Payload) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	return string(p), nil
+}
+
+// Scan implements the sql.Scanner interface for Gorm.
+func (p *Payload) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+	case string:
+		*p = Payload(v)
+	case []byte:
+		*p = append(Payload(nil), v...)
+	default:
+		return fmt.Errorf("unsupported type for Payload scan: %T", value)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Payload) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*p = nil
+		return nil
+	}
+	*p = append((*p)[:0], b...)
+	return nil
+}
+
+// LogPayload is the structured data of a log entry of a particular kind.
+type LogPayload interface {
+	Kind() LogKind
+	Validate() error
+}
+
+// FateQuestionPayload is a Fate Chart question and its answer.
+type FateQuestionPayload struct {
+	Question  string `json:"question,omitempty"`
+	Odds      string `json:"odds"`
+	Chaos     int    `json:"chaos"`
+	Threshold int    `json:"threshold,omitempty"` // The Fate Chart value the roll was made against
+	Roll      int    `json:"roll"`
+	Answer    string `json:"answer"`          // "Yes", "No", "Exceptional Yes" or "Exceptional No"
+	Event     string `json:"event,omitempty"` // A random event the roll raised
+
+	// The player who asked, in group play.
+	PlayerID *uuid.UUID `json:"player_id,omitempty"`
+	Player   string     `json:"player,omitempty"`
+}
+
+// RandomEventPayload is a random event.
+type RandomEventPayload struct {
+	Focus       string   `json:"focus"`
+	Action      string   `json:"action,omitempty"`
+	Subject     string   `json:"subject,omitempty"`
+	Descriptors []string `json:"descriptors,omitempty"` // Meaning words
+	Actions     []string `json:"actions,omitempty"`     // Meaning words
+	Text        string   `json:"text"`                  // The event as logged, after keyed events
+	Triggers    []string `json:"triggers,omitempty"`    // Names of the keyed events that fired
+
+	// The Player Character a PC Negative or PC Positive event targets.
+	TargetID *uuid.UUID `json:"target_id,omitempty"`
+	Target   string     `json:"target,omitempty"`
+}
+
+// DiceRollPayload is a roll of dice.
+type DiceRollPayload struct {
+	Dice  string `json:"dice"` // Dice notation, e.g. "4dF" or "2d6"
+	Rolls []int  `json:"rolls,omitempty"`
+	Total int    `json:"total"`
+}
+
+// SceneStartPayload is the start of a scene.
+type SceneStartPayload struct {
+	Number   int    `json:"number"`
+	Concept  string `json:"concept"`
+	Type     string `json:"type"` // "expected", "altered", "interrupt" or "keyed"
+	ChaosDie int    `json:"chaos_die"`
+	Chaos    int    `json:"chaos"`
+}
+
+// SceneEndPayload is the end of a scene and the chaos factor change it caused.
+type SceneEndPayload struct {
+	Number       int    `json:"number"`
+	Summary      string `json:"summary,omitempty"`
+	PCsInControl bool   `json:"pcs_in_control"`
+	ChaosFrom    int    `json:"chaos_from"`
+	ChaosTo      int    `json:"chaos_to"`
+}
+
+// ChaosChangePayload is a change of the chaos factor.
+type ChaosChangePayload struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Lists that list change log entries refer to.
+const (
+	ThreadsList    = "threads"
+	CharactersList = "characters"
+	PlotlinesList  = "plotlines"
+)
+
+// ListChangePayload is a change to an entry of the Threads, Characters or
+// Plotlines List.
+type ListChangePayload struct {
+	List      string    `json:"list"` // ThreadsList, CharactersList or PlotlinesList
+	RecordID  uuid.UUID `json:"record_id"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason,omitempty"` // What made the change, e.g. a meta plot point
+	OldWeight int       `json:"old_weight,omitempty"`
+	NewWeight int       `json:"new_weight,omitempty"`
+	OldStatus string    `json:"old_status,omitempty"`
+	NewStatus string    `json:"new_status,omitempty"`
+}
+
+// PlotPointPayload is a plot point of a turning point.
+type PlotPointPayload struct {
+	TurningPoint int    `json:"turning_point"` // Turning point number
+	Position     int    `json:"position"`
+	Plotline     string `json:"plotline,omitempty"`
+	Theme        string `json:"theme,omitempty"`
+	Roll         int    `json:"roll"`
+	Name         string `json:"name"`
+	Meta         string `json:"meta,omitempty"`
+}
+
+// NarrationPayload is narrative text or a prompt.
+type NarrationPayload struct {
+	Text string `json:"text"`
+}
+
+// NotePayload is a player's note.
+type NotePayload struct {
+	Text string `json:"text"`
+}
+
+func (*NarrationPayload) Kind() LogKind    { return LogNarration }
+func (*NotePayload) Kind() LogKind         { return LogNote }
+func (*FateQuestionPayload) Kind() LogKind { return LogFateQuestion }
+func (*RandomEventPayload) Kind() LogKind  { return LogRandomEvent }
+func (*DiceRollPayload) Kind() LogKind     { return LogDiceRoll }
+func (*SceneStartPayload) Kind() LogKind   { return LogSceneStart }
+func (*SceneEndPayload) Kind() LogKind     { return LogSceneEnd }
+func (*ChaosChangePayload) Kind() LogKind  { return LogChaosChange }
+func (*ListChangePayload) Kind() LogKind   { return LogListChange }
+func (*PlotPointPayload) Kind() LogKind    { return LogPlotPoint }
+
+func (p *NarrationPayload) Validate() error {
+	if strings.TrimSpace(p.Text) == "" {
+		return fmt.Errorf("%w: narration needs text", ErrInvalidPayload)
+	}
+	return nil
+}
+
+func (p *NotePayload) Validate() error {
+	if strings.TrimSpace(p.Text) == "" {
+		return fmt.Errorf("%w: note needs text", ErrInvalidPayload)
+	}
+	return nil
+}
+
+var fateAnswers = []string{"Yes", "No", "Exceptional Yes", "Exceptional No"}
+
+func (p *FateQuestionPayload) Validate() error {
+	switch {
+	case !slices.Contains(chart.OddsStrList, p.Odds):
+		return fmt.Errorf("%w: unknown odds %q", ErrInvalidPayload, p.Odds)
+	case p.Roll < 1 || p.Roll > 100:
+		return fmt.Errorf("%w: fate roll out of range (1-100): %d", ErrInvalidPayload, p.Roll)
+	case !slices.Contains(fateAnswers, p.Answer):
+		return fmt.Errorf("%w: unknown answer %q", ErrInvalidPayload, p.Answer)
+	}
+	return nil
+}
+
+func (p *RandomEventPayload) Validate() error {
+	if p.Focus == "" || p.Text == "" {
+		return fmt.Errorf("%w: random event needs a focus and text", ErrInvalidPayload)
+	}
+	return nil
+}
+
+func (p *DiceRollPayload) Validate() error {
+	if p.Dice == "" {
+		return fmt.Errorf("%w: dice roll needs dice", ErrInvalidPayload)
+	}
+	return nil
+}
+
+var sceneTypes = []string{"expected", "altered", "interrupt", "keyed"}
+
+func (p *SceneStartPayload) Validate() error {
+	switch {
+	case p.Number < 1:
+		return fmt.Errorf("%w: scene number must be positive: %d", ErrInvalidPayload, p.Number)
+	case !slices.Contains(sceneTypes, p.Type):
+		return fmt.Errorf("%w: unknown scene type %q", ErrInvalidPayload, p.Type)
+	case p.ChaosDie < 1 || p.ChaosDie > 10:
+		return fmt.Errorf("%w: chaos die roll out of range (1-10): %d", ErrInvalidPayload, p.ChaosDie)
+	}
+	return nil
+}
+
+func (p *SceneEndPayload) Validate() error {
+	if p.Number < 1 {
+		return fmt.Errorf("%w: scene number must be positive: %d", ErrInvalidPayload, p.Number)
+	}
+	return validChaos(p.ChaosTo)
+}
+
+// Validate checks the new chaos factor only; the old one may predate the
+// chaos factor being kept within bounds.
+func (p *ChaosChangePayload) Validate() error {
+	return validChaos(p.To)
+}
+
+func (p *ListChangePayload) Validate() error {
+	switch {
+	case !slices.Contains([]string{ThreadsList, CharactersList, PlotlinesList}, p.List):
+		return fmt.Errorf("%w: unknown list %q", ErrInvalidPayload, p.List)
+	case p.Name == "":
+		return fmt.Errorf("%w: list change needs the entry's name", ErrInvalidPayload)
+	case p.OldWeight < 0 || p.NewWeight < 0:
+		return fmt.Errorf("%w: list weights cannot be negative", ErrInvalidPayload)
+	}
+	return nil
+}
+
+func (p *PlotPointPayload) Validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: plot point needs a name", ErrInvalidPayload)
+	case p.Roll < 1 || p.Roll > 100:
+		return fmt.Errorf("%w: plot point roll out of range (1-100): %d", ErrInvalidPayload, p.Roll)
+	}
+	return nil
+}
+
+func validChaos(chaos int) error {
+	if chaos < MinChaos || chaos > MaxChaos {
+		return fmt.Errorf("%w: chaos factor out of range (%d-%d): %d", ErrInvalidPayload, MinChaos, MaxChaos, chaos)
+	}
+	return nil
+}
+
+// newPayload returns an empty payload for the kind, or nil for an unknown
+// kind.
+func newPayload(k LogKind) LogPayload {
+	switch k {
+	case LogNarration:
+		return &NarrationPayload{}
+	case LogNote:
+		return &NotePayload{}
+	case LogFateQuestion:
+		return &FateQuestionPayload{}
+	case LogRandomEvent:
+		return &RandomEventPayload{}
+	case LogDiceRoll:
+		return &DiceRollPayload{}
+	case LogSceneStart:
+		return &SceneStartPayload{}
+	case LogSceneEnd:
+		return &SceneEndPayload{}
+	case LogChaosChange:
+		return &ChaosChangePayload{}
+	case LogListChange:
+		return &ListChangePayload{}
+	case LogPlotPoint:
+		return &PlotPointPayload{}
+	}
+	return nil
+}
+
+// NewLogEntry returns a log entry of the payload's kind for the game.
+func NewLogEntry(gameID uuid.UUID, msg string, p LogPayload) (*LogEntry, error) {
+	l := &LogEntry{GameID: gameID, Msg: msg}
+	if err := l.SetPayload(p); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetPayload validates p and stores it as the entry's payload, setting the
+// entry's kind to the payload's.
+func (l *LogEntry) SetPayload(p LogPayload) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	l.Type, l.Payload = p.Kind(), b
+	return nil
+}
+
+// DecodePayload returns the entry's payload as the struct for its kind, such
+// as *FateQuestionPayload. It returns nil for entries without a payload.
+func (l *LogEntry) DecodePayload() (LogPayload, error) {
+	if len(l.Payload) == 0 {
+		return nil, nil
+	}
+	p := newPayload(l.Type)
+	if p == nil {
+		return nil, fmt.Errorf("%w: unknown log entry kind %d", ErrInvalidPayload, int(l.Type))
+	}
+	if err := json.Unmarshal(l.Payload, p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return p, nil
+}
+
+// Validate checks that the entry's kind is known and that its payload, if
+// any, decodes and is valid. Entries of every kind may leave out the payload.
+func (l *LogEntry) Validate() error {
+	if !l.Type.Valid() {
+		return fmt.Errorf("unknown log entry kind %d", int(l.Type))
+	}
+	p, err := l.DecodePayload()
+	if err != nil || p == nil {
+		return err
+	}
+	return p.Validate()
+}
+
+// NewFateQuestionPayload returns the payload for a Fate Chart roll made for question.
+func NewFateQuestionPayload(question string, r *chart.Result) *FateQuestionPayload {
+	p := &FateQuestionPayload{
+		Question:  question,
+		Odds:      r.RollOdds.String(),
+		Chaos:     r.Chaos,
+		Threshold: r.Odds,
+		Roll:      r.Roll,
+		Answer:    r.Text,
+	}
+	if r.Event != nil {
+		p.Event = r.Event.String()
+	}
+	return p
+}
+
+// AskedBy attributes the question to the player and returns p.
+func (p *FateQuestionPayload) AskedBy(player *Player) *FateQuestionPayload {
+	id := player.ID
+	p.PlayerID, p.Player = &id, player.Name
+	return p
+}
+
+// NewRandomEventPayload returns the payload for a random event, logged as text.
+func NewRandomEventPayload(e *util.Event, text string) *RandomEventPayload {
+	return &RandomEventPayload{
+		Focus:       util.EventText[e.Focus],
+		Action:      e.Action,
+		Subject:     e.Subject,
+		Descriptors: slices.Clone(e.Meaning.Descriptors),
+		Actions:     slices.Clone(e.Meaning.Actions),
+		Text:        text,
+	}
+}
+
+// legacyFate matches the text of a Fate Chart question, chart.Result's
+// String, as logged before entries had kinds.
+var legacyFate = regexp.MustCompile(`^(` + strings.Join(chart.OddsStrList, "|") +
+	`) - (\d+): (Exceptional Yes|Exceptional No|Yes|No)\s*(?:\| Event: (.*))?$`)
+
+// classifyLegacy returns the payload of an entry logged with the original
+// story (0) or dice roll (1) type whose message is a Fate Chart question, or
+// nil for any other entry, which keeps its type.
+func classifyLegacy(l *LogEntry) LogPayload {
+	m := legacyFate.FindStringSubmatch(l.Msg)
+	if m == nil {
+		return nil
+	}
+	roll, _ := strconv.Atoi(m[2])
+	p := &FateQuestionPayload{Odds: m[1], Roll: roll, Answer: m[3], Event: m[4]}
+	if p.Validate() != nil {
+		return nil
+	}
+	return p
+}
+
+// typeLogEntries adds the payload column and gives the Fate Chart questions
+// logged with the original story and dice roll types their kind and payload.
+func typeLogEntries(tx *gorm.DB) error {
+	if err := tx.Migrator().AddColumn(&v6LogEntry{}, "Payload"); err != nil {
+		return err
+	}
+
+	var entries []LogEntry
+	return tx.Unscoped().Where("type IN ? AND payload IS NULL", []LogKind{LogNarration, LogDiceRoll}).
+		FindInBatches(&entries, 500, func(_ *gorm.DB, _ int) error {
+			for i := range entries {
+				l := &entries[i]
+				p := classifyLegacy(l)
+				if p == nil {
+					continue
+				}
+				if err := l.SetPayload(p); err != nil {
+					return err
+				}
+				err := tx.Model(&LogEntry{}).Unscoped().Where("id = ?", l.ID).
+					UpdateColumns(map[string]any{"type": l.Type, "payload": l.Payload}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
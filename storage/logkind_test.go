@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLogEntryPayload(t *testing.T) {
+	l, err := NewLogEntry(uuid.New(), "likely - 42: Yes", &FateQuestionPayload{Question: "Is it locked?", Odds: "likely", Chaos: 5, Roll: 42, Answer: "Yes"})
+	if err != nil {
+		t.Fatalf("NewLogEntry: %v", err)
+	}
+	if l.Type != LogFateQuestion || l.Type.String() != "fate_question" {
+		t.Fatalf("kind = %v", l.Type)
+	}
+	p, err := l.DecodePayload()
+	if err != nil {
+		t.Fatalf("DecodePayload: %v", err)
+	}
+	if q, ok := p.(*FateQuestionPayload); !ok || q.Question != "Is it locked?" || q.Roll != 42 {
+		t.Fatalf("DecodePayload = %#v", p)
+	}
+
+	for _, p := range []LogPayload{&NarrationPayload{Text: "The rain stops."}, &NotePayload{Text: "Ask Vera about the map"}} {
+		l, err := NewLogEntry(uuid.New(), "text", p)
+		if err != nil {
+			t.Fatalf("NewLogEntry(%#v): %v", p, err)
+		}
+		if got, err := l.DecodePayload(); err != nil || l.Type != p.Kind() || !reflect.DeepEqual(got, p) {
+			t.Fatalf("DecodePayload = %#v, %v; want %#v", got, err, p)
+		}
+	}
+
+	for _, p := range []LogPayload{
+		&NarrationPayload{},
+		&NotePayload{Text: " "},
+		&FateQuestionPayload{Odds: "likely", Roll: 101, Answer: "Yes"},
+		&FateQuestionPayload{Odds: "probably", Roll: 42, Answer: "Yes"},
+		&SceneStartPayload{Number: 1, Type: "dramatic", ChaosDie: 4},
+		&ChaosChangePayload{From: 5, To: 10},
+		&ListChangePayload{List: "villains", Name: "Vera"},
+	} {
+		if _, err := NewLogEntry(uuid.New(), "bad", p); !errors.Is(err, ErrInvalidPayload) {
+			t.Fatalf("NewLogEntry(%#v) error = %v, want ErrInvalidPayload", p, err)
+		}
+	}
+
+	mismatch := &LogEntry{Type: LogNote, Payload: Payload(`{"from": 5, "to": 6}`)}
+	if err := mismatch.Validate(); !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("Validate of note with a chaos change payload error = %v, want ErrInvalidPayload", err)
+	}
+	if err := (&LogEntry{Type: LogKind(42)}).Validate(); err == nil {
+		t.Fatalf("Validate of unknown kind succeeded")
+	}
+
+	for _, k := range LogKinds() {
+		if got, err := ParseLogKind(k.String()); err != nil || got != k {
+			t.Fatalf("ParseLogKind(%q) = %v, %v", k, got, err)
+		}
+	}
+	if _, err := ParseLogKind("story"); err == nil {
+		t.Fatalf("ParseLogKind of unknown kind succeeded")
+	}
+}
+
+func TestMigrateLegacyLogEntries(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	// A database from before log entries had payloads.
+	if err := migrateTo(db, 5); err != nil {
+		t.Fatalf("migrateTo(5): %v", err)
+	}
+	g := &Game{Name: "Old", Chaos: 5}
+	db.Create(g)
+	legacy := map[string]struct {
+		typ  int
+		want LogKind
+	}{
+		"fifty fifty - 33: Exceptional No | Event: PC Negative: Harm <Trap>": {1, LogFateQuestion},
+		"likely - 61: Yes ":             {0, LogFateQuestion},
+		"4dF: +2":                       {1, LogDiceRoll},
+		"Threads List: add new threads": {0, LogNarration},
+	}
+	for msg, l := range legacy {
+		db.Exec("INSERT INTO log_entries (id, created_at, type, msg, game_id) VALUES (?, ?, ?, ?, ?)",
+			uuid.New(), time.Now(), l.typ, msg, g.ID)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	var entries []LogEntry
+	db.Find(&entries)
+	if len(entries) != len(legacy) {
+		t.Fatalf("%d entries after migration, want %d", len(entries), len(legacy))
+	}
+	for _, l := range entries {
+		if want := legacy[l.Msg].want; l.Type != want {
+			t.Fatalf("%q migrated to %v, want %v", l.Msg, l.Type, want)
+		}
+		if err := l.Validate(); err != nil {
+			t.Fatalf("%q: %v", l.Msg, err)
+		}
+		p, _ := l.DecodePayload()
+		switch p := p.(type) {
+		case *FateQuestionPayload:
+			if l.Msg == "likely - 61: Yes " && (p.Odds != "likely" || p.Roll != 61 || p.Answer != "Yes" || p.Event != "") {
+				t.Fatalf("fate question payload = %+v", p)
+			} else if p.Roll == 33 && (p.Answer != "Exceptional No" || p.Event != "PC Negative: Harm <Trap>") {
+				t.Fatalf("fate question payload = %+v", p)
+			}
+		case nil:
+		default:
+			t.Fatalf("%q has unexpected payload %T", l.Msg, p)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MemoryStore is an in-memory Store for tests and tools that do not need a
+// database. It mirrors GormStore: IDs are generated by the models'
+// BeforeCreate hooks and timestamps on create, column defaults are applied to
+// zero values, columns with their own database encoding, such as Themes, go
+// through Value and Scan, deletes are soft deletes, deleting a game deletes its
+// records and game names are only unique among games that are not deleted.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	games      memTable[Game]
+	threads    memTable[Thread]
+	characters memTable[Character]
+	players    memTable[Player]
+	scenes     memTable[Scene]
+	log        memTable[LogEntry]
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		games: memTable[Game]{
+			meta: func(g *Game) *memMeta { return &memMeta{&g.ID, &g.CreatedAt, &g.UpdatedAt, &g.DeletedAt} },
+			prepare: func(g *Game) {
+				g.Log, g.Threads, g.Characters, g.Scenes, g.Triggers, g.Plotlines, g.Players = nil, nil, nil, nil, nil, nil, nil
+				g.ThemeState.History = slices.Clone(g.ThemeState.History)
+			},
+		},
+		threads: memTable[Thread]{
+			meta: func(t *Thread) *memMeta { return &memMeta{&t.ID, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt} },
+			defaults: func(t *Thread) {
+				t.Weight = cmp.Or(t.Weight, 1)
+				t.Status = cmp.Or(t.Status, "active")
+			},
+		},
+		characters: memTable[Character]{
+			meta: func(c *Character) *memMeta { return &memMeta{&c.ID, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt} },
+			defaults: func(c *Character) {
+				c.Weight = cmp.Or(c.Weight, 1)
+				c.Status = cmp.Or(c.Status, "active")
+			},
+		},
+		players: memTable[Player]{
+			meta: func(p *Player) *memMeta { return &memMeta{&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt} },
+		},
+		scenes: memTable[Scene]{
+			meta:     func(s *Scene) *memMeta { return &memMeta{&s.ID, &s.CreatedAt, &s.UpdatedAt, &s.DeletedAt} },
+			defaults: func(s *Scene) { s.IsActive = true },
+		},
+		log: memTable[LogEntry]{
+			meta: func(l *LogEntry) *memMeta { return &memMeta{&l.ID, &l.CreatedAt, &l.UpdatedAt, &l.DeletedAt} },
+		},
+	}
+}
+
+// CreateGame implements GameStore.
+func (s *MemoryStore) CreateGame(ctx context.Context, g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.games.list(func(o *Game) bool { return o.Name == g.Name })) > 0 {
+		return ErrDuplicateName
+	}
+	return s.games.create(g)
+}
+
+// GetGame implements GameStore.
+func (s *MemoryStore) GetGame(ctx context.Context, id uuid.UUID) (*Game, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.games.get(id)
+}
+
+// GetGameByName implements GameStore.
+func (s *MemoryStore) GetGameByName(ctx context.Context, name string) (*Game, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	games := s.games.list(func(g *Game) bool { return g.Name == name })
+	if len(games) == 0 {
+		return nil, ErrNotFound
+	}
+	return &games[0], nil
+}
+
+// ListGames implements GameStore.
+func (s *MemoryStore) ListGames(ctx context.Context) ([]Game, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	games := s.games.list(func(*Game) bool { return true })
+	slices.SortStableFunc(games, func(a, b Game) int { return cmp.Compare(a.Name, b.Name) })
+	return games, nil
+}
+
+// UpdateGame implements GameStore.
+func (s *MemoryStore) UpdateGame(ctx context.Context, g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.games.list(func(o *Game) bool { return o.Name == g.Name && o.ID != g.ID })) > 0 {
+		return ErrDuplicateName
+	}
+	if i := s.games.index(g.ID); i >= 0 && !g.UpdatedAt.IsZero() && !s.games.rows[i].UpdatedAt.Equal(g.UpdatedAt) {
+		return fmt.Errorf("game %q: %w", g.Name, ErrConflict)
+	}
+	return s.games.update(g)
+}
+
+// DeleteGame implements GameStore.
+func (s *MemoryStore) DeleteGame(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.games.index(id) < 0 {
+		return ErrNotFound
+	}
+	// Like TrashGame, the game and its records share the deletion time.
+	at := gorm.DeletedAt{Time: time.Now(), Valid: true}
+	deleteAll(&s.games, at, func(g *Game) bool { return g.ID == id })
+	deleteAll(&s.threads, at, func(t *Thread) bool { return t.GameID == id })
+	deleteAll(&s.characters, at, func(c *Character) bool { return c.GameID == id })
+	deleteAll(&s.players, at, func(p *Player) bool { return p.GameID == id })
+	deleteAll(&s.scenes, at, func(sc *Scene) bool { return sc.GameID == id })
+	deleteAll(&s.log, at, func(l *LogEntry) bool { return l.GameID == id })
+	return nil
+}
+
+// CreateThread implements ThreadStore.
+func (s *MemoryStore) CreateThread(ctx context.Context, t *Thread) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threads.create(t)
+}
+
+// GetThread implements ThreadStore.
+func (s *MemoryStore) GetThread(ctx context.Context, id uuid.UUID) (*Thread, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.threads.get(id)
+}
+
+// ListThreads implements ThreadStore.
+func (s *MemoryStore) ListThreads(ctx context.Context, gameID uuid.UUID) ([]Thread, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.threads.list(func(t *Thread) bool { return t.GameID == gameID }), nil
+}
+
+// UpdateThread implements ThreadStore.
+func (s *MemoryStore) UpdateThread(ctx context.Context, t *Thread) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threads.update(t)
+}
+
+// DeleteThread implements ThreadStore.
+func (s *MemoryStore) DeleteThread(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threads.delete(id)
+}
+
+// CreateCharacter implements CharacterStore.
+func (s *MemoryStore) CreateCharacter(ctx context.Context, c *Character) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.characters.create(c)
+}
+
+// GetCharacter implements CharacterStore.
+func (s *MemoryStore) GetCharacter(ctx context.Context, id uuid.UUID) (*Character, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.characters.get(id)
+}
+
+// ListCharacters implements CharacterStore.
+func (s *MemoryStore) ListCharacters(ctx context.Context, gameID uuid.UUID) ([]Character, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.characters.list(func(c *Character) bool { return c.GameID == gameID }), nil
+}
+
+// UpdateCharacter implements CharacterStore.
+func (s *MemoryStore) UpdateCharacter(ctx context.Context, c *Character) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.characters.update(c)
+}
+
+// DeleteCharacter implements CharacterStore.
+func (s *MemoryStore) DeleteCharacter(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.characters.delete(id)
+}
+
+// CreatePlayer implements PlayerStore.
+func (s *MemoryStore) CreatePlayer(ctx context.Context, p *Player) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.players.create(p)
+}
+
+// GetPlayer implements PlayerStore.
+func (s *MemoryStore) GetPlayer(ctx context.Context, id uuid.UUID) (*Player, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.players.get(id)
+}
+
+// ListPlayers implements PlayerStore.
+func (s *MemoryStore) ListPlayers(ctx context.Context, gameID uuid.UUID) ([]Player, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.players.list(func(p *Player) bool { return p.GameID == gameID }), nil
+}
+
+// UpdatePlayer implements PlayerStore.
+func (s *MemoryStore) UpdatePlayer(ctx context.Context, p *Player) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.players.update(p)
+}
+
+// DeletePlayer implements PlayerStore.
+func (s *MemoryStore) DeletePlayer(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.players.delete(id)
+}
+
+// CreateScene implements SceneStore.
+func (s *MemoryStore) CreateScene(ctx context.Context, sc *Scene) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenes.create(sc)
+}
+
+// GetScene implements SceneStore.
+func (s *MemoryStore) GetScene(ctx context.Context, id uuid.UUID) (*Scene, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.scenes.get(id)
+}
+
+// ListScenes implements SceneStore.
+func (s *MemoryStore) ListScenes(ctx context.Context, gameID uuid.UUID) ([]Scene, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scenes := s.scenes.list(func(sc *Scene) bool { return sc.GameID == gameID })
+	slices.SortStableFunc(scenes, func(a, b Scene) int { return cmp.Compare(a.Number, b.Number) })
+	return scenes, nil
+}
+
+// ActiveScene implements SceneStore.
+func (s *MemoryStore) ActiveScene(ctx context.Context, gameID uuid.UUID) (*Scene, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeScene(gameID)
+}
+
+func (s *MemoryStore) activeScene(gameID uuid.UUID) (*Scene, error) {
+	scenes := s.scenes.list(func(sc *Scene) bool { return sc.GameID == gameID && sc.IsActive })
+	if len(scenes) == 0 {
+		return nil, ErrNotFound
+	}
+	return &scenes[0], nil
+}
+
+// UpdateScene implements SceneStore.
+func (s *MemoryStore) UpdateScene(ctx context.Context, sc *Scene) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenes.update(sc)
+}
+
+// DeleteScene implements SceneStore.
+func (s *MemoryStore) DeleteScene(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenes.delete(id)
+}
+
+// AddLogEntry implements LogStore. Like the AddLogEntry function, it validates
+// the entry and links it to the game's active scene unless it already names a scene.
+func (s *MemoryStore) AddLogEntry(ctx context.Context, l *LogEntry) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l.SceneID == nil {
+		if sc, err := s.activeScene(l.GameID); err == nil {
+			l.SceneID = &sc.ID
+		}
+	}
+	return s.log.create(l)
+}
+
+// ListLog implements LogStore.
+func (s *MemoryStore) ListLog(ctx context.Context, gameID uuid.UUID, n int) ([]LogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := s.log.list(func(l *LogEntry) bool { return l.GameID == gameID })
+	slices.Reverse(entries)
+	if n >= 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+// ListSceneLog implements LogStore.
+func (s *MemoryStore) ListSceneLog(ctx context.Context, sceneID uuid.UUID) ([]LogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.log.list(func(l *LogEntry) bool { return l.SceneID != nil && *l.SceneID == sceneID }), nil
+}
+
+// DeleteLogEntry implements LogStore.
+func (s *MemoryStore) DeleteLogEntry(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.delete(id)
+}
+
+// memMeta points at the common model fields of a record.
+type memMeta struct {
+	id        *uuid.UUID
+	createdAt *time.Time
+	updatedAt *time.Time
+	deletedAt *gorm.DeletedAt
+}
+
+// memTable holds copies of the records of one model in creation order.
+type memTable[T any] struct {
+	rows     []T
+	meta     func(*T) *memMeta
+	defaults func(*T) // Applies column defaults to zero values on create
+	prepare  func(*T) // Strips associations and copies shared slices before storing or returning
+}
+
+func (t *memTable[T]) copy(rec *T) T {
+	c := *rec
+	if t.prepare != nil {
+		t.prepare(&c)
+	}
+	return c
+}
+
+func (t *memTable[T]) create(rec *T) error {
+	m := t.meta(rec)
+	now := time.Now()
+	if h, ok := any(rec).(interface{ BeforeCreate(*gorm.DB) error }); ok {
+		if err := h.BeforeCreate(nil); err != nil {
+			return err
+		}
+	} else {
+		*m.id = uuid.New()
+	}
+	if m.createdAt.IsZero() {
+		*m.createdAt = now
+	}
+	if m.updatedAt.IsZero() {
+		*m.updatedAt = now
+	}
+	if t.defaults != nil {
+		t.defaults(rec)
+	}
+	if err := scanValues(rec); err != nil {
+		return err
+	}
+	t.rows = append(t.rows, t.copy(rec))
+	return nil
+}
+
+func (t *memTable[T]) index(id uuid.UUID) int {
+	for i := range t.rows {
+		m := t.meta(&t.rows[i])
+		if *m.id == id && !m.deletedAt.Valid {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *memTable[T]) get(id uuid.UUID) (*T, error) {
+	i := t.index(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	rec := t.copy(&t.rows[i])
+	return &rec, nil
+}
+
+func (t *memTable[T]) findUnscoped(match func(*T) bool) *T {
+	for i := range t.rows {
+		if match(&t.rows[i]) {
+			return &t.rows[i]
+		}
+	}
+	return nil
+}
+
+func (t *memTable[T]) list(match func(*T) bool) []T {
+	var recs []T
+	for i := range t.rows {
+		if !t.meta(&t.rows[i]).deletedAt.Valid && match(&t.rows[i]) {
+			recs = append(recs, t.copy(&t.rows[i]))
+		}
+	}
+	return recs
+}
+
+func (t *memTable[T]) update(rec *T) error {
+	m := t.meta(rec)
+	i := t.index(*m.id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	*m.createdAt = *t.meta(&t.rows[i]).createdAt
+	*m.updatedAt = time.Now()
+	if err := scanValues(rec); err != nil {
+		return err
+	}
+	t.rows[i] = t.copy(rec)
+	return nil
+}
+
+func (t *memTable[T]) delete(id uuid.UUID) error {
+	i := t.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	*t.meta(&t.rows[i]).deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+// deleteAll soft deletes the matching records that are not deleted yet.
+func deleteAll[T any](t *memTable[T], at gorm.DeletedAt, match func(*T) bool) {
+	for i := range t.rows {
+		if m := t.meta(&t.rows[i]); !m.deletedAt.Valid && match(&t.rows[i]) {
+			*m.deletedAt = at
+		}
+	}
+}
+
+// scanValues passes the fields of a record that have their own database
+// encoding through Value and Scan, as saving and loading the record would.
+func scanValues(rec any) error {
+	v := reflect.ValueOf(rec).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !v.Type().Field(i).IsExported() || f.Kind() == reflect.Pointer {
+			continue
+		}
+		valuer, ok := f.Interface().(driver.Valuer)
+		scanner, ok2 := f.Addr().Interface().(sql.Scanner)
+		if !ok || !ok2 {
+			continue
+		}
+		value, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		if err := scanner.Scan(value); err != nil {
+			return fmt.Errorf("%s: %w", v.Type().Field(i).Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer version
+// of this package than the one running.
+var ErrSchemaTooNew = errors.New("database schema is newer than this program")
+
+// Migration is one step of the database schema history. Up runs inside a
+// transaction and may change the schema, the data, or both.
+//
+// Schema changes are made with the frozen types in schema.go rather than the
+// models, so that each version describes one fixed schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table.
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// MigrationStatus reports whether a known migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil if pending
+}
+
+// migrations lists every migration in version order. Append only: never edit
+// or renumber a migration that has been released.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v1Game{}, &v1LogEntry{}, &v1Thread{}, &v1Character{}, &v1Scene{},
+				&v1Trigger{}, &v1Plotline{}, &v1TurningPoint{}, &v1PlotPointEntry{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "default list weights and statuses",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []any{&Thread{}, &Character{}} {
+				err := tx.Model(model).Where("status IS NULL OR status = ''").Update("status", "active").Error
+				if err != nil {
+					return err
+				}
+				err = tx.Model(model).Where("weight IS NULL OR (weight < 1 AND status = ?)", "active").Update("weight", 1).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create operations",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v3Operation{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create search index",
+		Up:      createSearchIndex,
+	},
+	{
+		Version: 5,
+		Name:    "add game forks",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"ForkOf", "ForkPoint", "ForkedAt"} {
+				if err := m.AddColumn(&v5Game{}, field); err != nil {
+					return err
+				}
+			}
+			return m.CreateIndex(&v5Game{}, "ForkOf")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "typed log entries",
+		Up:      typeLogEntries,
+	},
+	{
+		Version: 7,
+		Name:    "free names of deleted games",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec(`DROP INDEX IF EXISTS idx_games_name`).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&v7Game{}, "idx_games_name")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add players",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v8Game{}, &v8Player{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().AddColumn(&v8Character{}, "PlayerID"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&v8Character{}, "PlayerID")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "unique scene and turning point numbers",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateIndex(&v9Scene{}, "idx_scenes_number"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&v9TurningPoint{}, "idx_turning_points_number")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "one active scene per game",
+		Up: func(tx *gorm.DB) error {
+			// Keep only the newest of a game's active scenes active.
+			err := tx.Exec(`UPDATE scenes SET is_active = false
+				WHERE is_active AND deleted_at IS NULL AND EXISTS (
+					SELECT 1 FROM scenes newer WHERE newer.game_id = scenes.game_id
+					AND newer.is_active AND newer.deleted_at IS NULL AND newer.number > scenes.number)`).Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&v10Scene{}, "idx_scenes_active")
+		},
+	},
+}
+
+// Migrations returns every known migration in version order.
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// LatestSchemaVersion returns the schema version this program migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the newest migration applied to db, or
+// 0 if none has been.
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Migrate applies every pending migration in order, each in its own
+// transaction. It returns ErrSchemaTooNew, without changing anything, if the
+// database has a newer schema than LatestSchemaVersion. A database that
+// already holds data is snapshotted first, see AutoSnapshot.
+func Migrate(db *gorm.DB) error {
+	if err := migrateTo(db, LatestSchemaVersion()); err != nil {
+		return err
+	}
+	return checkSearchIndex(db)
+}
+
+// migrateTo applies the pending migrations up to and including version.
+func migrateTo(db *gorm.DB, version int) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return fmt.Errorf("%w: database is at version %d, this program supports up to %d", ErrSchemaTooNew, current, latest)
+	} else if current < version && (current > 0 || db.Migrator().HasTable(&Game{})) {
+		if err := AutoSnapshot(db, fmt.Sprintf("migrate %d", current)); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if m.Version > version {
+			break
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetMigrationStatus lists every known migration with the time it was applied
+// to db, followed by any applied migrations this program does not know about.
+func GetMigrationStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	var applied []SchemaMigration
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		if err := db.Order("version").Find(&applied).Error; err != nil {
+			return nil, err
+		}
+	}
+	byVersion := make(map[int]SchemaMigration, len(applied))
+	for _, a := range applied {
+		byVersion[a.Version] = a
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := byVersion[m.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+			delete(byVersion, m.Version)
+		}
+		status = append(status, s)
+	}
+	for _, a := range applied {
+		if _, ok := byVersion[a.Version]; ok {
+			status = append(status, MigrationStatus{Version: a.Version, Name: a.Name, AppliedAt: &a.AppliedAt})
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestInitDatabaseMigrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	if v, err := SchemaVersion(db); err != nil || v != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion = %d, %v; want %d", v, err, LatestSchemaVersion())
+	}
+	for _, table := range []any{&Game{}, &Scene{}, &PlotPointEntry{}} {
+		if !db.Migrator().HasTable(table) {
+			t.Fatalf("table for %T not created", table)
+		}
+	}
+
+	// Opening again must not re-run anything.
+	if _, err := InitDatabase(path); err != nil {
+		t.Fatalf("second InitDatabase: %v", err)
+	}
+	var count int64
+	db.Model(&SchemaMigration{}).Count(&count)
+	if int(count) != len(migrations) {
+		t.Fatalf("%d migrations recorded, want %d", count, len(migrations))
+	}
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	// The frozen migrations must build the schema the models expect.
+	m := db.Migrator()
+	for _, model := range []any{&Game{}, &LogEntry{}, &Thread{}, &Character{}, &Player{}, &Scene{},
+		&Trigger{}, &Plotline{}, &TurningPoint{}, &PlotPointEntry{}, &Operation{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName != "" && !m.HasColumn(model, f.DBName) {
+				t.Errorf("%s has no column %s", stmt.Schema.Table, f.DBName)
+			}
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			if !m.HasIndex(model, idx.Name) {
+				t.Errorf("%s has no index %s", stmt.Schema.Table, idx.Name)
+			}
+		}
+	}
+}
+
+func TestMigrateDefaultsListEntries(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	// A database created before migrations existed.
+	db.AutoMigrate(&v1Game{}, &v1Thread{})
+	gameID, id := uuid.New(), uuid.New()
+	db.Exec("INSERT INTO games (id, name) VALUES (?, 'Old')", gameID)
+	db.Exec("INSERT INTO threads (id, game_id, name, weight, status) VALUES (?, ?, 'Legacy', 0, '')", id, gameID)
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	var th Thread
+	db.First(&th, "id = ?", id)
+	if th.Status != "active" || th.Weight != 1 {
+		t.Fatalf("legacy thread = %+v, want active with weight 1", th)
+	}
+}
+
+func TestMigrateFreesDeletedGameNames(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	// A database where game names were unique among deleted games too.
+	if err := migrateTo(db, 6); err != nil {
+		t.Fatalf("migrateTo(6): %v", err)
+	}
+	g := &Game{Name: "Old"}
+	db.Create(g)
+	db.Delete(g)
+	if err := db.Create(&Game{Name: "Old"}).Error; err == nil {
+		t.Fatalf("legacy index allowed a deleted game's name")
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := db.Create(&Game{Name: "Old"}).Error; err != nil {
+		t.Fatalf("Create with a deleted game's name: %v", err)
+	}
+	if err := db.Create(&Game{Name: "Old"}).Error; err == nil {
+		t.Fatalf("duplicate name allowed after migration")
+	}
+}
+
+func TestMigrateKeepsOneActiveScene(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	// A database where a game could have several active scenes.
+	if err := migrateTo(db, 9); err != nil {
+		t.Fatalf("migrateTo(9): %v", err)
+	}
+	g := &Game{Name: "Old"}
+	db.Create(g)
+	older := &Scene{GameID: g.ID, Number: 1, Title: "Docks", IsActive: true}
+	newer := &Scene{GameID: g.ID, Number: 2, Title: "Warehouse", IsActive: true}
+	db.Create(older)
+	db.Create(newer)
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	var active []Scene
+	db.Where("game_id = ? AND is_active", g.ID).Find(&active)
+	if len(active) != 1 || active[0].ID != newer.ID {
+		t.Fatalf("active scenes after migration = %+v, want only the newest", active)
+	}
+	if err := db.Create(&Scene{GameID: g.ID, Number: 3, Title: "Again", IsActive: true}).Error; err == nil {
+		t.Fatalf("second active scene allowed after migration")
+	}
+	// A deleted scene does not count.
+	db.Delete(newer)
+	if err := db.Create(&Scene{GameID: g.ID, Number: 3, Title: "Again", IsActive: true}).Error; err != nil {
+		t.Fatalf("Create after deleting the active scene: %v", err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	future := LatestSchemaVersion() + 1
+	db.Create(&SchemaMigration{Version: future, Name: "from the future", AppliedAt: time.Now()})
+
+	if _, err := InitDatabase(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("InitDatabase error = %v, want ErrSchemaTooNew", err)
+	}
+	status, err := GetMigrationStatus(db)
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	last := status[len(status)-1]
+	if len(status) != len(migrations)+1 || last.Version != future || last.AppliedAt == nil {
+		t.Fatalf("GetMigrationStatus = %+v", status)
+	}
+}
+
+func TestMigrationStatusPending(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	status, err := GetMigrationStatus(db)
+	if err != nil {
+		t.Fatalf("GetMigrationStatus: %v", err)
+	}
+	if len(status) != len(migrations) {
+		t.Fatalf("GetMigrationStatus = %+v", status)
+	}
+	for _, s := range status {
+		if s.AppliedAt != nil {
+			t.Fatalf("migration %d reported as applied on a new database", s.Version)
+		}
+	}
+}
@@ -3,6 +3,7 @@
 package storage
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/DMXMax/mge/util/theme"
@@ -11,16 +12,19 @@ import (
 )
 
 // LogEntry represents a single entry in a game's story log.
-// Log entries can be of different types (e.g., dice rolls, story events)
+// Log entries are of different kinds (e.g., fate questions, random events,
+// narration), may carry a structured payload for their kind,
 // and are automatically timestamped.
 type LogEntry struct {
 	ID        uuid.UUID      `gorm:"type:uuid;primary_key;"`
 	CreatedAt time.Time      // When the log entry was created
 	UpdatedAt time.Time      // When the log entry was last updated
 	DeletedAt gorm.DeletedAt `gorm:"index"` // Soft delete support
-	Type      int            // Type of log entry (0 = story, 1 = dice roll, etc.)
+	Type      LogKind        // Kind of log entry, e.g. LogNarration or LogFateQuestion
 	Msg       string         // The log message content
-	GameID    uuid.UUID      `gorm:"type:uuid"` // Foreign key to the game
+	Payload   Payload        `gorm:"type:text"`       // JSON payload for the kind, see LogPayload
+	GameID    uuid.UUID      `gorm:"type:uuid"`       // Foreign key to the game
+	SceneID   *uuid.UUID     `gorm:"type:uuid;index"` // Scene the entry happened in, nil between scenes
 }
 
 // BeforeCreate is a GORM hook that generates a UUID for the log entry before creation.
@@ -49,8 +53,27 @@ func (t *Thread) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// SetStatus changes the thread's status, e.g. to "resolved" to close it, as
+// an operation that can be undone.
+func (t *Thread) SetStatus(db *gorm.DB, status string) error {
+	desc := fmt.Sprintf("Thread %s: %s -> %s", t.Name, t.Status, status)
+	return Record(db, t.GameID, desc, func(tx *gorm.DB, rec *Recorder) error {
+		entry, err := NewLogEntry(t.GameID, desc, &ListChangePayload{
+			List: ThreadsList, RecordID: t.ID, Name: t.Name, OldStatus: t.Status, NewStatus: status,
+		})
+		if err != nil {
+			return err
+		}
+		if err := rec.Update(t, map[string]any{"status": status}); err != nil {
+			return err
+		}
+		return rec.AddLogEntry(entry)
+	})
+}
+
 // Character represents an important NPC in the Characters List.
-// Characters can appear multiple times on the list (weighted, up to 3 times).
+// Characters can appear multiple times on the list (weighted, up to 3 times,
+// or more through Adventure Crafter meta plot points).
 type Character struct {
 	ID          uuid.UUID      `gorm:"type:uuid;primary_key;"`
 	CreatedAt   time.Time      // When the character was created
@@ -62,6 +85,9 @@ type Character struct {
 	Weight      int            `gorm:"default:1"`      // How many times it appears on the list (1-3)
 	Status      string         `gorm:"default:active"` // Status: "active", "inactive"
 	Notes       string         // Additional notes about the character
+	IsPlayer    bool           // Whether this is a Player Character, protected from removal
+	PlayerID    *uuid.UUID     `gorm:"type:uuid;index"` // The player who plays this Player Character, if any
+	CraftRolls  string         `gorm:"type:text"`       // JSON of the element table rolls that crafted the character
 }
 
 // BeforeCreate is a GORM hook that generates a UUID for the character before creation.
@@ -70,19 +96,47 @@ func (c *Character) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// Player is a person playing a game. In group play each player has their
+// own Player Characters, Characters with IsPlayer set and PlayerID pointing
+// at the player, and the fate questions they ask are attributed to them.
+type Player struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time      // When the player joined the game
+	UpdatedAt time.Time      // When the player was last updated
+	DeletedAt gorm.DeletedAt `gorm:"index"`     // Soft delete support
+	GameID    uuid.UUID      `gorm:"type:uuid"` // Foreign key to the game
+	Name      string         // Name of the player (required)
+	Notes     string         // Additional notes about the player
+}
+
+// BeforeCreate is a GORM hook that generates a UUID for the player before creation.
+func (p *Player) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = uuid.New()
+	return
+}
+
 // Scene represents an active scene in a game.
 // Scenes track the current narrative moment with its type (expected, altered, interrupt)
 // and the expected concept for that scene.
 type Scene struct {
-	ID             uuid.UUID      `gorm:"type:uuid;primary_key;"`
-	CreatedAt      time.Time      // When the scene was created
-	UpdatedAt      time.Time      // When the scene was last updated
-	DeletedAt      gorm.DeletedAt `gorm:"index"`     // Soft delete support
-	GameID         uuid.UUID      `gorm:"type:uuid"` // Foreign key to the game
-	Type           string         // Scene type: "expected", "altered", "interrupt"
-	ExpectedConcept string        // The expected scene concept
-	ChaosDieRoll   int           // The chaos die roll result
-	IsActive       bool          `gorm:"default:true"` // Whether this scene is currently active
+	ID               uuid.UUID      `gorm:"type:uuid;primary_key;"`
+	CreatedAt        time.Time      // When the scene was created
+	UpdatedAt        time.Time      // When the scene was last updated
+	DeletedAt        gorm.DeletedAt `gorm:"index"`                                                                                                        // Soft delete support
+	GameID           uuid.UUID      `gorm:"type:uuid;uniqueIndex:idx_scenes_number;uniqueIndex:idx_scenes_active,where:is_active AND deleted_at IS NULL"` // Foreign key to the game
+	Number           int            `gorm:"uniqueIndex:idx_scenes_number"`                                                                                // Sequential scene number within the game, starting at 1
+	Title            string         // Short title for the scene journal
+	Summary          string         // Summary written when the scene ends
+	StartedAt        time.Time      // When the scene started
+	EndedAt          *time.Time     // When the scene ended, nil while active
+	Type             string         // Scene type: "expected", "altered", "interrupt"
+	ExpectedConcept  string         // The expected scene concept
+	ChaosDieRoll     int            // The chaos die roll result
+	Adjustments      string         // Scene adjustments applied to an altered scene ("; " separated)
+	AdjustmentDetail string         // Adjustments resolved against the game's lists and element tables
+	Event            string         // Random event generated for an interrupt scene
+	Keyed            string         // Outcomes of keyed triggers that fired when the scene started
+	IsActive         bool           `gorm:"default:true"` // Whether this scene is currently active
 }
 
 // BeforeCreate is a GORM hook that generates a UUID for the scene before creation.
@@ -91,19 +145,153 @@ func (s *Scene) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// Keyed trigger conditions stored in Trigger.Condition.
+const (
+	TriggerChaos         = "chaos"          // Chaos factor is at least Threshold
+	TriggerSceneCount    = "scene_count"    // Scene number is at least Threshold
+	TriggerThreadStatus  = "thread_status"  // Thread ThreadID has status Value
+	TriggerEventFocus    = "event_focus"    // Rolled event focus text equals Value
+	TriggerScenesElapsed = "scenes_elapsed" // Threshold scenes started since ThreadID last changed, or since the trigger was created
+)
+
+// Keyed trigger checkpoints stored in Trigger.Checkpoint.
+const (
+	TriggerOnScene = "scene" // Checked when a scene starts
+	TriggerOnEvent = "event" // Checked when a random event is generated
+)
+
+// Keyed trigger effects stored in Trigger.Effect.
+const (
+	TriggerOverride = "override" // Replace the normal scene or event outcome
+	TriggerAugment  = "augment"  // Keep the normal outcome and add the trigger's outcome
+)
+
+// Trigger is a Keyed Scene or Keyed Event defined by the GM for a game.
+// When its condition is met while a scene starts (Checkpoint "scene") or a random
+// event is generated (Checkpoint "event"), its Outcome overrides or augments the
+// normal result.
+type Trigger struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;"`
+	CreatedAt  time.Time      // When the trigger was created
+	UpdatedAt  time.Time      // When the trigger was last updated
+	DeletedAt  gorm.DeletedAt `gorm:"index"`     // Soft delete support
+	GameID     uuid.UUID      `gorm:"type:uuid"` // Foreign key to the game
+	Name       string         // Name of the trigger (required)
+	Checkpoint string         `gorm:"default:scene"` // When to check: "scene" or "event"
+	Condition  string         // Condition kind, one of the Trigger* condition constants
+	Threshold  int            // Numeric threshold for chaos, scene count and elapsed scene conditions
+	Value      string         // Thread status or event focus text to match
+	ThreadID   *uuid.UUID     `gorm:"type:uuid"`        // Thread the condition refers to
+	Effect     string         `gorm:"default:override"` // TriggerOverride or TriggerAugment
+	Outcome    string         // The keyed scene or event text
+	Repeatable bool           // Whether the trigger can fire more than once
+	FiredAt    *time.Time     // When the trigger last fired
+	Active     bool           // Whether the trigger is armed; AddTrigger arms new triggers
+}
+
+// BeforeCreate is a GORM hook that generates a UUID for the trigger before creation.
+func (t *Trigger) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+
+// Plotlines List slot kinds stored in Plotline.Kind.
+const (
+	PlotlineKindPlotline = "plotline" // A named plotline
+	PlotlineKindNew      = "new"      // A "New Plotline" slot
+	PlotlineKindLogical  = "logical"  // A "Choose Most Logical Plotline" slot
+)
+
+// Plotline represents an entry in the Adventure Crafter Plotlines List.
+// Besides named plotlines the list can hold "New Plotline" and "Choose Most
+// Logical Plotline" slots. Entries can appear multiple times on the list (weighted).
+type Plotline struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time      // When the plotline was created
+	UpdatedAt   time.Time      // When the plotline was last updated
+	DeletedAt   gorm.DeletedAt `gorm:"index"`     // Soft delete support
+	GameID      uuid.UUID      `gorm:"type:uuid"` // Foreign key to the game
+	Name        string         // Name of the plotline (required for named plotlines)
+	Description string         // Optional description
+	Kind        string         `gorm:"default:plotline"` // Slot kind, one of the PlotlineKind* constants
+	Weight      int            `gorm:"default:1"`        // How many times it appears on the list
+	Status      string         `gorm:"default:active"`   // Status: "active", "concluded"
+}
+
+// BeforeCreate is a GORM hook that generates a UUID for the plotline before creation.
+func (p *Plotline) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = uuid.New()
+	return
+}
+
+// TurningPoint represents an Adventure Crafter turning point for a plotline,
+// generated during a scene.
+type TurningPoint struct {
+	ID         uuid.UUID        `gorm:"type:uuid;primary_key;"`
+	CreatedAt  time.Time        // When the turning point was created
+	UpdatedAt  time.Time        // When the turning point was last updated
+	DeletedAt  gorm.DeletedAt   `gorm:"index"`                                           // Soft delete support
+	GameID     uuid.UUID        `gorm:"type:uuid;uniqueIndex:idx_turning_points_number"` // Foreign key to the game
+	PlotlineID *uuid.UUID       `gorm:"type:uuid"`                                       // The plotline, nil until a new or most logical plotline is chosen
+	SceneID    *uuid.UUID       `gorm:"type:uuid"`                                       // The scene the turning point happened in
+	Number     int              `gorm:"uniqueIndex:idx_turning_points_number"`           // Sequential turning point number within the game
+	Plotline   string           // Plotline as rolled, including special slot results
+	Kind       string           // Turning point kind: "new", "development", "conclusion"
+	PlotPoints []PlotPointEntry `gorm:"foreignKey:TurningPointID"` // Plot points in order
+}
+
+// BeforeCreate is a GORM hook that generates a UUID for the turning point before creation.
+func (t *TurningPoint) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New()
+	return
+}
+
+// PlotPointEntry represents one plot point of a turning point.
+type PlotPointEntry struct {
+	ID             uuid.UUID       `gorm:"type:uuid;primary_key;"`
+	CreatedAt      time.Time       // When the plot point was created
+	UpdatedAt      time.Time       // When the plot point was last updated
+	DeletedAt      gorm.DeletedAt  `gorm:"index"`     // Soft delete support
+	TurningPointID uuid.UUID       `gorm:"type:uuid"` // Foreign key to the turning point
+	Position       int             // Position within the turning point, starting at 1
+	Theme          theme.ThemeType // Theme the plot point was rolled on
+	Roll           int             // The d100 roll on the Plot Points Table
+	Name           string          // Plot point name, e.g. "AMBUSH"
+	Description    string          // Plot point text
+	MetaRoll       int             // The d100 roll on the Meta Plot Points Table, 0 if none
+	Meta           string          // Meta plot point text
+	None           bool            // Whether the plot point is left blank
+	Accepted       bool            // Whether the GM accepted the plot point
+}
+
+// BeforeCreate is a GORM hook that generates a UUID for the plot point before creation.
+func (p *PlotPointEntry) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = uuid.New()
+	return
+}
+
 // Game represents a Mythic game session with all its associated data.
 // Each game has a name, chaos factor, story themes, and a log of events.
 type Game struct {
 	ID          uuid.UUID      `gorm:"type:uuid;primary_key;"`
 	CreatedAt   time.Time      // When the game was created
 	UpdatedAt   time.Time      // When the game was last updated
-	DeletedAt   gorm.DeletedAt `gorm:"index"`       // Soft delete support
-	Name        string         `gorm:"uniqueIndex"` // Name of the game (unique)
+	DeletedAt   gorm.DeletedAt `gorm:"index"`                                               // Soft delete support
+	Name        string         `gorm:"uniqueIndex:idx_games_name,where:deleted_at IS NULL"` // Name of the game, unique among games not in the trash
 	Chaos       int8           // Current Chaos level (1-9)
-	StoryThemes theme.Themes   `gorm:"type:text"`         // Story themes for plot generation
+	StoryThemes theme.Themes   `gorm:"type:text"` // Story themes for plot generation
+	ThemeState  theme.State    `gorm:"type:text"` // Theme alternation and history
+	PlotDataset string         // Plot points dataset name, empty for the default dataset
+	ForkOf      *uuid.UUID     `gorm:"type:uuid;index"` // The game this game was forked from, nil for a main line
+	ForkPoint   string         // Where the game was forked, e.g. "scene 3"
+	ForkedAt    *time.Time     // The moment in the original game's history the fork starts from
 	Log         []LogEntry     `gorm:"foreignKey:GameID"` // Associated log entries
 	Threads     []Thread       `gorm:"foreignKey:GameID"` // Threads List
 	Characters  []Character    `gorm:"foreignKey:GameID"` // Characters List
+	Scenes      []Scene        `gorm:"foreignKey:GameID"` // Scene journal
+	Triggers    []Trigger      `gorm:"foreignKey:GameID"` // Keyed scenes and events
+	Plotlines   []Plotline     `gorm:"foreignKey:GameID"` // Plotlines List
+	Players     []Player       `gorm:"foreignKey:GameID"` // Players of a group game
 }
 
 // BeforeCreate is a GORM hook that generates a UUID for the game before creation.
@@ -112,6 +300,12 @@ func (g *Game) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// MinChaos and MaxChaos bound the chaos factor stored on a Game.
+const (
+	MinChaos = 1
+	MaxChaos = 9
+)
+
 // SetChaos sets the chaos factor for the game.
 // The chaos factor affects the likelihood of extreme results in dice rolls.
 // Valid range is 1-9.
@@ -119,6 +313,54 @@ func (g *Game) SetChaos(v int8) {
 	g.Chaos = v
 }
 
+// SaveChaos sets the chaos factor, clamped to MinChaos and MaxChaos, and
+// saves it as an operation that can be undone.
+func (g *Game) SaveChaos(db *gorm.DB, v int8) error {
+	old := g.Chaos
+	v = int8(max(min(int(v), MaxChaos), MinChaos))
+	desc := fmt.Sprintf("Set chaos factor %d -> %d", old, v)
+	return Record(db, g.ID, desc, func(tx *gorm.DB, rec *Recorder) error {
+		entry, err := NewLogEntry(g.ID, desc, &ChaosChangePayload{From: int(old), To: int(v)})
+		if err != nil {
+			return err
+		}
+		if err := rec.Update(g, map[string]any{"chaos": v}); err != nil {
+			return err
+		}
+		g.SetChaos(v)
+		return rec.AddLogEntry(entry)
+	})
+}
+
+// AdjustChaos changes the chaos factor by delta, keeping it within
+// MinChaos and MaxChaos. It returns the new chaos factor.
+func (g *Game) AdjustChaos(delta int) int8 {
+	g.SetChaos(int8(max(min(int(g.Chaos)+delta, MaxChaos), MinChaos)))
+	return g.Chaos
+}
+
+// NextTheme chooses the theme for the next plot point from the game's story
+// themes, alternating the 4th and 5th themes and recording the choice in
+// ThemeState. It implements theme.Chooser; save the game with SaveThemes to
+// keep the state.
+func (g *Game) NextTheme() theme.ThemeType {
+	return g.StoryThemes.Choose(&g.ThemeState)
+}
+
+// SaveThemes saves the game's story themes and theme selection state,
+// recording it in the game's history. It fails with ErrConflict if the game
+// changed since it was loaded.
+func (g *Game) SaveThemes(db *gorm.DB) error {
+	version := g.UpdatedAt
+	err := Record(db, g.ID, "Save story themes", func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Update(g, map[string]any{"story_themes": g.StoryThemes, "theme_state": g.ThemeState})
+	})
+	if err != nil {
+		g.UpdatedAt = version
+	}
+	return err
+}
+
 // GetGameLog loads the most recent n log entries from the database into the game's Log field.
 // The entries are ordered by creation date (newest first) and limited to n entries.
 //
@@ -144,4 +386,3 @@ func (g *Game) GetGameLog(db *gorm.DB, n int) error {
 
 	return nil
 }
-
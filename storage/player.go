@@ -0,0 +1,59 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListPlayers returns the game's players in the order they joined.
+func ListPlayers(db *gorm.DB, gameID uuid.UUID) ([]Player, error) {
+	var players []Player
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&players).Error; err != nil {
+		return nil, err
+	}
+	return players, nil
+}
+
+// AddPlayer adds a player to the game, recording it in the game's history.
+func AddPlayer(db *gorm.DB, gameID uuid.UUID, name string) (*Player, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("player name cannot be empty")
+	}
+	p := &Player{GameID: gameID, Name: name}
+	err := Record(db, gameID, "Add player "+name, func(tx *gorm.DB, rec *Recorder) error {
+		var n int64
+		if err := tx.Model(&Player{}).Where("game_id = ? AND name = ?", gameID, name).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("player %q already plays this game", name)
+		}
+		return rec.Create(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AssignPC makes the character a Player Character played by the player, who
+// must play the character's game, recording it in the game's history.
+func AssignPC(db *gorm.DB, c *Character, p *Player) error {
+	if c.GameID != p.GameID {
+		return fmt.Errorf("player %q does not play the game of %q", p.Name, c.Name)
+	}
+	desc := fmt.Sprintf("Make %s a player character of %s", c.Name, p.Name)
+	return Record(db, c.GameID, desc, func(tx *gorm.DB, rec *Recorder) error {
+		if err := rec.Update(c, map[string]any{"is_player": true, "player_id": p.ID}); err != nil {
+			return err
+		}
+		c.IsPlayer, c.PlayerID = true, &p.ID
+		return nil
+	})
+}
@@ -0,0 +1,121 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListPlotlines returns the game's active Plotlines List entries, including
+// "New Plotline" and "Choose Most Logical Plotline" slots, in list order.
+func ListPlotlines(db *gorm.DB, gameID uuid.UUID) ([]Plotline, error) {
+	var plotlines []Plotline
+	err := db.Where("game_id = ? AND status = ?", gameID, "active").Order("created_at").Find(&plotlines).Error
+	if err != nil {
+		return nil, err
+	}
+	return plotlines, nil
+}
+
+// ConcludePlotline marks a plotline as concluded, removing it from the
+// Plotlines List, and records it in the game's history.
+func ConcludePlotline(db *gorm.DB, plotlineID uuid.UUID) error {
+	var pl Plotline
+	if err := db.First(&pl, "id = ?", plotlineID).Error; err != nil {
+		return err
+	}
+	return Record(db, pl.GameID, "Conclude plotline "+pl.Name, func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Update(&pl, map[string]any{"status": "concluded"})
+	})
+}
+
+// SaveTurningPoint numbers and saves a turning point together with its plot
+// points, recording it in the game's history. Accepted "CONCLUSION" plot
+// points conclude the linked plotline.
+func SaveTurningPoint(db *gorm.DB, tp *TurningPoint) error {
+	return Record(db, tp.GameID, "Save turning point", func(tx *gorm.DB, rec *Recorder) error {
+		last, err := lastNumber(tx, &TurningPoint{}, tp.GameID)
+		if err != nil {
+			return err
+		}
+		tp.Number = last + 1
+		for i := range tp.PlotPoints {
+			tp.PlotPoints[i].Position = i + 1
+		}
+		if err := rec.Create(tp); err != nil {
+			return err
+		}
+		for i := range tp.PlotPoints {
+			if err := rec.Created(&tp.PlotPoints[i]); err != nil {
+				return err
+			}
+		}
+		for _, p := range tp.PlotPoints {
+			if err := concludeFor(tx, rec, tp, &p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListTurningPoints returns the game's turning points in order, with their plot points.
+func ListTurningPoints(db *gorm.DB, gameID uuid.UUID) ([]TurningPoint, error) {
+	var tps []TurningPoint
+	err := db.Where("game_id = ?", gameID).
+		Preload("PlotPoints", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Order("number").
+		Find(&tps).Error
+	if err != nil {
+		return nil, err
+	}
+	return tps, nil
+}
+
+// AcceptPlotPoint marks a plot point as accepted, recording it in the game's
+// history. Accepting a "CONCLUSION" plot point concludes the turning point's
+// plotline.
+func AcceptPlotPoint(db *gorm.DB, plotPointID uuid.UUID) error {
+	var p PlotPointEntry
+	if err := db.First(&p, "id = ?", plotPointID).Error; err != nil {
+		return err
+	}
+	var tp TurningPoint
+	if err := db.First(&tp, "id = ?", p.TurningPointID).Error; err != nil {
+		return err
+	}
+	desc := fmt.Sprintf("Accept plot point %s of turning point %d", p.Name, tp.Number)
+	return Record(db, tp.GameID, desc, func(tx *gorm.DB, rec *Recorder) error {
+		if err := rec.Update(&p, map[string]any{"accepted": true}); err != nil {
+			return err
+		}
+		p.Accepted = true
+		return concludeFor(tx, rec, &tp, &p)
+	})
+}
+
+// concludeFor concludes the turning point's plotline if p is an accepted
+// "CONCLUSION" plot point.
+func concludeFor(tx *gorm.DB, rec *Recorder, tp *TurningPoint, p *PlotPointEntry) error {
+	if !p.Accepted || p.None || p.Name != "CONCLUSION" || tp.PlotlineID == nil {
+		return nil
+	}
+	var pl Plotline
+	err := tx.Limit(1).Find(&pl, "id = ? AND status <> ?", *tp.PlotlineID, "concluded").Error
+	if err != nil || pl.ID == uuid.Nil {
+		return err
+	}
+	return rec.Update(&pl, map[string]any{"status": "concluded"})
+}
+
+// lastNumber returns the highest number given to the game's scenes or turning
+// points, model being a *Scene or *TurningPoint. Records in the trash and
+// records whose creation was undone are counted, so that their numbers are
+// not given out again and stay unique if they are restored or redone.
+func lastNumber(db *gorm.DB, model any, gameID uuid.UUID) (int, error) {
+	var last int
+	err := db.Model(model).Unscoped().Where("game_id = ?", gameID).Select("COALESCE(MAX(number), 0)").Scan(&last).Error
+	return last, err
+}
@@ -0,0 +1,274 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The types below freeze the schema each migration creates, so that a
+// migration always makes the same change however the models change later.
+// They hold only what the migration creates: columns, indexes, and the
+// relations foreign keys are made from. Never use them for data; use the
+// models instead.
+
+// Version 1 (create tables) creates the tables of the models as they were
+// when migrations were introduced.
+
+type v1Game struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	Name        string         `gorm:"uniqueIndex"`
+	Chaos       int8
+	StoryThemes string `gorm:"type:text"`
+	ThemeState  string `gorm:"type:text"`
+	PlotDataset string
+	Log         []v1LogEntry  `gorm:"foreignKey:GameID"`
+	Threads     []v1Thread    `gorm:"foreignKey:GameID"`
+	Characters  []v1Character `gorm:"foreignKey:GameID"`
+	Scenes      []v1Scene     `gorm:"foreignKey:GameID"`
+	Triggers    []v1Trigger   `gorm:"foreignKey:GameID"`
+	Plotlines   []v1Plotline  `gorm:"foreignKey:GameID"`
+}
+
+func (v1Game) TableName() string { return "games" }
+
+type v1LogEntry struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Type      int
+	Msg       string
+	GameID    uuid.UUID  `gorm:"type:uuid"`
+	SceneID   *uuid.UUID `gorm:"type:uuid;index"`
+}
+
+func (v1LogEntry) TableName() string { return "log_entries" }
+
+type v1Thread struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	GameID      uuid.UUID      `gorm:"type:uuid"`
+	Name        string
+	Description string
+	Weight      int    `gorm:"default:1"`
+	Status      string `gorm:"default:active"`
+}
+
+func (v1Thread) TableName() string { return "threads" }
+
+type v1Character struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	GameID      uuid.UUID      `gorm:"type:uuid"`
+	Name        string
+	Description string
+	Weight      int    `gorm:"default:1"`
+	Status      string `gorm:"default:active"`
+	Notes       string
+	IsPlayer    bool
+	CraftRolls  string `gorm:"type:text"`
+}
+
+func (v1Character) TableName() string { return "characters" }
+
+type v1Scene struct {
+	ID               uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	GameID           uuid.UUID      `gorm:"type:uuid"`
+	Number           int
+	Title            string
+	Summary          string
+	StartedAt        time.Time
+	EndedAt          *time.Time
+	Type             string
+	ExpectedConcept  string
+	ChaosDieRoll     int
+	Adjustments      string
+	AdjustmentDetail string
+	Event            string
+	Keyed            string
+	IsActive         bool `gorm:"default:true"`
+}
+
+func (v1Scene) TableName() string { return "scenes" }
+
+type v1Trigger struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	GameID     uuid.UUID      `gorm:"type:uuid"`
+	Name       string
+	Checkpoint string `gorm:"default:scene"`
+	Condition  string
+	Threshold  int
+	Value      string
+	ThreadID   *uuid.UUID `gorm:"type:uuid"`
+	Effect     string     `gorm:"default:override"`
+	Outcome    string
+	Repeatable bool
+	FiredAt    *time.Time
+	Active     bool `gorm:"default:true"`
+}
+
+func (v1Trigger) TableName() string { return "triggers" }
+
+type v1Plotline struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	GameID      uuid.UUID      `gorm:"type:uuid"`
+	Name        string
+	Description string
+	Kind        string `gorm:"default:plotline"`
+	Weight      int    `gorm:"default:1"`
+	Status      string `gorm:"default:active"`
+}
+
+func (v1Plotline) TableName() string { return "plotlines" }
+
+type v1TurningPoint struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	GameID     uuid.UUID      `gorm:"type:uuid"`
+	PlotlineID *uuid.UUID     `gorm:"type:uuid"`
+	SceneID    *uuid.UUID     `gorm:"type:uuid"`
+	Number     int
+	Plotline   string
+	Kind       string
+	PlotPoints []v1PlotPointEntry `gorm:"foreignKey:TurningPointID"`
+}
+
+func (v1TurningPoint) TableName() string { return "turning_points" }
+
+type v1PlotPointEntry struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	TurningPointID uuid.UUID      `gorm:"type:uuid"`
+	Position       int
+	Theme          string
+	Roll           int
+	Name           string
+	Description    string
+	MetaRoll       int
+	Meta           string
+	None           bool
+	Accepted       bool
+}
+
+func (v1PlotPointEntry) TableName() string { return "plot_point_entries" }
+
+// Version 3 (create operations) creates the operation journal.
+
+type v3Operation struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	GameID      uuid.UUID      `gorm:"type:uuid;index"`
+	Seq         int
+	Description string
+	Changes     string `gorm:"type:text"`
+	UndoneAt    *time.Time
+}
+
+func (v3Operation) TableName() string { return "operations" }
+
+// Version 5 (add game forks) adds the fork columns to games.
+
+type v5Game struct {
+	ForkOf    *uuid.UUID `gorm:"type:uuid;index"`
+	ForkPoint string
+	ForkedAt  *time.Time
+}
+
+func (v5Game) TableName() string { return "games" }
+
+// Version 6 (typed log entries) adds the payload column to log entries.
+
+type v6LogEntry struct {
+	Payload string `gorm:"type:text"`
+}
+
+func (v6LogEntry) TableName() string { return "log_entries" }
+
+// Version 7 (free names of deleted games) makes game names unique only among
+// games not in the trash.
+
+type v7Game struct {
+	Name string `gorm:"uniqueIndex:idx_games_name,where:deleted_at IS NULL"`
+}
+
+func (v7Game) TableName() string { return "games" }
+
+// Version 8 (add players) creates the players table and links Player
+// Characters to their players.
+
+type v8Game struct {
+	ID      uuid.UUID  `gorm:"type:uuid;primary_key;"`
+	Players []v8Player `gorm:"foreignKey:GameID"`
+}
+
+func (v8Game) TableName() string { return "games" }
+
+type v8Player struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	GameID    uuid.UUID      `gorm:"type:uuid"`
+	Name      string
+	Notes     string
+}
+
+func (v8Player) TableName() string { return "players" }
+
+type v8Character struct {
+	PlayerID *uuid.UUID `gorm:"type:uuid;index"`
+}
+
+func (v8Character) TableName() string { return "characters" }
+
+// Version 9 (unique scene and turning point numbers) makes the numbers of a
+// game's scenes and turning points unique, counting deleted ones, whose
+// numbers are not given out again.
+
+type v9Scene struct {
+	GameID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_scenes_number"`
+	Number int       `gorm:"uniqueIndex:idx_scenes_number"`
+}
+
+func (v9Scene) TableName() string { return "scenes" }
+
+type v9TurningPoint struct {
+	GameID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_turning_points_number"`
+	Number int       `gorm:"uniqueIndex:idx_turning_points_number"`
+}
+
+func (v9TurningPoint) TableName() string { return "turning_points" }
+
+// Version 10 (one active scene per game) allows a game a single active scene
+// that is not deleted.
+
+type v10Scene struct {
+	GameID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_scenes_active,where:is_active AND deleted_at IS NULL"`
+}
+
+func (v10Scene) TableName() string { return "scenes" }
@@ -0,0 +1,193 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Search result kinds stored in SearchResult.Kind.
+const (
+	SearchLog       = "log"       // A log entry's message
+	SearchThread    = "thread"    // A thread's name and description
+	SearchCharacter = "character" // A character's name, description and notes
+	SearchScene     = "scene"     // A scene's title, expected concept and summary
+)
+
+// ErrSearchUnavailable is returned when SQLite was built without FTS5, which
+// the search index needs.
+var ErrSearchUnavailable = errors.New("search index needs SQLite FTS5; build with -tags sqlite_fts5")
+
+// DefaultSearchLimit is the number of results returned when SearchOptions.Limit is 0.
+const DefaultSearchLimit = 20
+
+// SearchOptions filters a search. Zero values do not filter.
+type SearchOptions struct {
+	Kinds    []string   // Only these kinds of results, e.g. SearchLog
+	LogTypes []LogKind  // Only log entries of these kinds; other kinds are not affected
+	SceneID  *uuid.UUID // Only log entries of this scene, and the scene itself
+	From, To time.Time  // Only records created within this time range
+	Limit    int
+}
+
+// SearchResult is a record matching a search, best matches first.
+type SearchResult struct {
+	Kind      string
+	RecordID  uuid.UUID
+	SceneID   *uuid.UUID
+	LogType   LogKind // For log entries
+	CreatedAt time.Time
+	Title     string  // Name or title; empty for log entries
+	Snippet   string  // Matching text with the matched terms in [brackets]
+	Score     float64 // Relevance, higher is better
+}
+
+// searchSource describes how the rows of a table are indexed. Expressions
+// refer to the row as NEW.
+type searchSource struct {
+	table, kind, title, body, scene, logType string
+}
+
+var searchSources = []searchSource{
+	{"log_entries", SearchLog, "''", "NEW.msg", "NEW.scene_id", "NEW.type"},
+	{"threads", SearchThread, "NEW.name", "COALESCE(NEW.description, '')", "NULL", "0"},
+	{"characters", SearchCharacter, "NEW.name", "COALESCE(NEW.description, '') || ' ' || COALESCE(NEW.notes, '')", "NULL", "0"},
+	{"scenes", SearchScene, "NEW.title", "COALESCE(NEW.expected_concept, '') || ' ' || COALESCE(NEW.summary, '')", "NEW.id", "0"},
+}
+
+// createSearchIndex creates the FTS5 full-text index and the triggers that
+// keep it up to date, and indexes the existing rows.
+func createSearchIndex(tx *gorm.DB) error {
+	stmts := []string{
+		`CREATE TABLE search_docs (
+			rowid INTEGER PRIMARY KEY,
+			kind TEXT NOT NULL,
+			record_id TEXT NOT NULL,
+			game_id TEXT NOT NULL,
+			scene_id TEXT,
+			log_type INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME
+		)`,
+		`CREATE UNIQUE INDEX idx_search_docs_record ON search_docs (kind, record_id)`,
+		`CREATE INDEX idx_search_docs_game ON search_docs (game_id)`,
+	}
+	for _, s := range stmts {
+		if err := tx.Exec(s).Error; err != nil {
+			return err
+		}
+	}
+	err := tx.Exec(`CREATE VIRTUAL TABLE search_fts USING fts5(title, body, tokenize = 'porter unicode61')`).Error
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return ErrSearchUnavailable
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, src := range searchSources {
+		insert := fmt.Sprintf(`
+			INSERT INTO search_docs (kind, record_id, game_id, scene_id, log_type, created_at)
+				SELECT '%[1]s', NEW.id, NEW.game_id, %[2]s, %[3]s, NEW.created_at WHERE NEW.deleted_at IS NULL;
+			INSERT INTO search_fts (rowid, title, body)
+				SELECT rowid, %[4]s, %[5]s FROM search_docs WHERE kind = '%[1]s' AND record_id = NEW.id;`,
+			src.kind, src.scene, src.logType, src.title, src.body)
+		remove := fmt.Sprintf(`
+			DELETE FROM search_fts WHERE rowid IN (SELECT rowid FROM search_docs WHERE kind = '%[1]s' AND record_id = OLD.id);
+			DELETE FROM search_docs WHERE kind = '%[1]s' AND record_id = OLD.id;`, src.kind)
+
+		triggers := []string{
+			fmt.Sprintf(`CREATE TRIGGER search_%s_insert AFTER INSERT ON %s BEGIN %s END`, src.table, src.table, insert),
+			fmt.Sprintf(`CREATE TRIGGER search_%s_update AFTER UPDATE ON %s BEGIN %s %s END`, src.table, src.table, remove, insert),
+			fmt.Sprintf(`CREATE TRIGGER search_%s_delete AFTER DELETE ON %s BEGIN %s END`, src.table, src.table, remove),
+		}
+		for _, t := range triggers {
+			if err := tx.Exec(t).Error; err != nil {
+				return err
+			}
+		}
+
+		// Index existing rows by running them through the update trigger.
+		if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET id = id`, src.table)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSearchIndex reports ErrSearchUnavailable if the search index cannot be
+// used by this build.
+func checkSearchIndex(db *gorm.DB) error {
+	err := db.Exec(`SELECT rowid FROM search_fts LIMIT 0`).Error
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return ErrSearchUnavailable
+	}
+	return err
+}
+
+// Search finds the game's log entries, threads, characters and scenes
+// matching query, best matches first. Every word of query must match; words
+// match other forms of the same word ("smugglers" finds "smuggler"), and a
+// word ending in * matches as a prefix.
+func Search(db *gorm.DB, gameID uuid.UUID, query string, opts SearchOptions) ([]SearchResult, error) {
+	match := matchQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	// bm25 ranks lower as better, so negate it for the score.
+	q := db.Table("search_fts").
+		Select("d.kind, d.record_id, d.scene_id, d.log_type, d.created_at, search_fts.title, "+
+			"snippet(search_fts, -1, '[', ']', '…', 12) AS snippet, -bm25(search_fts) AS score").
+		Joins("JOIN search_docs d ON d.rowid = search_fts.rowid").
+		Where("search_fts MATCH ? AND d.game_id = ?", match, gameID)
+	if len(opts.Kinds) > 0 {
+		q = q.Where("d.kind IN ?", opts.Kinds)
+	}
+	if len(opts.LogTypes) > 0 {
+		q = q.Where("(d.kind <> ? OR d.log_type IN ?)", SearchLog, opts.LogTypes)
+	}
+	if opts.SceneID != nil {
+		q = q.Where("d.scene_id = ?", *opts.SceneID)
+	}
+	if !opts.From.IsZero() {
+		q = q.Where("d.created_at >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		q = q.Where("d.created_at <= ?", opts.To)
+	}
+
+	var results []SearchResult
+	if err := q.Order("score DESC").Limit(limit).Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// matchQuery turns user input into a full-text query that matches every word,
+// quoting each one so punctuation cannot break the query syntax.
+func matchQuery(query string) string {
+	var terms []string
+	for _, w := range strings.Fields(query) {
+		prefix := strings.HasSuffix(w, "*")
+		w = strings.ReplaceAll(strings.Trim(w, `"*`), `"`, "")
+		if !strings.ContainsFunc(w, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			continue
+		}
+		if prefix {
+			terms = append(terms, `"`+w+`"*`)
+		} else {
+			terms = append(terms, `"`+w+`"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Harbor"}
+	other := &Game{Name: "Elsewhere"}
+	db.Create(g)
+	db.Create(other)
+	sc := &Scene{GameID: g.ID, Number: 1, Title: "Night market", ExpectedConcept: "Meet the smuggler at the docks"}
+	db.Create(sc)
+	early := time.Now().Add(-48 * time.Hour)
+	db.Create(&LogEntry{GameID: g.ID, Msg: "A smuggler waves from a boat", CreatedAt: early})
+	twice := &LogEntry{GameID: g.ID, SceneID: &sc.ID, Msg: "The smuggler sells us a map; the smuggler grins"}
+	db.Create(twice)
+	db.Create(&LogEntry{GameID: g.ID, SceneID: &sc.ID, Type: LogFateQuestion, Msg: "likely - 20: Yes, the smuggler is armed"})
+	db.Create(&Thread{GameID: g.ID, Name: "Pay the smugglers", Description: "We owe them"})
+	db.Create(&Character{GameID: g.ID, Name: "Ysolde", Notes: "Former smuggler"})
+	db.Create(&LogEntry{GameID: other.ID, Msg: "Another smuggler"})
+
+	results, err := Search(db, g.ID, "smugglers", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("got %d results, want 6: %+v", len(results), results)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Fatalf("results not ordered by score: %+v", results)
+		}
+	}
+
+	logs, err := Search(db, g.ID, "smuggler", SearchOptions{Kinds: []string{SearchLog}})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(logs) != 3 || logs[0].RecordID != twice.ID {
+		t.Fatalf("best match = %+v, want the entry mentioning the smuggler twice", logs[0])
+	}
+	if !strings.Contains(logs[0].Snippet, "[smuggler]") {
+		t.Fatalf("snippet = %q", logs[0].Snippet)
+	}
+	kinds := map[string]int{}
+	for _, r := range results {
+		kinds[r.Kind]++
+	}
+	if kinds[SearchLog] != 3 || kinds[SearchThread] != 1 || kinds[SearchCharacter] != 1 || kinds[SearchScene] != 1 {
+		t.Fatalf("kinds = %v", kinds)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		opts  SearchOptions
+		want  int
+	}{
+		{"kind", "smuggler", SearchOptions{Kinds: []string{SearchThread, SearchCharacter}}, 2},
+		{"log type", "smuggler", SearchOptions{Kinds: []string{SearchLog}, LogTypes: []LogKind{LogFateQuestion}}, 1},
+		{"scene", "smuggler", SearchOptions{SceneID: &sc.ID}, 3},
+		{"date", "smuggler", SearchOptions{Kinds: []string{SearchLog}, To: time.Now().Add(-24 * time.Hour)}, 1},
+		{"every word", "smuggler map", SearchOptions{}, 1},
+		{"prefix", "smug*", SearchOptions{Limit: 2}, 2},
+		{"punctuation", `smuggler" ( -`, SearchOptions{}, 6},
+		{"no match", "dragon", SearchOptions{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Search(db, g.ID, tt.query, tt.opts)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if len(results) != tt.want {
+				t.Fatalf("got %d results, want %d: %+v", len(results), tt.want, results)
+			}
+		})
+	}
+
+	// The index follows updates and soft deletes.
+	db.Model(twice).Update("msg", "The fence sells us a map")
+	db.Delete(&Thread{}, "game_id = ?", g.ID)
+	if results, _ := Search(db, g.ID, "smuggler", SearchOptions{}); len(results) != 4 {
+		t.Fatalf("after update and delete got %d results, want 4", len(results))
+	}
+	if results, _ := Search(db, g.ID, "fence", SearchOptions{}); len(results) != 1 {
+		t.Fatalf("updated entry not found")
+	}
+}
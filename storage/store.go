@@ -0,0 +1,85 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist or has been deleted.
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicateName is returned when creating or renaming a game to a name already in use.
+	ErrDuplicateName = errors.New("game name already in use")
+	// ErrConflict is returned when saving a game that was changed by someone
+	// else since it was loaded. Load the game again and reapply the change.
+	ErrConflict = errors.New("game was changed since it was loaded")
+)
+
+// GameStore stores games. Associations such as Log or Threads are not
+// saved or loaded by the store; use the dedicated stores for them.
+type GameStore interface {
+	CreateGame(ctx context.Context, g *Game) error
+	GetGame(ctx context.Context, id uuid.UUID) (*Game, error)
+	GetGameByName(ctx context.Context, name string) (*Game, error)
+	ListGames(ctx context.Context) ([]Game, error)      // Ordered by name
+	UpdateGame(ctx context.Context, g *Game) error      // Fails with ErrConflict if the game changed since g was loaded
+	DeleteGame(ctx context.Context, id uuid.UUID) error // Also deletes the game's records, see TrashGame
+}
+
+// ThreadStore stores the Threads List of games.
+type ThreadStore interface {
+	CreateThread(ctx context.Context, t *Thread) error
+	GetThread(ctx context.Context, id uuid.UUID) (*Thread, error)
+	ListThreads(ctx context.Context, gameID uuid.UUID) ([]Thread, error) // Ordered by creation
+	UpdateThread(ctx context.Context, t *Thread) error
+	DeleteThread(ctx context.Context, id uuid.UUID) error
+}
+
+// CharacterStore stores the Characters List of games.
+type CharacterStore interface {
+	CreateCharacter(ctx context.Context, c *Character) error
+	GetCharacter(ctx context.Context, id uuid.UUID) (*Character, error)
+	ListCharacters(ctx context.Context, gameID uuid.UUID) ([]Character, error) // Ordered by creation
+	UpdateCharacter(ctx context.Context, c *Character) error
+	DeleteCharacter(ctx context.Context, id uuid.UUID) error
+}
+
+// PlayerStore stores the players of group games.
+type PlayerStore interface {
+	CreatePlayer(ctx context.Context, p *Player) error
+	GetPlayer(ctx context.Context, id uuid.UUID) (*Player, error)
+	ListPlayers(ctx context.Context, gameID uuid.UUID) ([]Player, error) // Ordered by creation
+	UpdatePlayer(ctx context.Context, p *Player) error
+	DeletePlayer(ctx context.Context, id uuid.UUID) error
+}
+
+// SceneStore stores the scenes of games.
+type SceneStore interface {
+	CreateScene(ctx context.Context, s *Scene) error
+	GetScene(ctx context.Context, id uuid.UUID) (*Scene, error)
+	ListScenes(ctx context.Context, gameID uuid.UUID) ([]Scene, error) // Ordered by number
+	ActiveScene(ctx context.Context, gameID uuid.UUID) (*Scene, error)
+	UpdateScene(ctx context.Context, s *Scene) error
+	DeleteScene(ctx context.Context, id uuid.UUID) error
+}
+
+// LogStore stores the log entries of games.
+type LogStore interface {
+	AddLogEntry(ctx context.Context, l *LogEntry) error
+	ListLog(ctx context.Context, gameID uuid.UUID, n int) ([]LogEntry, error) // The n newest entries, newest first
+	ListSceneLog(ctx context.Context, sceneID uuid.UUID) ([]LogEntry, error)  // Oldest first
+	DeleteLogEntry(ctx context.Context, id uuid.UUID) error
+}
+
+// Store combines the stores for all game data.
+type Store interface {
+	GameStore
+	ThreadStore
+	CharacterStore
+	PlayerStore
+	SceneStore
+	LogStore
+}
@@ -0,0 +1,145 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"github.com/DMXMax/mge/util/theme"
+)
+
+func TestGormStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewGormStore(storetest.NewDB(t))
+	})
+}
+
+func TestGormStorePureGo(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.OpenStore("sqlite-pure:" + filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("OpenStore: %v", err)
+		}
+		return s
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	for _, format := range []string{storage.BackendJSON, storage.BackendYAML} {
+		t.Run(format, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) storage.Store {
+				s, err := storage.OpenStore(format + ":" + t.TempDir())
+				if err != nil {
+					t.Fatalf("OpenStore: %v", err)
+				}
+				return s
+			})
+		})
+	}
+}
+
+func TestStoresKeepScenes(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		storetest.RunReopen(t, func(t *testing.T, dir string) storage.Store {
+			s, err := storage.OpenStore(filepath.Join(dir, "test.db"))
+			if err != nil {
+				t.Fatalf("OpenStore: %v", err)
+			}
+			return s
+		})
+	})
+	for _, format := range []string{storage.BackendJSON, storage.BackendYAML} {
+		t.Run(format, func(t *testing.T) {
+			storetest.RunReopen(t, func(t *testing.T, dir string) storage.Store {
+				s, err := storage.OpenStore(format + ":" + dir)
+				if err != nil {
+					t.Fatalf("OpenStore: %v", err)
+				}
+				return s
+			})
+		})
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := storage.NewFileStore(dir, storage.BackendYAML)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	g := &storage.Game{Name: "Kept", Chaos: 4, StoryThemes: theme.GetThemes()}
+	s.CreateGame(ctx, g)
+	gone := &storage.Game{Name: "Gone"}
+	s.CreateGame(ctx, gone)
+	s.DeleteGame(ctx, gone.ID)
+	th := &storage.Thread{GameID: g.ID, Name: "Find the map"}
+	s.CreateThread(ctx, th)
+	sc := &storage.Scene{GameID: g.ID, Number: 1}
+	s.CreateScene(ctx, sc)
+	entry, _ := storage.NewLogEntry(g.ID, "Chaos 4 -> 5", &storage.ChaosChangePayload{From: 4, To: 5})
+	s.AddLogEntry(ctx, entry)
+
+	b, err := os.ReadFile(filepath.Join(dir, g.ID.String()+".yaml"))
+	if err != nil {
+		t.Fatalf("game file: %v", err)
+	}
+	if !strings.Contains(string(b), "Name: Kept") || !strings.Contains(string(b), "Name: Find the map") {
+		t.Fatalf("game file:\n%s", b)
+	}
+
+	s, err = storage.NewFileStore(dir, storage.BackendYAML)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	got, err := s.GetGameByName(ctx, "Kept")
+	if err != nil || got.ID != g.ID || got.StoryThemes != g.StoryThemes || got.Chaos != 4 {
+		t.Fatalf("GetGameByName = %+v, %v", got, err)
+	}
+	if err := s.CreateGame(ctx, &storage.Game{Name: "Kept"}); !errors.Is(err, storage.ErrDuplicateName) {
+		t.Fatalf("duplicate CreateGame error = %v, want ErrDuplicateName", err)
+	}
+	if _, err := s.GetGame(ctx, gone.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetGame of deleted game error = %v, want ErrNotFound", err)
+	}
+	if active, err := s.ActiveScene(ctx, g.ID); err != nil || active.ID != sc.ID {
+		t.Fatalf("ActiveScene = %+v, %v", active, err)
+	}
+	log, err := s.ListSceneLog(ctx, sc.ID)
+	if err != nil || len(log) != 1 || log[0].Type != storage.LogChaosChange {
+		t.Fatalf("ListSceneLog = %+v, %v", log, err)
+	}
+	if p, err := log[0].DecodePayload(); err != nil || p.(*storage.ChaosChangePayload).To != 5 {
+		t.Fatalf("DecodePayload = %+v, %v", p, err)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct{ dsn, backend, path string }{
+		{"mge.db", storage.BackendSQLite, "mge.db"},
+		{"sqlite:games/mge.db", storage.BackendSQLite, "games/mge.db"},
+		{"sqlite-pure:mge.db", storage.BackendSQLitePure, "mge.db"},
+		{"yaml:campaign", storage.BackendYAML, "campaign"},
+		{"file:mge.db?cache=shared", storage.BackendSQLite, "file:mge.db?cache=shared"},
+		{":memory:", storage.BackendSQLite, ":memory:"},
+	}
+	for _, tt := range tests {
+		if backend, path := storage.ParseDSN(tt.dsn); backend != tt.backend || path != tt.path {
+			t.Errorf("ParseDSN(%q) = %q, %q; want %q, %q", tt.dsn, backend, path, tt.backend, tt.path)
+		}
+	}
+	if _, err := storage.InitDatabase("json:" + t.TempDir()); !errors.Is(err, storage.ErrNotSQL) {
+		t.Errorf("InitDatabase of a file backend error = %v, want ErrNotSQL", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewMemoryStore()
+	})
+}
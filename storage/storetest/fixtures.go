@@ -0,0 +1,56 @@
+package storetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NewDB returns a migrated SQLite database in a temporary directory.
+func NewDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := storage.InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	return db
+}
+
+// NewGame returns a new database holding a single game with the given name
+// and chaos factor.
+func NewGame(t *testing.T, name string, chaos int8) (*gorm.DB, *storage.Game) {
+	t.Helper()
+	db := NewDB(t)
+	g := &storage.Game{Name: name, Chaos: chaos}
+	if err := db.Create(g).Error; err != nil {
+		t.Fatalf("create game: %v", err)
+	}
+	return db, g
+}
+
+// AddCharacters adds the characters to the game and returns them with their IDs.
+func AddCharacters(t *testing.T, db *gorm.DB, gameID uuid.UUID, characters ...storage.Character) []storage.Character {
+	t.Helper()
+	for i := range characters {
+		characters[i].GameID = gameID
+		if err := db.Create(&characters[i]).Error; err != nil {
+			t.Fatalf("create character %s: %v", characters[i].Name, err)
+		}
+	}
+	return characters
+}
+
+// AddThreads adds the threads to the game and returns them with their IDs.
+func AddThreads(t *testing.T, db *gorm.DB, gameID uuid.UUID, threads ...storage.Thread) []storage.Thread {
+	t.Helper()
+	for i := range threads {
+		threads[i].GameID = gameID
+		if err := db.Create(&threads[i]).Error; err != nil {
+			t.Fatalf("create thread %s: %v", threads[i].Name, err)
+		}
+	}
+	return threads
+}
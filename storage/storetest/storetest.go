@@ -0,0 +1,471 @@
+// Package storetest provides a conformance test suite for storage.Store
+// implementations and fixtures for tests that need a game in a database.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util/theme"
+	"github.com/google/uuid"
+)
+
+// Run runs the conformance suite. newStore must return an empty store for each call.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, storage.Store)
+	}{
+		{"Games", testGames},
+		{"Threads", testThreads},
+		{"Characters", testCharacters},
+		{"Players", testPlayers},
+		{"Scenes", testScenes},
+		{"SceneLifecycle", testSceneLifecycle},
+		{"Log", testLog},
+		{"Models", testModels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { tt.fn(t, newStore(t)) })
+	}
+}
+
+func newGame(t *testing.T, s storage.Store, name string) *storage.Game {
+	t.Helper()
+	g := &storage.Game{Name: name, Chaos: 5, StoryThemes: theme.GetThemes()}
+	if err := s.CreateGame(context.Background(), g); err != nil {
+		t.Fatalf("CreateGame(%q): %v", name, err)
+	}
+	return g
+}
+
+func testGames(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	g := newGame(t, s, "Zeta")
+	newGame(t, s, "Alpha")
+	if g.ID == uuid.Nil || g.CreatedAt.IsZero() {
+		t.Fatalf("CreateGame did not set ID and timestamps: %+v", g)
+	}
+
+	got, err := s.GetGame(ctx, g.ID)
+	if err != nil {
+		t.Fatalf("GetGame: %v", err)
+	}
+	if got.Name != "Zeta" || got.Chaos != 5 || got.StoryThemes != g.StoryThemes {
+		t.Fatalf("GetGame = %+v, want %+v", got, g)
+	}
+	if got, err := s.GetGameByName(ctx, "Zeta"); err != nil || got.ID != g.ID {
+		t.Fatalf("GetGameByName = %v, %v", got, err)
+	}
+	if _, err := s.GetGame(ctx, uuid.New()); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetGame(unknown) error = %v, want ErrNotFound", err)
+	}
+	if err := s.CreateGame(ctx, &storage.Game{Name: "Zeta"}); !errors.Is(err, storage.ErrDuplicateName) {
+		t.Fatalf("duplicate CreateGame error = %v, want ErrDuplicateName", err)
+	}
+
+	games, err := s.ListGames(ctx)
+	if err != nil {
+		t.Fatalf("ListGames: %v", err)
+	}
+	if len(games) != 2 || games[0].Name != "Alpha" || games[1].Name != "Zeta" {
+		t.Fatalf("ListGames = %+v", games)
+	}
+
+	got.Chaos = 7
+	got.ThemeState.NextAlternate = 1
+	if err := s.UpdateGame(ctx, got); err != nil {
+		t.Fatalf("UpdateGame: %v", err)
+	}
+	if got, _ := s.GetGame(ctx, g.ID); got.Chaos != 7 || got.ThemeState.NextAlternate != 1 {
+		t.Fatalf("UpdateGame not saved: %+v", got)
+	}
+	got.Name = "Alpha"
+	if err := s.UpdateGame(ctx, got); !errors.Is(err, storage.ErrDuplicateName) {
+		t.Fatalf("rename to existing name error = %v, want ErrDuplicateName", err)
+	}
+
+	// Saving a game that changed since it was loaded is a conflict.
+	stale, _ := s.GetGame(ctx, g.ID)
+	got.Name, got.Chaos = "Zeta", 8
+	if err := s.UpdateGame(ctx, got); err != nil {
+		t.Fatalf("UpdateGame after a failed update: %v", err)
+	}
+	if err := s.UpdateGame(ctx, got); err != nil {
+		t.Fatalf("second UpdateGame: %v", err)
+	}
+	stale.Chaos = 3
+	if err := s.UpdateGame(ctx, stale); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("UpdateGame of a stale game error = %v, want ErrConflict", err)
+	}
+
+	th := &storage.Thread{GameID: g.ID, Name: "Left behind"}
+	s.CreateThread(ctx, th)
+	if err := s.DeleteGame(ctx, g.ID); err != nil {
+		t.Fatalf("DeleteGame: %v", err)
+	}
+	if _, err := s.GetThread(ctx, th.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetThread of deleted game's thread error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetGame(ctx, g.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetGame after delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteGame(ctx, g.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("second DeleteGame error = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateGame(ctx, &storage.Game{ID: g.ID, Name: "Zeta"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("UpdateGame after delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.CreateGame(ctx, &storage.Game{Name: "Zeta"}); err != nil {
+		t.Fatalf("CreateGame with a deleted game's name: %v", err)
+	}
+}
+
+func testThreads(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	g := newGame(t, s, "Threads")
+	other := newGame(t, s, "Other")
+
+	first := &storage.Thread{GameID: g.ID, Name: "Find the relic"}
+	if err := s.CreateThread(ctx, first); err != nil {
+		t.Fatalf("CreateThread: %v", err)
+	}
+	if first.Weight != 1 || first.Status != "active" {
+		t.Fatalf("defaults not applied: %+v", first)
+	}
+	second := &storage.Thread{GameID: g.ID, Name: "Escape", Weight: 2, Status: "paused"}
+	s.CreateThread(ctx, second)
+	s.CreateThread(ctx, &storage.Thread{GameID: other.ID, Name: "Elsewhere"})
+
+	threads, err := s.ListThreads(ctx, g.ID)
+	if err != nil {
+		t.Fatalf("ListThreads: %v", err)
+	}
+	if len(threads) != 2 || threads[0].ID != first.ID || threads[1].Status != "paused" {
+		t.Fatalf("ListThreads = %+v", threads)
+	}
+
+	second.Status = "resolved"
+	if err := s.UpdateThread(ctx, second); err != nil {
+		t.Fatalf("UpdateThread: %v", err)
+	}
+	if got, err := s.GetThread(ctx, second.ID); err != nil || got.Status != "resolved" || got.Weight != 2 {
+		t.Fatalf("GetThread = %+v, %v", got, err)
+	}
+	if err := s.DeleteThread(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteThread: %v", err)
+	}
+	if threads, _ := s.ListThreads(ctx, g.ID); len(threads) != 1 {
+		t.Fatalf("deleted thread still listed: %+v", threads)
+	}
+	if err := s.UpdateThread(ctx, first); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("UpdateThread after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testCharacters(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	g := newGame(t, s, "Characters")
+
+	c := &storage.Character{GameID: g.ID, Name: "Mara", IsPlayer: true, Notes: "Pilot"}
+	if err := s.CreateCharacter(ctx, c); err != nil {
+		t.Fatalf("CreateCharacter: %v", err)
+	}
+	if c.Weight != 1 || c.Status != "active" {
+		t.Fatalf("defaults not applied: %+v", c)
+	}
+	c.Weight = 4
+	if err := s.UpdateCharacter(ctx, c); err != nil {
+		t.Fatalf("UpdateCharacter: %v", err)
+	}
+	got, err := s.GetCharacter(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("GetCharacter: %v", err)
+	}
+	if got.Weight != 4 || !got.IsPlayer || got.Notes != "Pilot" {
+		t.Fatalf("GetCharacter = %+v", got)
+	}
+	if list, _ := s.ListCharacters(ctx, g.ID); len(list) != 1 {
+		t.Fatalf("ListCharacters = %+v", list)
+	}
+	if err := s.DeleteCharacter(ctx, c.ID); err != nil {
+		t.Fatalf("DeleteCharacter: %v", err)
+	}
+	if _, err := s.GetCharacter(ctx, c.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetCharacter after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testPlayers(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	g := newGame(t, s, "Players")
+
+	p := &storage.Player{GameID: g.ID, Name: "Ana"}
+	if err := s.CreatePlayer(ctx, p); err != nil {
+		t.Fatalf("CreatePlayer: %v", err)
+	}
+	c := &storage.Character{GameID: g.ID, Name: "Mara", IsPlayer: true, PlayerID: &p.ID}
+	if err := s.CreateCharacter(ctx, c); err != nil {
+		t.Fatalf("CreateCharacter: %v", err)
+	}
+	if got, err := s.GetCharacter(ctx, c.ID); err != nil || got.PlayerID == nil || *got.PlayerID != p.ID {
+		t.Fatalf("GetCharacter = %+v, %v, want player %s", got, err, p.ID)
+	}
+	p.Notes = "Runs the ship"
+	if err := s.UpdatePlayer(ctx, p); err != nil {
+		t.Fatalf("UpdatePlayer: %v", err)
+	}
+	got, err := s.GetPlayer(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetPlayer: %v", err)
+	}
+	if got.Name != "Ana" || got.Notes != "Runs the ship" {
+		t.Fatalf("GetPlayer = %+v", got)
+	}
+	if list, _ := s.ListPlayers(ctx, g.ID); len(list) != 1 {
+		t.Fatalf("ListPlayers = %+v", list)
+	}
+	if err := s.DeletePlayer(ctx, p.ID); err != nil {
+		t.Fatalf("DeletePlayer: %v", err)
+	}
+	if _, err := s.GetPlayer(ctx, p.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetPlayer after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func testScenes(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	g := newGame(t, s, "Scenes")
+
+	if _, err := s.ActiveScene(ctx, g.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ActiveScene without scenes error = %v, want ErrNotFound", err)
+	}
+	second := &storage.Scene{GameID: g.ID, Number: 2, Title: "Second"}
+	first := &storage.Scene{GameID: g.ID, Number: 1, Title: "First"}
+	if err := s.CreateScene(ctx, second); err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+	if !second.IsActive {
+		t.Fatalf("scenes default to active: %+v", second)
+	}
+
+	second.IsActive = false
+	second.Summary = "Done"
+	if err := s.UpdateScene(ctx, second); err != nil {
+		t.Fatalf("UpdateScene: %v", err)
+	}
+	if err := s.CreateScene(ctx, first); err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+	active, err := s.ActiveScene(ctx, g.ID)
+	if err != nil || active.ID != first.ID {
+		t.Fatalf("ActiveScene = %+v, %v", active, err)
+	}
+	scenes, err := s.ListScenes(ctx, g.ID)
+	if err != nil {
+		t.Fatalf("ListScenes: %v", err)
+	}
+	if len(scenes) != 2 || scenes[0].Title != "First" || scenes[1].Title != "Second" || scenes[1].Summary != "Done" {
+		t.Fatalf("ListScenes = %+v", scenes)
+	}
+	if err := s.DeleteScene(ctx, second.ID); err != nil {
+		t.Fatalf("DeleteScene: %v", err)
+	}
+	if _, err := s.GetScene(ctx, second.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetScene after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+// testSceneLifecycle plays two scenes the way scene.Manager does: the log
+// entries of a scene are linked to it while it is active, and an ended scene
+// keeps its end time and summary.
+func testSceneLifecycle(t *testing.T, s storage.Store) {
+	g, first, second := playScenes(t, s)
+	checkScenes(t, s, g, first, second)
+}
+
+// RunReopen checks that a store keeps the scenes and log of a game when it is
+// opened again. open must open the store kept in dir, creating it if dir is
+// empty.
+func RunReopen(t *testing.T, open func(t *testing.T, dir string) storage.Store) {
+	dir := t.TempDir()
+	g, first, second := playScenes(t, open(t, dir))
+	checkScenes(t, open(t, dir), g, first, second)
+}
+
+// playScenes creates a game and plays a scene that ends and a second one
+// that is still going, logging before, during and after each.
+func playScenes(t *testing.T, s storage.Store) (g *storage.Game, first, second *storage.Scene) {
+	t.Helper()
+	ctx := context.Background()
+	g = newGame(t, s, "Lifecycle")
+	add := func(msg string, p storage.LogPayload, scene *storage.Scene) {
+		t.Helper()
+		entry, err := storage.NewLogEntry(g.ID, msg, p)
+		if err != nil {
+			t.Fatalf("NewLogEntry: %v", err)
+		}
+		if scene != nil {
+			entry.SceneID = &scene.ID
+		}
+		if err := s.AddLogEntry(ctx, entry); err != nil {
+			t.Fatalf("AddLogEntry(%q): %v", msg, err)
+		}
+	}
+
+	add("Prologue", &storage.NarrationPayload{Text: "Prologue"}, nil)
+	first = &storage.Scene{GameID: g.ID, Number: 1, Title: "Docks", StartedAt: time.Now(), IsActive: true}
+	if err := s.CreateScene(ctx, first); err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+	add("Scene 1: Docks", &storage.SceneStartPayload{Number: 1, Concept: "Docks", Type: "expected", ChaosDie: 7, Chaos: 5}, nil)
+	add("Is the guard asleep?", &storage.NotePayload{Text: "Is the guard asleep?"}, nil)
+
+	ended := time.Now()
+	first.IsActive, first.EndedAt, first.Summary = false, &ended, "Slipped past the guard"
+	if err := s.UpdateScene(ctx, first); err != nil {
+		t.Fatalf("UpdateScene: %v", err)
+	}
+	add("Scene 1 ended", &storage.SceneEndPayload{Number: 1, Summary: first.Summary, PCsInControl: true, ChaosFrom: 5, ChaosTo: 4}, first)
+	if _, err := s.ActiveScene(ctx, g.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("ActiveScene after the scene ended error = %v, want ErrNotFound", err)
+	}
+	add("Between scenes", &storage.NarrationPayload{Text: "Between scenes"}, nil)
+
+	second = &storage.Scene{GameID: g.ID, Number: 2, Title: "Warehouse", StartedAt: time.Now(), IsActive: true}
+	if err := s.CreateScene(ctx, second); err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+	add("Scene 2: Warehouse", &storage.SceneStartPayload{Number: 2, Concept: "Warehouse", Type: "expected", ChaosDie: 3, Chaos: 4}, nil)
+	return g, first, second
+}
+
+// checkScenes checks the scenes and log written by playScenes.
+func checkScenes(t *testing.T, s storage.Store, g *storage.Game, first, second *storage.Scene) {
+	t.Helper()
+	ctx := context.Background()
+	scenes, err := s.ListScenes(ctx, g.ID)
+	if err != nil {
+		t.Fatalf("ListScenes: %v", err)
+	}
+	if len(scenes) != 2 || scenes[0].ID != first.ID || scenes[1].ID != second.ID {
+		t.Fatalf("ListScenes = %+v", scenes)
+	}
+	got := scenes[0]
+	if got.IsActive || got.EndedAt == nil || !got.EndedAt.Equal(*first.EndedAt) || got.Summary != first.Summary {
+		t.Fatalf("ended scene = %+v, want %+v", got, first)
+	}
+	if active, err := s.ActiveScene(ctx, g.ID); err != nil || active.ID != second.ID || active.EndedAt != nil {
+		t.Fatalf("ActiveScene = %+v, %v", active, err)
+	}
+
+	transcript, err := s.ListSceneLog(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("ListSceneLog: %v", err)
+	}
+	var msgs []string
+	for _, l := range transcript {
+		msgs = append(msgs, l.Msg)
+	}
+	if want := []string{"Scene 1: Docks", "Is the guard asleep?", "Scene 1 ended"}; !slices.Equal(msgs, want) {
+		t.Fatalf("ListSceneLog = %q, want %q", msgs, want)
+	}
+	p, err := transcript[2].DecodePayload()
+	if err != nil || transcript[2].Type != storage.LogSceneEnd || p.(*storage.SceneEndPayload).ChaosTo != 4 {
+		t.Fatalf("scene end entry = %+v, payload %+v, %v", transcript[2], p, err)
+	}
+	if transcript, _ := s.ListSceneLog(ctx, second.ID); len(transcript) != 1 || transcript[0].Type != storage.LogSceneStart {
+		t.Fatalf("ListSceneLog of the second scene = %+v", transcript)
+	}
+
+	log, err := s.ListLog(ctx, g.ID, 10)
+	if err != nil {
+		t.Fatalf("ListLog: %v", err)
+	}
+	if len(log) != 6 || log[0].Msg != "Scene 2: Warehouse" || log[1].Msg != "Between scenes" || log[1].SceneID != nil || log[5].Msg != "Prologue" {
+		t.Fatalf("ListLog = %+v", log)
+	}
+}
+
+func testLog(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	g := newGame(t, s, "Log")
+
+	if err := s.AddLogEntry(ctx, &storage.LogEntry{GameID: g.ID, Msg: "before"}); err != nil {
+		t.Fatalf("AddLogEntry: %v", err)
+	}
+	sc := &storage.Scene{GameID: g.ID, Number: 1}
+	s.CreateScene(ctx, sc)
+	in, err := storage.NewLogEntry(g.ID, "during", &storage.DiceRollPayload{Dice: "2d6", Rolls: []int{3, 4}, Total: 7})
+	if err != nil {
+		t.Fatalf("NewLogEntry: %v", err)
+	}
+	if err := s.AddLogEntry(ctx, in); err != nil {
+		t.Fatalf("AddLogEntry: %v", err)
+	}
+	if in.SceneID == nil || *in.SceneID != sc.ID {
+		t.Fatalf("entry not linked to the active scene: %+v", in)
+	}
+	s.AddLogEntry(ctx, &storage.LogEntry{GameID: g.ID, Msg: "last"})
+	bad := &storage.LogEntry{GameID: g.ID, Type: storage.LogFateQuestion, Msg: "bad", Payload: storage.Payload(`{"roll": 0}`)}
+	if err := s.AddLogEntry(ctx, bad); !errors.Is(err, storage.ErrInvalidPayload) {
+		t.Fatalf("AddLogEntry with invalid payload error = %v, want ErrInvalidPayload", err)
+	}
+
+	entries, err := s.ListLog(ctx, g.ID, 2)
+	if err != nil {
+		t.Fatalf("ListLog: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Msg != "last" || entries[1].Msg != "during" || entries[1].Type != storage.LogDiceRoll {
+		t.Fatalf("ListLog = %+v", entries)
+	}
+	if p, err := entries[1].DecodePayload(); err != nil || p.(*storage.DiceRollPayload).Total != 7 {
+		t.Fatalf("DecodePayload = %+v, %v", p, err)
+	}
+	transcript, err := s.ListSceneLog(ctx, sc.ID)
+	if err != nil {
+		t.Fatalf("ListSceneLog: %v", err)
+	}
+	if len(transcript) != 2 || transcript[0].Msg != "during" {
+		t.Fatalf("ListSceneLog = %+v", transcript)
+	}
+	if err := s.DeleteLogEntry(ctx, in.ID); err != nil {
+		t.Fatalf("DeleteLogEntry: %v", err)
+	}
+	if entries, _ := s.ListLog(ctx, g.ID, 10); len(entries) != 2 {
+		t.Fatalf("deleted entry still listed: %+v", entries)
+	}
+}
+
+// testModels checks that records behave as the models define: IDs come from
+// the BeforeCreate hooks and Themes and theme.State go through Value and Scan.
+func testModels(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	preset := uuid.New()
+	g := &storage.Game{ID: preset, Name: "Hooks", ThemeState: theme.State{History: []theme.ThemeType{theme.ThemeMystery}}}
+	if err := s.CreateGame(ctx, g); err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	if g.ID == preset || g.ID == uuid.Nil {
+		t.Fatalf("CreateGame kept ID %v, want a new one", g.ID)
+	}
+	got, err := s.GetGame(ctx, g.ID)
+	if err != nil {
+		t.Fatalf("GetGame: %v", err)
+	}
+	if got.StoryThemes != (theme.Themes{}) || len(got.ThemeState.History) != 1 || got.ThemeState.History[0] != theme.ThemeMystery {
+		t.Fatalf("GetGame themes = %v, %+v", got.StoryThemes, got.ThemeState)
+	}
+
+	th := &storage.Thread{ID: preset, GameID: g.ID, Name: "Hooked"}
+	if err := s.CreateThread(ctx, th); err != nil {
+		t.Fatalf("CreateThread: %v", err)
+	}
+	if th.ID == preset || th.ID == uuid.Nil {
+		t.Fatalf("CreateThread kept ID %v, want a new one", th.ID)
+	}
+}
@@ -0,0 +1,345 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultRetention is how long deleted records stay in the trash before the
+// purge command removes them, unless told otherwise.
+const DefaultRetention = 30 * 24 * time.Hour
+
+var (
+	// ErrNotInTrash is returned when restoring a record that is not deleted.
+	ErrNotInTrash = errors.New("not in the trash")
+	// ErrGameInTrash is returned when restoring a record of a deleted game;
+	// restore the game instead.
+	ErrGameInTrash = errors.New("the record's game is in the trash")
+)
+
+// TrashGameKind is the TrashItem.Kind of a deleted game.
+const TrashGameKind = "game"
+
+// trashTable is a table of records that belong to a game. Records of listed
+// tables appear in the trash and can be restored one by one; the others are
+// only deleted, restored and purged with their game or by Purge.
+type trashTable struct {
+	kind   string
+	table  string
+	name   string // SQL expression naming record r in the trash listing
+	listed bool
+}
+
+var trashTables = []trashTable{
+	{"log entry", "log_entries", "r.msg", true},
+	{"thread", "threads", "r.name", true},
+	{"character", "characters", "r.name", true},
+	{"player", "players", "r.name", true},
+	{"scene", "scenes", "'Scene ' || r.number || CASE WHEN r.title <> '' THEN ': ' || r.title ELSE '' END", true},
+	{"trigger", "triggers", "r.name", true},
+	{"plotline", "plotlines", "CASE WHEN r.name <> '' THEN r.name ELSE r.kind END", true},
+	{"turning point", "turning_points", "'Turning point ' || r.number", true},
+	{"operation", "operations", "r.description", false}, // Discarded undone operations
+}
+
+// plotPointsOf selects the plot points of the game's turning points.
+const plotPointsOf = "turning_point_id IN (SELECT id FROM turning_points WHERE game_id = ?)"
+
+// TrashItem is a deleted game, or a deleted record of a game that is not.
+type TrashItem struct {
+	Kind      string // TrashGameKind or the kind of record, such as "thread"
+	ID        uuid.UUID
+	GameID    uuid.UUID
+	GameName  string
+	Name      string // Name, title or text of the record
+	DeletedAt time.Time
+	Records   int64 // For a game, how many of its records were deleted with it
+}
+
+// RestoreOptions controls Restore.
+type RestoreOptions struct {
+	// Name restores a game under a different name. If empty, the game keeps
+	// its name, with a number added when another game has taken it since.
+	Name string
+}
+
+// PurgeResult counts what Purge removed.
+type PurgeResult struct {
+	Games   int64 // Deleted games removed with all of their records
+	Records int64 // Other records removed, including those of the games
+}
+
+// TrashGame soft deletes a game together with all of its records that are
+// not deleted yet, giving them the game's deletion time so that Restore can
+// bring them back together. The game's name becomes free for other games.
+// It returns ErrNotFound if there is no such game that is not deleted.
+//
+// The trash is outside the games' operation history: putting a game in the
+// trash and taking a game or record out with Restore are not recorded and
+// cannot be undone, and the operations of a game in the trash cannot be
+// undone or redone until it is restored.
+func TrashGame(db *gorm.DB, gameID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&Game{}).Where("id = ?", gameID).UpdateColumn("deleted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		for _, t := range trashTables {
+			err := tx.Table(t.table).Where("game_id = ? AND deleted_at IS NULL", gameID).UpdateColumn("deleted_at", now).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&PlotPointEntry{}).Where(plotPointsOf, gameID).UpdateColumn("deleted_at", now).Error
+	})
+}
+
+// ListTrash lists the deleted games, and the deleted records of games that
+// are not deleted, most recently deleted first. Records deleted with their
+// game are counted in the game's item rather than listed.
+func ListTrash(db *gorm.DB) ([]TrashItem, error) {
+	var items []TrashItem
+	var games []Game
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").Find(&games).Error; err != nil {
+		return nil, err
+	}
+	for _, g := range games {
+		item := TrashItem{Kind: TrashGameKind, ID: g.ID, GameID: g.ID, GameName: g.Name, Name: g.Name, DeletedAt: g.DeletedAt.Time}
+		for _, t := range trashTables {
+			var n int64
+			err := db.Table(t.table).Where("game_id = ? AND deleted_at = (SELECT deleted_at FROM games WHERE id = ?)", g.ID, g.ID).
+				Count(&n).Error
+			if err != nil {
+				return nil, err
+			}
+			item.Records += n
+		}
+		items = append(items, item)
+	}
+
+	for _, t := range trashTables {
+		if !t.listed {
+			continue
+		}
+		rows, err := findTrashRows(db, t, "r.deleted_at IS NOT NULL AND g.deleted_at IS NULL")
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			items = append(items, r.item(t))
+		}
+	}
+
+	slices.SortStableFunc(items, func(a, b TrashItem) int { return b.DeletedAt.Compare(a.DeletedAt) })
+	return items, nil
+}
+
+// trashRow is a record of a game table with its game.
+type trashRow struct {
+	ID          uuid.UUID
+	GameID      uuid.UUID
+	GameName    string
+	Name        string
+	DeletedAt   *time.Time
+	GameDeleted bool
+}
+
+func (r trashRow) item(t trashTable) TrashItem {
+	item := TrashItem{Kind: t.kind, ID: r.ID, GameID: r.GameID, GameName: r.GameName, Name: r.Name}
+	if r.DeletedAt != nil {
+		item.DeletedAt = *r.DeletedAt
+	}
+	return item
+}
+
+// findTrashRows returns the records of the table matching the condition, in
+// which r is the record and g its game.
+func findTrashRows(db *gorm.DB, t trashTable, cond string, args ...any) ([]trashRow, error) {
+	var rows []trashRow
+	err := db.Table(t.table+" AS r").
+		Select("r.id, r.game_id, g.name AS game_name, "+t.name+" AS name, r.deleted_at, g.deleted_at IS NOT NULL AS game_deleted").
+		Joins("JOIN games g ON g.id = r.game_id").
+		Where(cond, args...).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// Restore takes a game or record out of the trash and returns it as a trash
+// item. A game is restored with the records that were deleted with it;
+// records deleted before the game stay in the trash. When the game's name has
+// been taken by another game, it is restored with a number added, unless
+// opts.Name is given, in which case a taken name fails with ErrDuplicateName.
+// A record of a deleted game cannot be restored by itself and fails with
+// ErrGameInTrash. Restoring is not recorded in the game's history, see TrashGame.
+func Restore(db *gorm.DB, id uuid.UUID, opts RestoreOptions) (*TrashItem, error) {
+	var item *TrashItem
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var g Game
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").Limit(1).Find(&g, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		if g.ID != uuid.Nil {
+			item, err = restoreGame(tx, &g, opts)
+			return err
+		}
+		if opts.Name != "" {
+			return fmt.Errorf("only games can be restored under a new name")
+		}
+		item, err = restoreRecord(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func restoreGame(tx *gorm.DB, g *Game, opts RestoreOptions) (*TrashItem, error) {
+	name := g.Name
+	if opts.Name != "" {
+		name = SanitizeGameName(opts.Name)
+		if err := ValidateGameName(name); err != nil {
+			return nil, err
+		}
+	}
+	taken, err := gameNameTaken(tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if taken && opts.Name != "" {
+		return nil, ErrDuplicateName
+	}
+	if taken {
+		if name, err = freeGameName(tx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	item := &TrashItem{Kind: TrashGameKind, ID: g.ID, GameID: g.ID, GameName: name, Name: name, DeletedAt: g.DeletedAt.Time}
+	withGame := "deleted_at = (SELECT deleted_at FROM games WHERE id = ?)"
+	err = tx.Model(&PlotPointEntry{}).Unscoped().Where(plotPointsOf+" AND "+withGame, g.ID, g.ID).
+		UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trashTables {
+		res := tx.Table(t.table).Where("game_id = ? AND "+withGame, g.ID, g.ID).UpdateColumn("deleted_at", nil)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		item.Records += res.RowsAffected
+	}
+	err = tx.Model(g).Unscoped().UpdateColumns(map[string]any{"deleted_at": nil, "name": name}).Error
+	return item, translateError(err)
+}
+
+func restoreRecord(tx *gorm.DB, id uuid.UUID) (*TrashItem, error) {
+	for _, t := range trashTables {
+		if !t.listed {
+			continue
+		}
+		rows, err := findTrashRows(tx, t, "r.id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if rows[0].DeletedAt == nil {
+			return nil, fmt.Errorf("%s %s: %w", t.kind, id, ErrNotInTrash)
+		}
+		if rows[0].GameDeleted {
+			return nil, fmt.Errorf("%s %s: %w", t.kind, id, ErrGameInTrash)
+		}
+		if err := tx.Table(t.table).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return nil, err
+		}
+		item := rows[0].item(t)
+		return &item, nil
+	}
+	return nil, fmt.Errorf("%s: %w", id, ErrNotInTrash)
+}
+
+// Purge permanently removes what was put in the trash before the given time:
+// deleted games with all of their records, whether deleted or not, and other
+// deleted records. Use time.Now().Add(-DefaultRetention) to keep the trash
+// for the default retention period. The database is snapshotted first, see
+// AutoSnapshot.
+func Purge(db *gorm.DB, before time.Time) (PurgeResult, error) {
+	var res PurgeResult
+	if err := AutoSnapshot(db, "purge"); err != nil {
+		return res, err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var gameIDs []uuid.UUID
+		err := tx.Unscoped().Model(&Game{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Pluck("id", &gameIDs).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range gameIDs {
+			n, err := purgeWhere(tx, "game_id = ?", id)
+			if err != nil {
+				return err
+			}
+			res.Records += n
+		}
+		if len(gameIDs) > 0 {
+			if err := tx.Unscoped().Where("id IN ?", gameIDs).Delete(&Game{}).Error; err != nil {
+				return err
+			}
+		}
+		res.Games = int64(len(gameIDs))
+
+		deleted := "deleted_at IS NOT NULL AND deleted_at < ?"
+		n, err := purgeWhere(tx, deleted, before)
+		if err != nil {
+			return err
+		}
+		del := tx.Unscoped().Where(deleted, before).Delete(&PlotPointEntry{})
+		res.Records += n + del.RowsAffected
+		return del.Error
+	})
+	return res, err
+}
+
+// purgeWhere permanently removes the game records matching the condition,
+// along with the plot points of the turning points removed.
+func purgeWhere(tx *gorm.DB, cond string, arg any) (int64, error) {
+	var n int64
+	del := tx.Unscoped().Where("turning_point_id IN (SELECT id FROM turning_points WHERE "+cond+")", arg).Delete(&PlotPointEntry{})
+	if del.Error != nil {
+		return 0, del.Error
+	}
+	n += del.RowsAffected
+	for _, t := range trashTables {
+		del := tx.Exec("DELETE FROM "+t.table+" WHERE "+cond, arg)
+		if del.Error != nil {
+			return 0, del.Error
+		}
+		n += del.RowsAffected
+	}
+	return n, nil
+}
+
+// checkGameNotInTrash returns ErrGameInTrash if the game is in the trash.
+func checkGameNotInTrash(tx *gorm.DB, gameID uuid.UUID) error {
+	var n int64
+	if err := tx.Unscoped().Model(&Game{}).Where("id = ? AND deleted_at IS NOT NULL", gameID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrGameInTrash
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestTrashRestorePurge(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Alpha", Chaos: 5}
+	db.Create(g)
+	kept := &Thread{GameID: g.ID, Name: "Find the relic"}
+	dropped := &Thread{GameID: g.ID, Name: "Old lead"}
+	db.Create(kept)
+	db.Create(dropped)
+	sc := &Scene{GameID: g.ID, Number: 1, Title: "Docks", IsActive: true}
+	db.Create(sc)
+	db.Create(&LogEntry{GameID: g.ID, SceneID: &sc.ID, Msg: "The relic is here"})
+	db.Create(&Character{GameID: g.ID, Name: "Vera"})
+	tp := &TurningPoint{GameID: g.ID, Number: 1, PlotPoints: []PlotPointEntry{{Position: 1, Name: "AMBUSH"}}}
+	db.Create(tp)
+	db.Delete(dropped)
+
+	if err := TrashGame(db, g.ID); err != nil {
+		t.Fatalf("TrashGame: %v", err)
+	}
+	if err := TrashGame(db, g.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second TrashGame error = %v, want ErrNotFound", err)
+	}
+	var live int64
+	db.Model(&Thread{}).Where("game_id = ?", g.ID).Count(&live)
+	if live != 0 {
+		t.Fatalf("%d threads of the deleted game left", live)
+	}
+	items, err := ListTrash(db)
+	if err != nil {
+		t.Fatalf("ListTrash: %v", err)
+	}
+	// The thread deleted before the game is not listed while its game is deleted.
+	if len(items) != 1 || items[0].Kind != TrashGameKind || items[0].Name != "Alpha" || items[0].Records != 5 {
+		t.Fatalf("ListTrash = %+v", items)
+	}
+	if _, err := Restore(db, kept.ID, RestoreOptions{}); !errors.Is(err, ErrGameInTrash) {
+		t.Fatalf("Restore of a deleted game's thread error = %v, want ErrGameInTrash", err)
+	}
+
+	// The name is free once the game is deleted.
+	if err := db.Create(&Game{Name: "Alpha"}).Error; err != nil {
+		t.Fatalf("Create with a deleted game's name: %v", err)
+	}
+	if _, err := Restore(db, g.ID, RestoreOptions{Name: "Alpha"}); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("Restore under a taken name error = %v, want ErrDuplicateName", err)
+	}
+	item, err := Restore(db, g.ID, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if item.Name != "Alpha 2" || item.Records != 5 {
+		t.Fatalf("Restore = %+v", item)
+	}
+	var plotPoints, threads int64
+	db.Model(&PlotPointEntry{}).Where("turning_point_id = ?", tp.ID).Count(&plotPoints)
+	db.Model(&Thread{}).Where("game_id = ?", g.ID).Count(&threads)
+	if plotPoints != 1 || threads != 1 {
+		t.Fatalf("restored %d plot points and %d threads, want 1 and 1", plotPoints, threads)
+	}
+	var active Scene
+	if err := db.First(&active, "game_id = ? AND is_active", g.ID).Error; err != nil {
+		t.Fatalf("restored scene: %v", err)
+	}
+
+	items, _ = ListTrash(db)
+	if len(items) != 1 || items[0].Kind != "thread" || items[0].ID != dropped.ID || items[0].GameName != "Alpha 2" {
+		t.Fatalf("ListTrash after restore = %+v", items)
+	}
+	if item, err := Restore(db, dropped.ID, RestoreOptions{}); err != nil || item.Name != "Old lead" {
+		t.Fatalf("Restore thread = %+v, %v", item, err)
+	}
+	if _, err := Restore(db, dropped.ID, RestoreOptions{}); !errors.Is(err, ErrNotInTrash) {
+		t.Fatalf("second Restore error = %v, want ErrNotInTrash", err)
+	}
+
+	db.Delete(dropped)
+	TrashGame(db, g.ID)
+	if res, err := Purge(db, time.Now().Add(-DefaultRetention)); err != nil || res != (PurgeResult{}) {
+		t.Fatalf("Purge within retention = %+v, %v", res, err)
+	}
+	res, err := Purge(db, time.Now())
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	// Two threads, a scene, a log entry, a character, a turning point and its plot point.
+	if res.Games != 1 || res.Records != 7 {
+		t.Fatalf("Purge = %+v", res)
+	}
+	var left int64
+	db.Unscoped().Model(&Game{}).Where("id = ?", g.ID).Count(&left)
+	for _, model := range []any{&Thread{}, &Scene{}, &LogEntry{}, &Character{}, &TurningPoint{}} {
+		var n int64
+		db.Unscoped().Model(model).Where("game_id = ?", g.ID).Count(&n)
+		left += n
+	}
+	if left != 0 {
+		t.Fatalf("%d rows left after purge", left)
+	}
+	if items, _ := ListTrash(db); len(items) != 0 {
+		t.Fatalf("ListTrash after purge = %+v", items)
+	}
+}
+
+func TestTrashIsOutsideHistory(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Alpha", Chaos: 5}
+	db.Create(g)
+	th := &Thread{GameID: g.ID, Name: "Find the relic"}
+	err = Record(db, g.ID, "Add thread", func(tx *gorm.DB, rec *Recorder) error {
+		return rec.Create(th)
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if err := TrashGame(db, g.ID); err != nil {
+		t.Fatalf("TrashGame: %v", err)
+	}
+	if _, err := Undo(db, g.ID); !errors.Is(err, ErrGameInTrash) {
+		t.Fatalf("Undo in the trash error = %v, want ErrGameInTrash", err)
+	}
+	if _, err := Redo(db, g.ID); !errors.Is(err, ErrGameInTrash) {
+		t.Fatalf("Redo in the trash error = %v, want ErrGameInTrash", err)
+	}
+
+	// Restoring is not an operation either: undo reverts the thread's creation.
+	if _, err := Restore(db, g.ID, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	op, err := Undo(db, g.ID)
+	if err != nil || op.Description != "Add thread" {
+		t.Fatalf("Undo after restore = %+v, %v", op, err)
+	}
+	var games, threads int64
+	db.Model(&Game{}).Where("id = ?", g.ID).Count(&games)
+	db.Model(&Thread{}).Where("game_id = ?", g.ID).Count(&threads)
+	if games != 1 || threads != 0 {
+		t.Fatalf("after undo %d games and %d threads, want 1 and 0", games, threads)
+	}
+}
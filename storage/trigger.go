@@ -0,0 +1,120 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DMXMax/mge/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var triggerConditions = []string{TriggerChaos, TriggerSceneCount, TriggerThreadStatus, TriggerEventFocus, TriggerScenesElapsed}
+
+// Validate checks that the trigger can fire: its checkpoint, condition and
+// effect are known, the condition has what it needs, and an event focus is
+// only checked when a random event is generated, the only time there is one.
+func (t *Trigger) Validate() error {
+	switch {
+	case strings.TrimSpace(t.Name) == "":
+		return errors.New("trigger name cannot be empty")
+	case strings.TrimSpace(t.Outcome) == "":
+		return fmt.Errorf("trigger %q needs an outcome", t.Name)
+	case t.Checkpoint != TriggerOnScene && t.Checkpoint != TriggerOnEvent:
+		return fmt.Errorf("trigger %q: unknown checkpoint %q (must be %s or %s)", t.Name, t.Checkpoint, TriggerOnScene, TriggerOnEvent)
+	case t.Effect != TriggerOverride && t.Effect != TriggerAugment:
+		return fmt.Errorf("trigger %q: unknown effect %q (must be %s or %s)", t.Name, t.Effect, TriggerOverride, TriggerAugment)
+	case !slices.Contains(triggerConditions, t.Condition):
+		return fmt.Errorf("trigger %q: unknown condition %q (must be one of %s)", t.Name, t.Condition, strings.Join(triggerConditions, ", "))
+	}
+
+	switch t.Condition {
+	case TriggerChaos:
+		if t.Threshold < MinChaos || t.Threshold > MaxChaos {
+			return fmt.Errorf("trigger %q: chaos threshold out of range (%d-%d): %d", t.Name, MinChaos, MaxChaos, t.Threshold)
+		}
+	case TriggerSceneCount, TriggerScenesElapsed:
+		if t.Threshold < 1 {
+			return fmt.Errorf("trigger %q: %s threshold must be positive: %d", t.Name, t.Condition, t.Threshold)
+		}
+	case TriggerThreadStatus:
+		if t.ThreadID == nil || t.Value == "" {
+			return fmt.Errorf("trigger %q: %s needs a thread and a status", t.Name, t.Condition)
+		}
+	case TriggerEventFocus:
+		if t.Checkpoint != TriggerOnEvent {
+			return fmt.Errorf("trigger %q: %s is only checked at the %s checkpoint", t.Name, t.Condition, TriggerOnEvent)
+		}
+		known := false
+		for _, text := range util.EventText {
+			known = known || strings.EqualFold(text, t.Value)
+		}
+		if !known {
+			return fmt.Errorf("trigger %q: unknown event focus %q", t.Name, t.Value)
+		}
+	}
+	return nil
+}
+
+// ListTriggers returns the game's keyed scenes and events in the order they
+// were added, armed or not.
+func ListTriggers(db *gorm.DB, gameID uuid.UUID) ([]Trigger, error) {
+	var triggers []Trigger
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&triggers).Error; err != nil {
+		return nil, err
+	}
+	return triggers, nil
+}
+
+// TriggerOptions controls AddTrigger.
+type TriggerOptions struct {
+	// Disarmed adds the trigger disarmed, so that it does not fire until it
+	// is armed with SetTriggerActive.
+	Disarmed bool
+}
+
+// AddTrigger adds a keyed scene or event to the game, recording it in the
+// game's history. An empty Checkpoint or Effect defaults to TriggerOnScene or
+// TriggerOverride. The trigger is armed, whatever its Active field says,
+// unless opts.Disarmed is set. The thread of a thread condition must belong
+// to the game.
+func AddTrigger(db *gorm.DB, t *Trigger, opts TriggerOptions) error {
+	t.Checkpoint = cmp.Or(t.Checkpoint, TriggerOnScene)
+	t.Effect = cmp.Or(t.Effect, TriggerOverride)
+	t.Active = !opts.Disarmed
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	return Record(db, t.GameID, "Add trigger "+t.Name, func(tx *gorm.DB, rec *Recorder) error {
+		if t.ThreadID != nil {
+			var n int64
+			if err := tx.Model(&Thread{}).Where("id = ? AND game_id = ?", *t.ThreadID, t.GameID).Count(&n).Error; err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("trigger %q: thread is not in this game", t.Name)
+			}
+		}
+		return rec.Create(t)
+	})
+}
+
+// SetTriggerActive arms or disarms a trigger, recording it in the game's
+// history.
+func SetTriggerActive(db *gorm.DB, t *Trigger, active bool) error {
+	desc := "Disarm trigger " + t.Name
+	if active {
+		desc = "Arm trigger " + t.Name
+	}
+	return Record(db, t.GameID, desc, func(tx *gorm.DB, rec *Recorder) error {
+		if err := rec.Update(t, map[string]any{"active": active}); err != nil {
+			return err
+		}
+		t.Active = active
+		return nil
+	})
+}
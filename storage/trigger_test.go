@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAddTrigger(t *testing.T) {
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	g := &Game{Name: "Triggers", Chaos: 5}
+	db.Create(g)
+
+	armed := &Trigger{GameID: g.ID, Name: "Storm", Condition: TriggerChaos, Threshold: 7, Outcome: "A storm hits"}
+	if err := AddTrigger(db, armed, TriggerOptions{}); err != nil {
+		t.Fatalf("AddTrigger: %v", err)
+	}
+	if armed.Checkpoint != TriggerOnScene || armed.Effect != TriggerOverride {
+		t.Fatalf("defaults not applied: %+v", armed)
+	}
+	// Active is ignored, so a trigger is armed unless asked otherwise.
+	disarmed := &Trigger{GameID: g.ID, Name: "Ambush", Condition: TriggerSceneCount, Threshold: 3, Outcome: "Bandits attack", Active: true}
+	if err := AddTrigger(db, disarmed, TriggerOptions{Disarmed: true}); err != nil {
+		t.Fatalf("AddTrigger: %v", err)
+	}
+
+	triggers, err := ListTriggers(db, g.ID)
+	if err != nil {
+		t.Fatalf("ListTriggers: %v", err)
+	}
+	if len(triggers) != 2 || !triggers[0].Active || triggers[1].Active {
+		t.Fatalf("ListTriggers = %+v, want Storm armed and Ambush disarmed", triggers)
+	}
+
+	if err := SetTriggerActive(db, disarmed, true); err != nil {
+		t.Fatalf("SetTriggerActive: %v", err)
+	}
+	if _, err := Undo(db, g.ID); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	var stored Trigger
+	db.First(&stored, "id = ?", disarmed.ID)
+	if stored.Active {
+		t.Fatalf("undo did not disarm the trigger again")
+	}
+}
+
+func TestTriggerValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger Trigger
+		ok      bool
+	}{
+		{"event focus on event", Trigger{Checkpoint: TriggerOnEvent, Condition: TriggerEventFocus, Value: "Remote Event"}, true},
+		{"event focus on scene", Trigger{Checkpoint: TriggerOnScene, Condition: TriggerEventFocus, Value: "Remote Event"}, false},
+		{"unknown event focus", Trigger{Checkpoint: TriggerOnEvent, Condition: TriggerEventFocus, Value: "Dragons"}, false},
+		{"chaos out of range", Trigger{Checkpoint: TriggerOnScene, Condition: TriggerChaos, Threshold: 12}, false},
+		{"thread status without thread", Trigger{Checkpoint: TriggerOnScene, Condition: TriggerThreadStatus, Value: "resolved"}, false},
+		{"unknown condition", Trigger{Checkpoint: TriggerOnScene, Condition: "weather"}, false},
+		{"unknown checkpoint", Trigger{Checkpoint: "dawn", Condition: TriggerChaos, Threshold: 5}, false},
+	}
+	for _, tt := range tests {
+		tt.trigger.Name, tt.trigger.Outcome = tt.name, "Something happens"
+		if tt.trigger.Effect == "" {
+			tt.trigger.Effect = TriggerOverride
+		}
+		if err := tt.trigger.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate = %v", tt.name, err)
+		}
+	}
+}
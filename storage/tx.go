@@ -0,0 +1,58 @@
+// Package storage provides shared game data structures and operations
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// GameTx runs fn in a transaction for an operation that takes several steps
+// on the game, such as saving a turning point along with the game's theme
+// state. It fails with ErrConflict, without running fn, if the game was
+// changed in the database since g was loaded. If fn fails, g's UpdatedAt is
+// put back, so that an update of g that was rolled back can be retried.
+func GameTx(db *gorm.DB, g *Game, fn func(tx *gorm.DB) error) error {
+	version := g.UpdatedAt
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkGameUnchanged(tx, g); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		g.UpdatedAt = version
+	}
+	return err
+}
+
+// UpdateGameColumns sets columns of the game, failing with ErrConflict if the
+// game was changed in the database since g was loaded. The game's UpdatedAt
+// is set to its new version, so that g can be saved again.
+func UpdateGameColumns(db *gorm.DB, g *Game, columns map[string]any) error {
+	return GameTx(db, g, func(tx *gorm.DB) error {
+		return translateError(tx.Model(g).Updates(columns).Error)
+	})
+}
+
+// checkGameUnchanged returns ErrConflict if the game's UpdatedAt in the
+// database is not the one g was loaded with. A game with a zero UpdatedAt was
+// not loaded from the database and is not checked.
+func checkGameUnchanged(tx *gorm.DB, g *Game) error {
+	if g.UpdatedAt.IsZero() {
+		return nil
+	}
+	var current Game
+	err := tx.Select("id", "updated_at").First(&current, "id = ?", g.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !current.UpdatedAt.Equal(g.UpdatedAt) {
+		return fmt.Errorf("game %q: %w", g.Name, ErrConflict)
+	}
+	return nil
+}
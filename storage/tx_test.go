@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestConcurrentSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db1, err := InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	db2, err := InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	var mode string
+	var timeout int
+	db1.Raw("PRAGMA journal_mode").Scan(&mode)
+	db1.Raw("PRAGMA busy_timeout").Scan(&timeout)
+	if mode != "wal" || timeout != int(BusyTimeout.Milliseconds()) {
+		t.Fatalf("journal_mode = %q, busy_timeout = %d", mode, timeout)
+	}
+
+	g := &Game{Name: "Shared", Chaos: 5}
+	db1.Create(g)
+	var other Game
+	db2.First(&other, "id = ?", g.ID)
+
+	// A game can be saved again and again by the session that loaded it.
+	for _, chaos := range []int8{6, 7} {
+		if err := g.SaveChaos(db1, chaos); err != nil {
+			t.Fatalf("SaveChaos(%d): %v", chaos, err)
+		}
+	}
+	if err := UpdateGameColumns(db1, g, map[string]any{"plot_dataset": "custom"}); err != nil {
+		t.Fatalf("UpdateGameColumns: %v", err)
+	}
+
+	// The other session's copy is stale.
+	if err := other.SaveChaos(db2, 2); !errors.Is(err, ErrConflict) {
+		t.Fatalf("SaveChaos of a stale game error = %v, want ErrConflict", err)
+	}
+	ran := false
+	err = GameTx(db2, &other, func(tx *gorm.DB) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, ErrConflict) || ran {
+		t.Fatalf("GameTx of a stale game error = %v, ran = %v", err, ran)
+	}
+	db2.First(&other, "id = ?", g.ID)
+	if other.Chaos != 7 || other.PlotDataset != "custom" {
+		t.Fatalf("game = %+v, want the first session's changes", other)
+	}
+	if err := other.SaveThemes(db2); err != nil {
+		t.Fatalf("SaveThemes after reloading: %v", err)
+	}
+
+	// Writers in both sessions wait for each other instead of failing.
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i, db := range []*gorm.DB{db1, db2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				errs <- Record(db, g.ID, "Add note", func(tx *gorm.DB, rec *Recorder) error {
+					return rec.AddLogEntry(&LogEntry{GameID: g.ID, Msg: fmt.Sprintf("session %d note %d", i+1, j)})
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent Record: %v", err)
+		}
+	}
+	var n int64
+	db1.Model(&LogEntry{}).Where("game_id = ? AND msg LIKE 'session %'", g.ID).Count(&n)
+	if n != 40 {
+		t.Fatalf("%d notes written, want 40", n)
+	}
+}
@@ -0,0 +1,394 @@
+// Package analytics reports how a campaign has played from a game's log and
+// lists: Fate Chart answers against the odds, random events, the chaos
+// factor over time, scene types, threads and the meaning words rolled.
+package analytics
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DMXMax/mge/chart"
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultTopWords is how many meaning words a report lists unless told otherwise.
+const DefaultTopWords = 10
+
+// Options controls Build.
+type Options struct {
+	TopWords int // How many of the most used meaning words to list, DefaultTopWords if 0
+}
+
+// Rates are shares of fate question answers, from 0 to 1.
+type Rates struct {
+	Yes         float64 `json:"yes"`         // Yes or Exceptional Yes
+	No          float64 `json:"no"`          // No or Exceptional No
+	Exceptional float64 `json:"exceptional"` // Exceptional Yes or Exceptional No
+}
+
+// OddsStats compares the answers to the fate questions asked at one odds
+// level with the rates the Fate Chart gives for the same questions, each at
+// the chaos factor it was asked at.
+type OddsStats struct {
+	Odds           string `json:"odds"`
+	Questions      int    `json:"questions"`
+	ExceptionalYes int    `json:"exceptional_yes"`
+	Yes            int    `json:"yes"`
+	No             int    `json:"no"`
+	ExceptionalNo  int    `json:"exceptional_no"`
+	Actual         Rates  `json:"actual"`
+	Expected       Rates  `json:"expected"`
+}
+
+// Count is how often something came up, with its share of the total.
+type Count struct {
+	Name  string  `json:"name"`
+	Count int     `json:"count"`
+	Share float64 `json:"share"`
+}
+
+// EventStats describes the random events of the game. Events raised by fate
+// questions are compared with the chance the Fate Chart gives of raising one.
+type EventStats struct {
+	Total               int     `json:"total"`                 // Random events logged, including those raised by fate questions
+	FromQuestions       int     `json:"from_questions"`        // Events raised by fate questions
+	PerQuestion         float64 `json:"per_question"`          // FromQuestions per fate question
+	ExpectedPerQuestion float64 `json:"expected_per_question"` // Chance of an event per fate question
+	PerScene            float64 `json:"per_scene"`             // Total per scene played
+	Focus               []Count `json:"focus"`                 // Events by focus, most frequent first
+}
+
+// ChaosPoint is the chaos factor at a point in the game.
+type ChaosPoint struct {
+	Time   time.Time `json:"time"`
+	Scene  int       `json:"scene"` // Number of the scene, 0 between scenes
+	Chaos  int       `json:"chaos"`
+	Reason string    `json:"reason"` // "scene start", "scene end" or "change"
+}
+
+// ChaosStats is the chaos factor over time.
+type ChaosStats struct {
+	Current  int          `json:"current"`
+	Min      int          `json:"min"`
+	Max      int          `json:"max"`
+	Average  float64      `json:"average"` // Over the points of the timeline
+	Timeline []ChaosPoint `json:"timeline"`
+}
+
+// ThreadStats counts the threads opened and closed, per scene played.
+type ThreadStats struct {
+	Opened         int     `json:"opened"`
+	Closed         int     `json:"closed"` // Resolved
+	Open           int     `json:"open"`   // Not resolved
+	OpenedPerScene float64 `json:"opened_per_scene"`
+	ClosedPerScene float64 `json:"closed_per_scene"`
+}
+
+// Report is the analytics report of a game.
+type Report struct {
+	Game         string      `json:"game"`
+	GeneratedAt  time.Time   `json:"generated_at"`
+	Scenes       int         `json:"scenes"`
+	Questions    int         `json:"questions"`
+	Odds         []OddsStats `json:"odds"`              // In Fate Chart order, only odds that were asked
+	Overall      OddsStats   `json:"overall"`           // All fate questions
+	Players      []Count     `json:"players,omitempty"` // Fate questions asked by each player, in group play
+	Events       EventStats  `json:"events"`
+	Chaos        ChaosStats  `json:"chaos"`
+	SceneTypes   []Count     `json:"scene_types"` // Expected, altered and interrupt first
+	Threads      ThreadStats `json:"threads"`
+	MeaningWords []Count     `json:"meaning_words"` // Most used first
+}
+
+// Build reads the game's scenes, log and threads and works out its report.
+func Build(db *gorm.DB, gameID uuid.UUID, opts Options) (*Report, error) {
+	if opts.TopWords == 0 {
+		opts.TopWords = DefaultTopWords
+	}
+	var g storage.Game
+	if err := db.First(&g, "id = ?", gameID).Error; err != nil {
+		return nil, err
+	}
+	var scenes []storage.Scene
+	if err := db.Where("game_id = ?", gameID).Order("number").Find(&scenes).Error; err != nil {
+		return nil, err
+	}
+	var log []storage.LogEntry
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&log).Error; err != nil {
+		return nil, err
+	}
+	var threads []storage.Thread
+	if err := db.Where("game_id = ?", gameID).Find(&threads).Error; err != nil {
+		return nil, err
+	}
+
+	r := &Report{Game: g.Name, GeneratedAt: time.Now(), Scenes: len(scenes), Chaos: ChaosStats{Current: int(g.Chaos)}}
+	sceneNumbers := map[uuid.UUID]int{}
+	for _, s := range scenes {
+		sceneNumbers[s.ID] = s.Number
+	}
+
+	a := newTally()
+	for _, l := range log {
+		p, err := l.DecodePayload()
+		if err != nil || p == nil {
+			continue
+		}
+		scene := 0
+		if l.SceneID != nil {
+			scene = sceneNumbers[*l.SceneID]
+		}
+		switch p := p.(type) {
+		case *storage.FateQuestionPayload:
+			a.question(p)
+		case *storage.RandomEventPayload:
+			a.event(p)
+		case *storage.SceneStartPayload:
+			if p.Chaos == 0 {
+				continue // Logged without the chaos factor
+			}
+			r.Chaos.Timeline = append(r.Chaos.Timeline, ChaosPoint{l.CreatedAt, p.Number, p.Chaos, "scene start"})
+		case *storage.SceneEndPayload:
+			r.Chaos.Timeline = append(r.Chaos.Timeline, ChaosPoint{l.CreatedAt, p.Number, p.ChaosTo, "scene end"})
+		case *storage.ChaosChangePayload:
+			r.Chaos.Timeline = append(r.Chaos.Timeline, ChaosPoint{l.CreatedAt, scene, p.To, "change"})
+		}
+	}
+
+	r.Odds, r.Overall = a.oddsStats()
+	r.Questions = r.Overall.Questions
+	r.Players = counts(a.players, 0)
+	r.Events = a.eventStats(r.Questions, len(scenes))
+	r.MeaningWords = counts(a.words, opts.TopWords)
+	r.Chaos.summarize()
+	r.SceneTypes = sceneTypes(scenes)
+	r.Threads = threadStats(threads, len(scenes))
+	return r, nil
+}
+
+// tally collects the fate questions and events of a log.
+type tally struct {
+	odds          map[string]*oddsTally
+	events        map[string]int // By focus
+	fromQuestions int
+	eventChance   float64 // Sum over questions
+	words         map[string]int
+	players       map[string]int // Questions by player
+}
+
+// oddsTally sums the answers and expected rates of the questions at one odds level.
+type oddsTally struct {
+	stats    OddsStats
+	expected Rates // Sums, divided by the number of questions at the end
+}
+
+func newTally() *tally {
+	return &tally{odds: map[string]*oddsTally{}, events: map[string]int{}, words: map[string]int{}, players: map[string]int{}}
+}
+
+func (a *tally) question(q *storage.FateQuestionPayload) {
+	o := strings.ToLower(strings.TrimSpace(q.Odds))
+	t := a.odds[o]
+	if t == nil {
+		t = &oddsTally{stats: OddsStats{Odds: o}}
+		a.odds[o] = t
+	}
+	t.stats.Questions++
+	if q.Player != "" {
+		a.players[q.Player]++
+	}
+	switch strings.ToLower(q.Answer) {
+	case "exceptional yes":
+		t.stats.ExceptionalYes++
+	case "yes":
+		t.stats.Yes++
+	case "exceptional no":
+		t.stats.ExceptionalNo++
+	default:
+		t.stats.No++
+	}
+
+	threshold := q.Threshold
+	if i := slices.Index(chart.OddsStrList, o); threshold == 0 && i >= 0 {
+		threshold = chart.ChartValue(chart.Odds(i), q.Chaos)
+	}
+	exp := expectedRates(threshold)
+	t.expected.Yes += exp.Yes
+	t.expected.No += exp.No
+	t.expected.Exceptional += exp.Exceptional
+	a.eventChance += float64(chart.EventChance(q.Chaos)) / 100
+
+	if q.Event != "" {
+		a.fromQuestions++
+		focus, _, _ := strings.Cut(q.Event, ":")
+		a.events[strings.TrimSpace(focus)]++
+	}
+}
+
+func (a *tally) event(e *storage.RandomEventPayload) {
+	a.events[e.Focus]++
+	for _, w := range [][]string{{e.Action, e.Subject}, e.Actions, e.Descriptors} {
+		for _, w := range w {
+			if w = strings.TrimSpace(w); w != "" {
+				a.words[w]++
+			}
+		}
+	}
+}
+
+// expectedRates returns the rates of answers the Fate Chart gives for a d100
+// roll against the chart value.
+func expectedRates(threshold int) Rates {
+	var r Rates
+	for roll := 1; roll <= 100; roll++ {
+		switch chart.Answer(threshold, roll) {
+		case "Exceptional Yes":
+			r.Yes++
+			r.Exceptional++
+		case "Yes":
+			r.Yes++
+		case "Exceptional No":
+			r.No++
+			r.Exceptional++
+		default:
+			r.No++
+		}
+	}
+	return Rates{Yes: r.Yes / 100, No: r.No / 100, Exceptional: r.Exceptional / 100}
+}
+
+// oddsStats returns the stats of each odds level asked, in Fate Chart order
+// followed by any unknown odds, and of all questions.
+func (a *tally) oddsStats() ([]OddsStats, OddsStats) {
+	overall := &oddsTally{stats: OddsStats{Odds: "all"}}
+	var stats []OddsStats
+	for _, t := range a.odds {
+		s := &overall.stats
+		s.Questions += t.stats.Questions
+		s.ExceptionalYes += t.stats.ExceptionalYes
+		s.Yes += t.stats.Yes
+		s.No += t.stats.No
+		s.ExceptionalNo += t.stats.ExceptionalNo
+		overall.expected.Yes += t.expected.Yes
+		overall.expected.No += t.expected.No
+		overall.expected.Exceptional += t.expected.Exceptional
+		stats = append(stats, t.finish())
+	}
+	rank := func(o string) int {
+		if i := slices.Index(chart.OddsStrList, o); i >= 0 {
+			return i
+		}
+		return len(chart.OddsStrList)
+	}
+	slices.SortFunc(stats, func(a, b OddsStats) int {
+		return cmp.Or(cmp.Compare(rank(a.Odds), rank(b.Odds)), cmp.Compare(a.Odds, b.Odds))
+	})
+	return stats, overall.finish()
+}
+
+// finish turns the sums into rates.
+func (t *oddsTally) finish() OddsStats {
+	s := t.stats
+	if n := float64(s.Questions); n > 0 {
+		s.Actual = Rates{
+			Yes:         float64(s.Yes+s.ExceptionalYes) / n,
+			No:          float64(s.No+s.ExceptionalNo) / n,
+			Exceptional: float64(s.ExceptionalYes+s.ExceptionalNo) / n,
+		}
+		s.Expected = Rates{Yes: t.expected.Yes / n, No: t.expected.No / n, Exceptional: t.expected.Exceptional / n}
+	}
+	return s
+}
+
+func (a *tally) eventStats(questions, scenes int) EventStats {
+	e := EventStats{FromQuestions: a.fromQuestions, Focus: counts(a.events, 0)}
+	for _, c := range e.Focus {
+		e.Total += c.Count
+	}
+	if questions > 0 {
+		e.PerQuestion = float64(a.fromQuestions) / float64(questions)
+		e.ExpectedPerQuestion = a.eventChance / float64(questions)
+	}
+	if scenes > 0 {
+		e.PerScene = float64(e.Total) / float64(scenes)
+	}
+	return e
+}
+
+// counts returns the counts, most frequent first, keeping the first n if n > 0.
+func counts(m map[string]int, n int) []Count {
+	total := 0
+	for _, c := range m {
+		total += c
+	}
+	var list []Count
+	for name, c := range m {
+		list = append(list, Count{Name: name, Count: c, Share: float64(c) / float64(total)})
+	}
+	slices.SortFunc(list, func(a, b Count) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (c *ChaosStats) summarize() {
+	if len(c.Timeline) == 0 {
+		c.Min, c.Max, c.Average = c.Current, c.Current, float64(c.Current)
+		return
+	}
+	c.Min, c.Max = c.Timeline[0].Chaos, c.Timeline[0].Chaos
+	sum := 0
+	for _, p := range c.Timeline {
+		c.Min, c.Max = min(c.Min, p.Chaos), max(c.Max, p.Chaos)
+		sum += p.Chaos
+	}
+	c.Average = float64(sum) / float64(len(c.Timeline))
+}
+
+// sceneTypes counts the scenes by type, listing the expected, altered and
+// interrupt types even when none were played.
+func sceneTypes(scenes []storage.Scene) []Count {
+	known := []string{"expected", "altered", "interrupt"}
+	m := map[string]int{}
+	for _, s := range scenes {
+		t := strings.ToLower(s.Type)
+		if t == "" {
+			t = "unknown"
+		}
+		m[t]++
+	}
+	var list []Count
+	for _, t := range known {
+		list = append(list, Count{Name: t, Count: m[t]})
+		delete(m, t)
+	}
+	list = append(list, counts(m, 0)...)
+	for i := range list {
+		if len(scenes) > 0 {
+			list[i].Share = float64(list[i].Count) / float64(len(scenes))
+		}
+	}
+	return list
+}
+
+func threadStats(threads []storage.Thread, scenes int) ThreadStats {
+	s := ThreadStats{Opened: len(threads)}
+	for _, t := range threads {
+		if t.Status == "resolved" {
+			s.Closed++
+		}
+	}
+	s.Open = s.Opened - s.Closed
+	if scenes > 0 {
+		s.OpenedPerScene = float64(s.Opened) / float64(scenes)
+		s.ClosedPerScene = float64(s.Closed) / float64(scenes)
+	}
+	return s
+}
@@ -0,0 +1,156 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"gorm.io/gorm"
+)
+
+var start = time.Date(2026, 3, 1, 19, 0, 0, 0, time.UTC)
+
+func newStatsGame(t *testing.T) (*gorm.DB, *storage.Game) {
+	t.Helper()
+	db, g := storetest.NewGame(t, "Night Train", 6)
+
+	s1 := &storage.Scene{GameID: g.ID, Number: 1, Type: "expected"}
+	s2 := &storage.Scene{GameID: g.ID, Number: 2, Type: "interrupt"}
+	db.Create(s1)
+	// Scene 1 has ended: a game has a single active scene.
+	db.Model(s1).Update("is_active", false)
+	db.Create(s2)
+	minute := 0
+	log := func(scene *storage.Scene, p storage.LogPayload) {
+		minute++
+		l, err := storage.NewLogEntry(g.ID, "entry", p)
+		if err != nil {
+			t.Fatalf("NewLogEntry: %v", err)
+		}
+		l.CreatedAt = start.Add(time.Duration(minute) * time.Minute)
+		if scene != nil {
+			l.SceneID = &scene.ID
+		}
+		db.Create(l)
+	}
+	log(s1, &storage.SceneStartPayload{Number: 1, Type: "expected", ChaosDie: 7, Chaos: 5})
+	// fifty fifty at chaos 4 is 50: 1-10 exceptional yes, 11-50 yes, 51-90 no, 91-100 exceptional no.
+	log(s1, &storage.FateQuestionPayload{Odds: "fifty fifty", Chaos: 4, Threshold: 50, Roll: 5, Answer: "Exceptional Yes"})
+	log(s1, (&storage.FateQuestionPayload{Odds: "fifty fifty", Chaos: 4, Roll: 60, Answer: "No"}).AskedBy(&storage.Player{Name: "Ana"}))
+	log(s1, &storage.FateQuestionPayload{Odds: "likely", Chaos: 4, Roll: 44, Answer: "Yes", Event: "NPC Action: Guide Power"})
+	log(s1, &storage.SceneEndPayload{Number: 1, ChaosFrom: 5, ChaosTo: 6})
+	log(s2, &storage.SceneStartPayload{Number: 2, Type: "interrupt", ChaosDie: 3, Chaos: 6})
+	log(s2, &storage.RandomEventPayload{Focus: "NPC Action", Action: "Guide", Subject: "Power", Text: "NPC Action: Guide Power"})
+	log(s2, &storage.RandomEventPayload{Focus: "PC Negative", Actions: []string{"Betray", "Power"}, Descriptors: []string{"Quietly"}, Text: "PC Negative"})
+	log(nil, &storage.ChaosChangePayload{From: 6, To: 4})
+
+	storetest.AddThreads(t, db, g.ID,
+		storage.Thread{Name: "Reach the capital"},
+		storage.Thread{Name: "Find the thief", Status: "resolved"},
+		storage.Thread{Name: "Pay the debt", Status: "resolved"},
+	)
+	return db, g
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBuild(t *testing.T) {
+	db, g := newStatsGame(t)
+	r, err := Build(db, g.ID, Options{TopWords: 2})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if r.Questions != 3 || len(r.Odds) != 2 || r.Odds[0].Odds != "fifty fifty" || r.Odds[1].Odds != "likely" {
+		t.Fatalf("odds = %+v", r.Odds)
+	}
+	ff := r.Odds[0]
+	if ff.ExceptionalYes != 1 || ff.No != 1 || !near(ff.Actual.Yes, 0.5) || !near(ff.Actual.Exceptional, 0.5) {
+		t.Fatalf("fifty fifty = %+v", ff)
+	}
+	// The threshold missing from the second question is looked up on the Fate Chart.
+	if !near(ff.Expected.Yes, 0.5) || !near(ff.Expected.No, 0.5) || !near(ff.Expected.Exceptional, 0.2) {
+		t.Fatalf("fifty fifty expected = %+v", ff.Expected)
+	}
+	if !near(r.Odds[1].Expected.Yes, 0.75) || r.Overall.Questions != 3 || !near(r.Overall.Actual.Yes, 2.0/3) {
+		t.Fatalf("likely = %+v, overall = %+v", r.Odds[1], r.Overall)
+	}
+
+	if p := r.Players; len(p) != 1 || p[0].Name != "Ana" || p[0].Count != 1 {
+		t.Fatalf("players = %+v", p)
+	}
+
+	e := r.Events
+	if e.Total != 3 || e.FromQuestions != 1 || !near(e.PerQuestion, 1.0/3) || !near(e.ExpectedPerQuestion, 0.04) || !near(e.PerScene, 1.5) {
+		t.Fatalf("events = %+v", e)
+	}
+	if len(e.Focus) != 2 || e.Focus[0].Name != "NPC Action" || e.Focus[0].Count != 2 {
+		t.Fatalf("event focus = %+v", e.Focus)
+	}
+
+	c := r.Chaos
+	if len(c.Timeline) != 4 || c.Current != 6 || c.Min != 4 || c.Max != 6 || !near(c.Average, 5.25) {
+		t.Fatalf("chaos = %+v", c)
+	}
+	if p := c.Timeline[3]; p.Reason != "change" || p.Scene != 0 || p.Chaos != 4 {
+		t.Fatalf("chaos change = %+v", p)
+	}
+
+	var types []string
+	for _, c := range r.SceneTypes {
+		types = append(types, fmt.Sprintf("%s=%d", c.Name, c.Count))
+	}
+	if got := strings.Join(types, " "); got != "expected=1 altered=0 interrupt=1" {
+		t.Fatalf("scene types = %s", got)
+	}
+	if th := r.Threads; th.Opened != 3 || th.Closed != 2 || th.Open != 1 || !near(th.ClosedPerScene, 1) {
+		t.Fatalf("threads = %+v", th)
+	}
+	if w := r.MeaningWords; len(w) != 2 || w[0].Name != "Power" || w[0].Count != 2 || w[1].Name != "Betray" {
+		t.Fatalf("meaning words = %+v", w)
+	}
+}
+
+func TestRender(t *testing.T) {
+	db, g := newStatsGame(t)
+	r, err := Build(db, g.ID, Options{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	var text, md, js bytes.Buffer
+	if err := r.Text(&text); err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	if err := r.Markdown(&md); err != nil {
+		t.Fatalf("Markdown: %v", err)
+	}
+	if err := r.JSON(&js); err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+	for _, want := range []string{"Night Train: campaign statistics", "fifty fifty  2", "50% / 50%", "Threads: 3 opened, 2 closed, 1 open"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report missing %q:\n%s", want, text.String())
+		}
+	}
+	for _, want := range []string{"# Night Train: Campaign Statistics", "| fifty fifty | 2 | 50% (50%) | 50% (50%) | 50% (20%) |", "| NPC Action | 2 | 67% |", "| interrupt | 1 | 50% |"} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("Markdown report missing %q:\n%s", want, md.String())
+		}
+	}
+	var decoded Report
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("JSON report does not decode: %v", err)
+	}
+	if decoded.Questions != 3 || len(decoded.Chaos.Timeline) != 4 || decoded.Events.Focus[0].Name != "NPC Action" {
+		t.Fatalf("decoded JSON report = %+v", decoded)
+	}
+}
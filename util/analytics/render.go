@@ -0,0 +1,166 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
+// JSON writes the report as indented JSON.
+func (r *Report) JSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Text writes the report as plain text with aligned columns.
+func (r *Report) Text(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "%s: campaign statistics\n", r.Game)
+	fmt.Fprintf(b, "%d scenes, %d fate questions\n", r.Scenes, r.Questions)
+
+	b.WriteString("\nFate questions (actual / expected)\n")
+	if r.Questions == 0 {
+		b.WriteString("  None asked.\n")
+	} else {
+		tw := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  ODDS\tASKED\tYES\tNO\tEXCEPTIONAL")
+		for _, o := range append(slices.Clip(r.Odds), r.Overall) {
+			fmt.Fprintf(tw, "  %s\t%d\t%s / %s\t%s / %s\t%s / %s\n", o.Odds, o.Questions,
+				percent(o.Actual.Yes), percent(o.Expected.Yes),
+				percent(o.Actual.No), percent(o.Expected.No),
+				percent(o.Actual.Exceptional), percent(o.Expected.Exceptional))
+		}
+		tw.Flush()
+	}
+	if len(r.Players) > 0 {
+		b.WriteString("\nFate questions by player\n")
+		writeCounts(b, r.Players)
+	}
+
+	e := r.Events
+	fmt.Fprintf(b, "\nRandom events: %d, %.1f per scene\n", e.Total, e.PerScene)
+	if r.Questions > 0 {
+		fmt.Fprintf(b, "  From fate questions: %d, %s of questions (expected %s)\n",
+			e.FromQuestions, percent(e.PerQuestion), percent(e.ExpectedPerQuestion))
+	}
+	writeCounts(b, e.Focus)
+
+	c := r.Chaos
+	fmt.Fprintf(b, "\nChaos factor: now %d, range %d-%d, average %.1f\n", c.Current, c.Min, c.Max, c.Average)
+	for _, p := range c.Timeline {
+		fmt.Fprintf(b, "  %s  %-12s %s %d\n", p.Time.Local().Format("2006-01-02 15:04"), p.Reason, sceneLabel(p.Scene), p.Chaos)
+	}
+
+	b.WriteString("\nScene types\n")
+	writeCounts(b, r.SceneTypes)
+
+	t := r.Threads
+	fmt.Fprintf(b, "\nThreads: %d opened, %d closed, %d open\n", t.Opened, t.Closed, t.Open)
+	fmt.Fprintf(b, "  Per scene: %.2f opened, %.2f closed\n", t.OpenedPerScene, t.ClosedPerScene)
+
+	b.WriteString("\nMost used meaning words\n")
+	writeCounts(b, r.MeaningWords)
+	return b.Flush()
+}
+
+func writeCounts(w io.Writer, list []Count) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "  None.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range list {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\n", c.Name, c.Count, percent(c.Share))
+	}
+	tw.Flush()
+}
+
+func sceneLabel(n int) string {
+	if n == 0 {
+		return "between scenes:"
+	}
+	return fmt.Sprintf("scene %d:", n)
+}
+
+// Markdown writes the report as Markdown, with tables.
+func (r *Report) Markdown(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# %s: Campaign Statistics\n\n", r.Game)
+	fmt.Fprintf(b, "%d scenes, %d fate questions.\n\n", r.Scenes, r.Questions)
+
+	b.WriteString("## Fate questions\n\nActual rates, with the rates the Fate Chart gives in brackets.\n\n")
+	if r.Questions == 0 {
+		b.WriteString("None asked.\n\n")
+	} else {
+		b.WriteString("| Odds | Asked | Yes | No | Exceptional |\n|---|--:|--:|--:|--:|\n")
+		for _, o := range append(slices.Clip(r.Odds), r.Overall) {
+			name := o.Odds
+			if name == r.Overall.Odds {
+				name = "**" + name + "**"
+			}
+			fmt.Fprintf(b, "| %s | %d | %s (%s) | %s (%s) | %s (%s) |\n", name, o.Questions,
+				percent(o.Actual.Yes), percent(o.Expected.Yes),
+				percent(o.Actual.No), percent(o.Expected.No),
+				percent(o.Actual.Exceptional), percent(o.Expected.Exceptional))
+		}
+		b.WriteString("\n")
+	}
+	if len(r.Players) > 0 {
+		markdownCounts(b, "Player", r.Players)
+	}
+
+	e := r.Events
+	fmt.Fprintf(b, "## Random events\n\n%d random events, %.1f per scene.", e.Total, e.PerScene)
+	if r.Questions > 0 {
+		fmt.Fprintf(b, " %d raised by fate questions, %s of questions (expected %s).",
+			e.FromQuestions, percent(e.PerQuestion), percent(e.ExpectedPerQuestion))
+	}
+	b.WriteString("\n\n")
+	markdownCounts(b, "Focus", e.Focus)
+
+	c := r.Chaos
+	fmt.Fprintf(b, "## Chaos factor\n\nNow %d, ranging from %d to %d, %.1f on average.\n\n", c.Current, c.Min, c.Max, c.Average)
+	if len(c.Timeline) > 0 {
+		b.WriteString("| When | Scene | Reason | Chaos |\n|---|--:|---|--:|\n")
+		for _, p := range c.Timeline {
+			scene := "-"
+			if p.Scene > 0 {
+				scene = fmt.Sprint(p.Scene)
+			}
+			fmt.Fprintf(b, "| %s | %s | %s | %d |\n", p.Time.Local().Format("2006-01-02 15:04"), scene, p.Reason, p.Chaos)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Scene types\n\n")
+	markdownCounts(b, "Type", r.SceneTypes)
+
+	t := r.Threads
+	fmt.Fprintf(b, "## Threads\n\n%d opened and %d closed, %d still open. Per scene, %.2f opened and %.2f closed.\n\n",
+		t.Opened, t.Closed, t.Open, t.OpenedPerScene, t.ClosedPerScene)
+
+	b.WriteString("## Meaning words\n\n")
+	markdownCounts(b, "Word", r.MeaningWords)
+	return b.Flush()
+}
+
+func markdownCounts(w io.Writer, heading string, list []Count) {
+	if len(list) == 0 {
+		fmt.Fprint(w, "None.\n\n")
+		return
+	}
+	fmt.Fprintf(w, "| %s | Count | Share |\n|---|--:|--:|\n", heading)
+	for _, c := range list {
+		fmt.Fprintf(w, "| %s | %d | %s |\n", strings.ReplaceAll(c.Name, "|", `\|`), c.Count, percent(c.Share))
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,179 @@
+// Package character crafts NPC profiles from the Mythic element tables,
+// following the Adventure Crafter's character crafting.
+package character
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util/elements"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Depth controls how many element tables are rolled for a profile.
+type Depth int
+
+const (
+	// DepthBasic rolls a name, identity and descriptors.
+	DepthBasic Depth = iota
+	// DepthStandard adds personality and motivations.
+	DepthStandard
+	// DepthFull adds traits and flaws, appearance, background and skills.
+	DepthFull
+)
+
+// table is an element table rolled for a profile section.
+type table struct {
+	label string
+	words []string
+	depth Depth
+}
+
+// tables lists the profile sections in the order they are rolled.
+var tables = []table{
+	{"Identity", elements.CharacterIdentityTable, DepthBasic},
+	{"Descriptors", elements.CharacterDescriptors, DepthBasic},
+	{"Personality", elements.CharacterPersonalityTable, DepthStandard},
+	{"Motivations", elements.CharacterMotivationsTable, DepthStandard},
+	{"Traits & Flaws", elements.CharacterTraitsFlawsTable, DepthFull},
+	{"Appearance", elements.CharacterAppearanceTable, DepthFull},
+	{"Background", elements.CharacterBackgroundTable, DepthFull},
+	{"Skills", elements.CharacterSkillsTable, DepthFull},
+}
+
+// Roll is a single roll on an element table.
+type Roll struct {
+	Table  string `json:"table"`  // The table rolled on
+	Roll   int    `json:"roll"`   // The d100 roll
+	Result string `json:"result"` // The table entry for the roll
+}
+
+// Section is one part of a profile, such as its identity or motivations.
+type Section struct {
+	Label string
+	Words []string
+}
+
+// Profile is a crafted NPC.
+type Profile struct {
+	Name     string
+	Sections []Section
+	Rolls    []Roll // Every roll that produced the profile, in order
+}
+
+// Options configures Craft.
+type Options struct {
+	Depth Depth  // Which tables to roll
+	Name  string // Name to use instead of rolling one
+	Words int    // Words rolled per section, 2 when zero
+}
+
+// Craft rolls a new NPC profile.
+func Craft(opts Options) *Profile {
+	p := &Profile{Name: strings.TrimSpace(opts.Name)}
+	words := opts.Words
+	if words <= 0 {
+		words = 2
+	}
+	if p.Name == "" {
+		p.Name = p.rollName()
+	}
+	for _, t := range tables {
+		if t.depth > opts.Depth {
+			continue
+		}
+		s := Section{Label: t.label}
+		for range words {
+			s.Words = append(s.Words, p.roll(t.label, t.words))
+		}
+		p.Sections = append(p.Sections, s)
+	}
+	return p
+}
+
+// rollName builds a name from two or three rolls on the Names table.
+func (p *Profile) rollName() string {
+	var sb strings.Builder
+	for range rand.Intn(2) + 2 {
+		sb.WriteString(p.roll("Names", elements.NamesTable))
+	}
+	name := strings.ToLower(sb.String())
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (p *Profile) roll(label string, words []string) string {
+	roll := rand.Intn(len(words)) + 1
+	result := words[roll-1]
+	p.Rolls = append(p.Rolls, Roll{Table: label, Roll: roll, Result: result})
+	return result
+}
+
+// Section returns the words of the labelled section, or nil.
+func (p *Profile) Section(label string) []string {
+	for _, s := range p.Sections {
+		if s.Label == label {
+			return s.Words
+		}
+	}
+	return nil
+}
+
+// Notes renders the profile sections, one per line.
+func (p *Profile) Notes() string {
+	lines := make([]string, len(p.Sections))
+	for i, s := range p.Sections {
+		lines[i] = fmt.Sprintf("%s: %s", s.Label, strings.Join(s.Words, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Character converts the profile into a storage.Character for the game, with
+// the identity and descriptors as its description, the profile as its notes
+// and the rolls kept in CraftRolls.
+func (p *Profile) Character(gameID uuid.UUID) (*storage.Character, error) {
+	rolls, err := json.Marshal(p.Rolls)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.Character{
+		GameID:      gameID,
+		Name:        p.Name,
+		Description: strings.Join(append(p.Section("Descriptors"), p.Section("Identity")...), " "),
+		Weight:      1,
+		Status:      "active",
+		Notes:       p.Notes(),
+		CraftRolls:  string(rolls),
+	}, nil
+}
+
+// Save stores the profile as a character on the game's Characters List,
+// recording it in the game's history.
+func (p *Profile) Save(db *gorm.DB, gameID uuid.UUID) (*storage.Character, error) {
+	c, err := p.Character(gameID)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Record(db, gameID, "Add character "+c.Name, func(tx *gorm.DB, rec *storage.Recorder) error {
+		return rec.Create(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Rolls decodes the rolls kept on a crafted character.
+func Rolls(c *storage.Character) ([]Roll, error) {
+	if c.CraftRolls == "" {
+		return nil, nil
+	}
+	var rolls []Roll
+	if err := json.Unmarshal([]byte(c.CraftRolls), &rolls); err != nil {
+		return nil, fmt.Errorf("decode craft rolls for %s: %w", c.Name, err)
+	}
+	return rolls, nil
+}
@@ -0,0 +1,75 @@
+package character
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+)
+
+func TestCraftDepth(t *testing.T) {
+	tests := []struct {
+		depth    Depth
+		sections int
+	}{
+		{DepthBasic, 2},
+		{DepthStandard, 4},
+		{DepthFull, 8},
+	}
+	for _, tt := range tests {
+		p := Craft(Options{Depth: tt.depth})
+		if p.Name == "" {
+			t.Fatalf("depth %d: profile has no name", tt.depth)
+		}
+		if len(p.Sections) != tt.sections {
+			t.Fatalf("depth %d: got %d sections, want %d", tt.depth, len(p.Sections), tt.sections)
+		}
+		for _, s := range p.Sections {
+			if len(s.Words) != 2 {
+				t.Errorf("section %s has %d words, want 2", s.Label, len(s.Words))
+			}
+		}
+		if nameRolls := len(p.Rolls) - 2*tt.sections; nameRolls < 2 || nameRolls > 3 {
+			t.Errorf("depth %d: unexpected number of name rolls %d", tt.depth, nameRolls)
+		}
+	}
+}
+
+func TestCraftOptions(t *testing.T) {
+	p := Craft(Options{Depth: DepthBasic, Name: "Vesna", Words: 3})
+	if p.Name != "Vesna" || len(p.Rolls) != 6 || len(p.Section("Identity")) != 3 {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+}
+
+func TestProfileSave(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	p := Craft(Options{Depth: DepthFull})
+	c, err := p.Save(db, game.ID)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var stored storage.Character
+	if err := db.First(&stored, "id = ?", c.ID).Error; err != nil {
+		t.Fatalf("load character: %v", err)
+	}
+	if stored.Name != p.Name || !strings.Contains(stored.Notes, "Motivations: ") {
+		t.Fatalf("unexpected character: %+v", stored)
+	}
+	rolls, err := Rolls(&stored)
+	if err != nil {
+		t.Fatalf("Rolls: %v", err)
+	}
+	if len(rolls) != len(p.Rolls) || rolls[0] != p.Rolls[0] {
+		t.Fatalf("rolls not retained: %+v", rolls)
+	}
+
+	if _, err := storage.Undo(db, game.ID); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if err := db.First(&storage.Character{}, "id = ?", c.ID).Error; err == nil {
+		t.Fatalf("undone character still on the list")
+	}
+}
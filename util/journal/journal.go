@@ -0,0 +1,192 @@
+// Package journal turns a game's scenes and log into a readable campaign
+// journal, rendered as Markdown or standalone HTML.
+package journal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Entry kinds, worked out from the log entry's kind and payload.
+const (
+	KindNarration    = "narration"     // Story text and prompts
+	KindFateQuestion = "fate_question" // A Fate Chart roll
+	KindEvent        = "event"         // A random event
+	KindDiceRoll     = "dice_roll"     // Any other roll
+)
+
+// Options selects the part of the game to include. Zero values are unbounded.
+type Options struct {
+	From, To              time.Time // Only entries logged within this time range
+	FirstScene, LastScene int       // Only these scenes; entries between scenes are left out
+}
+
+func (o Options) sceneRange() bool {
+	return o.FirstScene > 0 || o.LastScene > 0
+}
+
+func (o Options) inScenes(number int) bool {
+	return number >= o.FirstScene && (o.LastScene == 0 || number <= o.LastScene)
+}
+
+func (o Options) inDates(t time.Time) bool {
+	return (o.From.IsZero() || !t.Before(o.From)) && (o.To.IsZero() || !t.After(o.To))
+}
+
+// Entry is a log entry with its kind. Fate questions have Odds, Roll and
+// Answer set; fate questions that raised an event and events have Event set.
+type Entry struct {
+	storage.LogEntry
+	Kind   string
+	Odds   string
+	Roll   string
+	Answer string
+	Event  string
+	Player string // Who asked a fate question, in group play
+}
+
+// Section is a scene and its entries. Scene is nil for entries logged
+// between scenes.
+type Section struct {
+	Scene   *storage.Scene
+	Entries []Entry
+}
+
+// Title returns the section heading.
+func (s Section) Title() string {
+	if s.Scene == nil {
+		return "Between scenes"
+	}
+	if s.Scene.Title == "" {
+		return fmt.Sprintf("Scene %d", s.Scene.Number)
+	}
+	return fmt.Sprintf("Scene %d: %s", s.Scene.Number, s.Scene.Title)
+}
+
+// Journal is a game's story, grouped by scene, with its lists as an appendix.
+type Journal struct {
+	Game       storage.Game
+	Options    Options
+	Sections   []Section
+	Threads    []storage.Thread
+	Characters []storage.Character
+}
+
+// Build reads the game's scenes, log and lists for the journal.
+func Build(db *gorm.DB, gameID uuid.UUID, opts Options) (*Journal, error) {
+	j := &Journal{Options: opts}
+	if err := db.First(&j.Game, "id = ?", gameID).Error; err != nil {
+		return nil, err
+	}
+
+	var scenes []storage.Scene
+	if err := db.Where("game_id = ?", gameID).Order("number").Find(&scenes).Error; err != nil {
+		return nil, err
+	}
+	q := db.Where("game_id = ?", gameID)
+	if !opts.From.IsZero() {
+		q = q.Where("created_at >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		q = q.Where("created_at <= ?", opts.To)
+	}
+	var log []storage.LogEntry
+	if err := q.Order("created_at").Find(&log).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&j.Threads).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&j.Characters).Error; err != nil {
+		return nil, err
+	}
+
+	j.Sections = group(scenes, log, opts)
+	return j, nil
+}
+
+// group puts entries under their scenes, in the order the scenes started.
+// Consecutive entries logged between scenes form a section of their own.
+func group(scenes []storage.Scene, log []storage.LogEntry, opts Options) []Section {
+	var sections []Section
+	byScene := map[uuid.UUID]int{}
+	for i := range scenes {
+		s := &scenes[i]
+		if opts.sceneRange() && !opts.inScenes(s.Number) {
+			continue
+		}
+		byScene[s.ID] = len(sections)
+		sections = append(sections, Section{Scene: s})
+	}
+
+	var loose []Section
+	for i, l := range log {
+		if l.SceneID == nil {
+			if opts.sceneRange() {
+				continue
+			}
+			if i == 0 || log[i-1].SceneID != nil {
+				loose = append(loose, Section{})
+			}
+			loose[len(loose)-1].Entries = append(loose[len(loose)-1].Entries, classify(l))
+			continue
+		}
+		if i, ok := byScene[*l.SceneID]; ok {
+			sections[i].Entries = append(sections[i].Entries, classify(l))
+		}
+	}
+
+	// Leave out scenes with nothing in the date range.
+	if !opts.From.IsZero() || !opts.To.IsZero() {
+		sections = slices.DeleteFunc(sections, func(s Section) bool {
+			return len(s.Entries) == 0 && !opts.inDates(s.Scene.CreatedAt)
+		})
+	}
+	sections = append(sections, loose...)
+	slices.SortStableFunc(sections, func(a, b Section) int {
+		return sectionStart(a).Compare(sectionStart(b))
+	})
+	return sections
+}
+
+func sectionStart(s Section) time.Time {
+	if len(s.Entries) > 0 {
+		return s.Entries[0].CreatedAt
+	}
+	return s.Scene.CreatedAt
+}
+
+// classify works out the journal kind of a log entry from its kind and
+// payload. Fate questions without a payload are shown as narration.
+func classify(l storage.LogEntry) Entry {
+	e := Entry{LogEntry: l, Kind: KindNarration}
+	p, _ := l.DecodePayload()
+	switch l.Type {
+	case storage.LogFateQuestion:
+		if q, ok := p.(*storage.FateQuestionPayload); ok {
+			e.Kind, e.Odds, e.Roll, e.Answer, e.Event = KindFateQuestion, q.Odds, strconv.Itoa(q.Roll), q.Answer, q.Event
+			e.Player = q.Player
+		}
+	case storage.LogRandomEvent:
+		e.Kind, e.Event = KindEvent, strings.TrimPrefix(l.Msg, "Random event: ")
+		if ev, ok := p.(*storage.RandomEventPayload); ok {
+			e.Event = ev.Text
+		}
+	case storage.LogDiceRoll, storage.LogSceneStart:
+		e.Kind = KindDiceRoll
+	}
+	return e
+}
+
+// Filename returns a file name for the journal with the given extension,
+// such as ".md" or ".html".
+func (j *Journal) Filename(ext string) string {
+	return storage.SanitizeFilename(j.Game.Name+" journal") + ext
+}
@@ -0,0 +1,153 @@
+package journal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"gorm.io/gorm"
+)
+
+var start = time.Date(2026, 3, 1, 19, 0, 0, 0, time.UTC)
+
+func newJournalGame(t *testing.T) (*gorm.DB, *storage.Game) {
+	t.Helper()
+	db, g := storetest.NewGame(t, "Night Train", 5)
+
+	s1 := &storage.Scene{GameID: g.ID, Number: 1, Title: "Departure", ExpectedConcept: "Boarding", Summary: "We made it aboard.", CreatedAt: start.Add(time.Minute)}
+	s2 := &storage.Scene{GameID: g.ID, Number: 2, Title: "Dining car", CreatedAt: start.Add(time.Hour)}
+	db.Create(s1)
+	// Scene 1 has ended: a game has a single active scene.
+	db.Model(s1).Update("is_active", false)
+	db.Create(s2)
+	logAt := func(minutes int, scene *storage.Scene, msg string, p storage.LogPayload) {
+		l := &storage.LogEntry{GameID: g.ID, Msg: msg, CreatedAt: start.Add(time.Duration(minutes) * time.Minute)}
+		if p != nil {
+			if err := l.SetPayload(p); err != nil {
+				t.Fatalf("SetPayload: %v", err)
+			}
+		}
+		if scene != nil {
+			l.SceneID = &scene.ID
+		}
+		db.Create(l)
+	}
+	logAt(0, nil, "Prologue", nil)
+	logAt(2, s1, "likely - 42: Yes ", &storage.FateQuestionPayload{Odds: "likely", Chaos: 5, Roll: 42, Answer: "Yes"})
+	logAt(3, s1, "Random event: NPC Action: Guide Power", &storage.RandomEventPayload{Focus: "NPC Action", Text: "NPC Action: Guide Power"})
+	logAt(4, s1, "4dF: +2", &storage.DiceRollPayload{Dice: "4dF", Rolls: []int{1, 1, 0, 0}, Total: 2})
+	logAt(5, s1, "fifty fifty - 33: Exceptional No | Event: PC Negative: Harm <Trap>",
+		(&storage.FateQuestionPayload{Odds: "fifty fifty", Chaos: 5, Roll: 33, Answer: "Exceptional No", Event: "PC Negative: Harm <Trap>"}).
+			AskedBy(&storage.Player{Name: "Ana"}))
+	logAt(30, nil, "Intermission", nil)
+	logAt(61, s2, "The stranger sits down.", nil)
+
+	storetest.AddThreads(t, db, g.ID, storage.Thread{Name: "Reach the capital", Description: "Before dawn"})
+	storetest.AddCharacters(t, db, g.ID, storage.Character{Name: "Vera", IsPlayer: true})
+	return db, g
+}
+
+func TestBuildGroupsByScene(t *testing.T) {
+	db, g := newJournalGame(t)
+	j, err := Build(db, g.ID, Options{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	var titles []string
+	for _, s := range j.Sections {
+		titles = append(titles, s.Title())
+	}
+	want := "Between scenes|Scene 1: Departure|Between scenes|Scene 2: Dining car"
+	if got := strings.Join(titles, "|"); got != want {
+		t.Fatalf("sections = %q, want %q", got, want)
+	}
+
+	entries := j.Sections[1].Entries
+	kinds := []string{KindFateQuestion, KindEvent, KindDiceRoll, KindFateQuestion}
+	for i, k := range kinds {
+		if entries[i].Kind != k {
+			t.Fatalf("entry %d %q is %s, want %s", i, entries[i].Msg, entries[i].Kind, k)
+		}
+	}
+	if e := entries[0]; e.Odds != "likely" || e.Roll != "42" || e.Answer != "Yes" || e.Event != "" {
+		t.Fatalf("fate question = %+v", e)
+	}
+	if e := entries[3]; e.Answer != "Exceptional No" || e.Event != "PC Negative: Harm <Trap>" || e.Player != "Ana" {
+		t.Fatalf("fate question with event = %+v", e)
+	}
+}
+
+func TestBuildRanges(t *testing.T) {
+	db, g := newJournalGame(t)
+	j, err := Build(db, g.ID, Options{FirstScene: 2})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(j.Sections) != 1 || j.Sections[0].Scene.Number != 2 {
+		t.Fatalf("scene range sections = %+v", j.Sections)
+	}
+
+	j, err = Build(db, g.ID, Options{From: start.Add(4 * time.Minute), To: start.Add(45 * time.Minute)})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(j.Sections) != 2 || len(j.Sections[0].Entries) != 2 || j.Sections[1].Entries[0].Msg != "Intermission" {
+		t.Fatalf("date range sections = %+v", j.Sections)
+	}
+}
+
+func TestRender(t *testing.T) {
+	db, g := newJournalGame(t)
+	j, err := Build(db, g.ID, Options{LastScene: 1})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	var md bytes.Buffer
+	if err := j.Markdown(&md); err != nil {
+		t.Fatalf("Markdown: %v", err)
+	}
+	for _, want := range []string{
+		"# Night Train: Campaign Journal",
+		"_Covering up to scene 1._",
+		"## Scene 1: Departure",
+		"> **Fate question** (likely, rolled 42): **Yes**",
+		"**Random event:** NPC Action: Guide Power",
+		"> **Fate question** (fifty fifty, rolled 33, asked by Ana): **Exceptional No**",
+		"`4dF: +2`",
+		"_Summary: We made it aboard._",
+		"- **Reach the capital** (active, weight 1): Before dawn",
+		"- **Vera** (player character, active, weight 1)",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Fatalf("Markdown missing %q:\n%s", want, md.String())
+		}
+	}
+
+	var html bytes.Buffer
+	if err := j.HTML(&html); err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		`<div class="entry fate_question">`,
+		"Harm &lt;Trap&gt;",
+		"rolled 33, asked by Ana)",
+		`<div class="entry dice_roll">4dF: &#43;2</div>`,
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Fatalf("HTML missing %q:\n%s", want, html.String())
+		}
+	}
+
+	if got := j.Filename(".md"); got != "Night Train journal.md" {
+		t.Fatalf("Filename = %q", got)
+	}
+	j.Game.Name = "A/B"
+	if got := j.Filename(".html"); got != "A-B journal.html" {
+		t.Fatalf("Filename = %q", got)
+	}
+}
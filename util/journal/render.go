@@ -0,0 +1,110 @@
+package journal
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+//go:embed journal.html.tmpl
+var htmlTemplateText string
+
+var htmlTemplate = template.Must(template.New("journal").Parse(htmlTemplateText))
+
+// Describe returns a line describing the selected range, or "" for the whole game.
+func (o Options) Describe() string {
+	var parts []string
+	switch {
+	case o.FirstScene > 0 && o.LastScene > 0:
+		parts = append(parts, fmt.Sprintf("scenes %d to %d", o.FirstScene, o.LastScene))
+	case o.FirstScene > 0:
+		parts = append(parts, fmt.Sprintf("from scene %d", o.FirstScene))
+	case o.LastScene > 0:
+		parts = append(parts, fmt.Sprintf("up to scene %d", o.LastScene))
+	}
+	const date = "2006-01-02 15:04"
+	if !o.From.IsZero() {
+		parts = append(parts, "from "+o.From.Format(date))
+	}
+	if !o.To.IsZero() {
+		parts = append(parts, "until "+o.To.Format(date))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Covering " + strings.Join(parts, ", ") + "."
+}
+
+// Markdown writes the journal as Markdown.
+func (j *Journal) Markdown(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# %s: Campaign Journal\n\n", j.Game.Name)
+	if d := j.Options.Describe(); d != "" {
+		fmt.Fprintf(b, "_%s_\n\n", d)
+	}
+
+	for _, s := range j.Sections {
+		fmt.Fprintf(b, "## %s\n\n", s.Title())
+		if s.Scene != nil && s.Scene.ExpectedConcept != "" {
+			fmt.Fprintf(b, "_Expected scene: %s_\n\n", s.Scene.ExpectedConcept)
+		}
+		for _, e := range s.Entries {
+			switch e.Kind {
+			case KindFateQuestion:
+				asked := ""
+				if e.Player != "" {
+					asked = ", asked by " + e.Player
+				}
+				fmt.Fprintf(b, "> **Fate question** (%s, rolled %s%s): **%s**\n", e.Odds, e.Roll, asked, e.Answer)
+				if e.Event != "" {
+					fmt.Fprintf(b, ">\n> **Random event:** %s\n", e.Event)
+				}
+			case KindEvent:
+				fmt.Fprintf(b, "**Random event:** %s\n", e.Event)
+			case KindDiceRoll:
+				fmt.Fprintf(b, "`%s`\n", e.Msg)
+			default:
+				fmt.Fprintf(b, "%s\n", e.Msg)
+			}
+			b.WriteString("\n")
+		}
+		if s.Scene != nil && s.Scene.Summary != "" {
+			fmt.Fprintf(b, "_Summary: %s_\n\n", s.Scene.Summary)
+		}
+	}
+
+	b.WriteString("## Appendix\n\n### Threads\n\n")
+	if len(j.Threads) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, t := range j.Threads {
+		fmt.Fprintf(b, "- **%s** (%s, weight %d)%s\n", t.Name, t.Status, t.Weight, suffix(t.Description))
+	}
+	b.WriteString("\n### Characters\n\n")
+	if len(j.Characters) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, c := range j.Characters {
+		kind := ""
+		if c.IsPlayer {
+			kind = "player character, "
+		}
+		fmt.Fprintf(b, "- **%s** (%s%s, weight %d)%s\n", c.Name, kind, c.Status, c.Weight, suffix(c.Description))
+	}
+	return b.Flush()
+}
+
+// HTML writes the journal as a standalone HTML page.
+func (j *Journal) HTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, j)
+}
+
+func suffix(description string) string {
+	if description == "" {
+		return ""
+	}
+	return ": " + description
+}
@@ -0,0 +1,249 @@
+// Package list rolls on Mythic 2e lists, such as the Threads List and the
+// Characters List. The plot package uses it for the Plotlines List.
+//
+// A list has 25 lines in 5 sections of 5 lines. Items fill one line for each
+// point of Weight, in order. A roll picks a section among those in use, then
+// a line within it with a d10 (1-2 is the first line, 3-4 the second, ...).
+// An empty line means "Choose The Most Logical"; a line holding an inactive
+// item is rolled again.
+package list
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// List dimensions.
+const (
+	Lines        = 25
+	SectionLines = 5
+	Sections     = Lines / SectionLines
+)
+
+// ChooseMostLogical is the result of a roll on an empty line.
+const ChooseMostLogical = "Choose The Most Logical"
+
+// maxRerolls bounds the rerolls for lines holding inactive items.
+const maxRerolls = 50
+
+// ErrEmpty is returned when rolling on a list with no items.
+var ErrEmpty = errors.New("list is empty")
+
+// Item is an entry on a list.
+type Item struct {
+	ID     uuid.UUID
+	Name   string
+	Weight int  // Lines the item fills; less than 1 counts as 1
+	Active bool // Inactive, resolved or concluded items are rolled again
+}
+
+// List is a laid out list. Lines holds up to 25 lines; items that do not fit
+// are left off.
+type List struct {
+	Lines []*Item
+}
+
+// Die is a single die roll.
+type Die struct {
+	Sides int
+	Roll  int
+}
+
+// String returns the die as "d6=4".
+func (d Die) String() string {
+	return fmt.Sprintf("d%d=%d", d.Sides, d.Roll)
+}
+
+// Roll is one roll on a list. Section is the zero Die when only the first
+// section is in use.
+type Roll struct {
+	Section Die
+	Line    Die
+	Number  int   // The line rolled, 1-25
+	Item    *Item // nil for an empty line
+}
+
+// Result is the outcome of rolling on a list, including any rerolls.
+type Result struct {
+	Item  *Item  // The item rolled; nil for Choose The Most Logical
+	Name  string // The item's name, or ChooseMostLogical
+	Line  int    // The line of the final roll
+	Rolls []Roll // Every roll made, the last one being the result
+}
+
+// String describes the result and its dice for the game log, e.g.
+// "Find the relic (line 7: d6=2, d10=4)".
+func (r Result) String() string {
+	rolls := make([]string, len(r.Rolls))
+	for i, roll := range r.Rolls {
+		dice := roll.Line.String()
+		if roll.Section.Sides > 0 {
+			dice = roll.Section.String() + ", " + dice
+		}
+		rolls[i] = fmt.Sprintf("line %d: %s", roll.Number, dice)
+		if roll.Item != nil && !roll.Item.Active {
+			rolls[i] += " " + roll.Item.Name + ", rerolled"
+		}
+	}
+	return fmt.Sprintf("%s (%s)", r.Name, strings.Join(rolls, "; "))
+}
+
+// New lays out items on a list in order.
+func New(items []Item) *List {
+	l := &List{}
+	for i := range items {
+		for range max(items[i].Weight, 1) {
+			if len(l.Lines) == Lines {
+				return l
+			}
+			l.Lines = append(l.Lines, &items[i])
+		}
+	}
+	return l
+}
+
+// Sections returns the number of sections in use.
+func (l *List) Sections() int {
+	return (len(l.Lines) + SectionLines - 1) / SectionLines
+}
+
+// Roll rolls on the list, rerolling lines that hold inactive items. If only
+// inactive items keep coming up, the result is Choose The Most Logical.
+func (l *List) Roll() (Result, error) {
+	sections := l.Sections()
+	if sections == 0 {
+		return Result{}, ErrEmpty
+	}
+
+	res := Result{Name: ChooseMostLogical}
+	for range maxRerolls {
+		roll := l.rollLine(sections)
+		res.Rolls = append(res.Rolls, roll)
+		res.Line = roll.Number
+		if roll.Item == nil {
+			return res, nil
+		}
+		if roll.Item.Active {
+			res.Item, res.Name = roll.Item, roll.Item.Name
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+// rollLine rolls a section among those in use, then a line within it.
+func (l *List) rollLine(sections int) Roll {
+	var r Roll
+	section := 0
+	switch sections {
+	case 2, 3:
+		// d6 split into equal ranges: 1-3/4-6 or 1-2/3-4/5-6.
+		r.Section = roll(6)
+		section = (r.Section.Roll - 1) / (6 / sections)
+	case 4:
+		r.Section = roll(4)
+		section = r.Section.Roll - 1
+	case 5:
+		r.Section = roll(10)
+		section = (r.Section.Roll - 1) / 2
+	}
+	r.Line = roll(10)
+	r.Number = section*SectionLines + (r.Line.Roll+1)/2
+	if r.Number <= len(l.Lines) {
+		r.Item = l.Lines[r.Number-1]
+	}
+	return r
+}
+
+func roll(sides int) Die {
+	return Die{Sides: sides, Roll: rand.Intn(sides) + 1}
+}
+
+// Threads lays out a Threads List. Threads that are not active are rolled again.
+func Threads(threads []storage.Thread) *List {
+	items := make([]Item, len(threads))
+	for i, t := range threads {
+		items[i] = Item{ID: t.ID, Name: t.Name, Weight: t.Weight, Active: t.Status == "" || t.Status == "active"}
+	}
+	return New(items)
+}
+
+// Characters lays out a Characters List. Inactive characters are rolled again.
+func Characters(characters []storage.Character) *List {
+	items := make([]Item, len(characters))
+	for i, c := range characters {
+		items[i] = Item{ID: c.ID, Name: c.Name, Weight: c.Weight, Active: c.Status == "" || c.Status == "active"}
+	}
+	return New(items)
+}
+
+// NPCs lays out a Characters List on which Player Characters are rolled
+// again, like inactive characters, so that results such as the subject of an
+// NPC Action never land on a PC.
+func NPCs(characters []storage.Character) *List {
+	items := make([]Item, len(characters))
+	for i, c := range characters {
+		items[i] = Item{ID: c.ID, Name: c.Name, Weight: c.Weight, Active: !c.IsPlayer && (c.Status == "" || c.Status == "active")}
+	}
+	return New(items)
+}
+
+// PickPC picks one of the active Player Characters at random, for events
+// that target a PC. It returns nil when the game has no active PCs.
+func PickPC(characters []storage.Character) *storage.Character {
+	var pcs []*storage.Character
+	for i := range characters {
+		c := &characters[i]
+		if c.IsPlayer && (c.Status == "" || c.Status == "active") {
+			pcs = append(pcs, c)
+		}
+	}
+	if len(pcs) == 0 {
+		return nil
+	}
+	return pcs[rand.Intn(len(pcs))]
+}
+
+// RollThreads rolls on the game's Threads List, in order of creation.
+func RollThreads(db *gorm.DB, gameID uuid.UUID) (Result, error) {
+	var threads []storage.Thread
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&threads).Error; err != nil {
+		return Result{}, err
+	}
+	return Threads(threads).Roll()
+}
+
+// RollCharacters rolls on the game's Characters List, in order of creation.
+func RollCharacters(db *gorm.DB, gameID uuid.UUID) (Result, error) {
+	var characters []storage.Character
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&characters).Error; err != nil {
+		return Result{}, err
+	}
+	return Characters(characters).Roll()
+}
+
+// RollNPCs rolls on the game's Characters List, in order of creation,
+// rerolling Player Characters.
+func RollNPCs(db *gorm.DB, gameID uuid.UUID) (Result, error) {
+	var characters []storage.Character
+	if err := db.Where("game_id = ?", gameID).Order("created_at").Find(&characters).Error; err != nil {
+		return Result{}, err
+	}
+	return NPCs(characters).Roll()
+}
+
+// RollPC picks one of the game's active Player Characters. It returns nil
+// when the game has none.
+func RollPC(db *gorm.DB, gameID uuid.UUID) (*storage.Character, error) {
+	var characters []storage.Character
+	if err := db.Where("game_id = ? AND is_player = ?", gameID, true).Order("created_at").Find(&characters).Error; err != nil {
+		return nil, err
+	}
+	return PickPC(characters), nil
+}
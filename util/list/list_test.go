@@ -0,0 +1,148 @@
+package list
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+)
+
+func TestNewLaysOutWeights(t *testing.T) {
+	l := New([]Item{{Name: "A", Weight: 3}, {Name: "B"}, {Name: "C", Weight: 2}})
+	var names []string
+	for _, it := range l.Lines {
+		names = append(names, it.Name)
+	}
+	if got := strings.Join(names, ""); got != "AAABCC" {
+		t.Fatalf("lines = %q, want AAABCC", got)
+	}
+	if l.Sections() != 2 {
+		t.Fatalf("Sections() = %d, want 2", l.Sections())
+	}
+
+	full := New([]Item{{Name: "A", Weight: 20}, {Name: "B", Weight: 10}})
+	if len(full.Lines) != Lines || full.Sections() != Sections {
+		t.Fatalf("list not capped at %d lines: %d", Lines, len(full.Lines))
+	}
+}
+
+func TestRollDice(t *testing.T) {
+	tests := []struct {
+		items    int
+		sections int
+		die      int
+	}{
+		{5, 1, 0},
+		{7, 2, 6},
+		{15, 3, 6},
+		{16, 4, 4},
+		{25, 5, 10},
+	}
+	for _, tt := range tests {
+		items := make([]Item, tt.items)
+		for i := range items {
+			items[i] = Item{Name: "x", Active: true}
+		}
+		l := New(items)
+		for range 200 {
+			res, err := l.Roll()
+			if err != nil {
+				t.Fatalf("Roll: %v", err)
+			}
+			r := res.Rolls[0]
+			if r.Section.Sides != tt.die || r.Line.Sides != 10 {
+				t.Fatalf("%d sections rolled %v and %v", tt.sections, r.Section, r.Line)
+			}
+			if r.Number < 1 || r.Number > tt.sections*SectionLines {
+				t.Fatalf("%d sections rolled line %d", tt.sections, r.Number)
+			}
+			if (r.Number <= tt.items) != (res.Item != nil) {
+				t.Fatalf("line %d of %d gave %+v", r.Number, tt.items, res)
+			}
+			if res.Item == nil && res.Name != ChooseMostLogical {
+				t.Fatalf("empty line gave %q", res.Name)
+			}
+		}
+	}
+}
+
+func TestRollRerollsInactive(t *testing.T) {
+	l := New([]Item{{Name: "Done", Weight: 3}, {Name: "Open", Weight: 2, Active: true}})
+	for range 200 {
+		res, err := l.Roll()
+		if err != nil {
+			t.Fatalf("Roll: %v", err)
+		}
+		if res.Item == nil || res.Name != "Open" {
+			t.Fatalf("Roll = %+v, want Open", res)
+		}
+		for _, r := range res.Rolls[:len(res.Rolls)-1] {
+			if r.Item.Name != "Done" {
+				t.Fatalf("rerolled an active line: %+v", r)
+			}
+		}
+		if len(res.Rolls) > 1 && !strings.Contains(res.String(), "Done, rerolled") {
+			t.Fatalf("String() = %q does not show the reroll", res.String())
+		}
+	}
+
+	all := New([]Item{{Name: "Done", Weight: 5}})
+	if res, _ := all.Roll(); res.Name != ChooseMostLogical || len(res.Rolls) != maxRerolls {
+		t.Fatalf("all inactive: %+v", res)
+	}
+	if _, err := New(nil).Roll(); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("empty list error = %v, want ErrEmpty", err)
+	}
+}
+
+func TestRollThreads(t *testing.T) {
+	db, g := storetest.NewGame(t, "Lists", 5)
+	storetest.AddThreads(t, db, g.ID,
+		storage.Thread{Name: "Resolved", Weight: 3, Status: "resolved"},
+		storage.Thread{Name: "Open", Weight: 2},
+	)
+
+	for range 50 {
+		res, err := RollThreads(db, g.ID)
+		if err != nil {
+			t.Fatalf("RollThreads: %v", err)
+		}
+		if res.Name != "Open" || res.Line < 4 || res.Line > 5 {
+			t.Fatalf("RollThreads = %+v", res)
+		}
+	}
+	if _, err := RollCharacters(db, g.ID); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("RollCharacters on an empty list error = %v, want ErrEmpty", err)
+	}
+}
+
+func TestPlayerCharacters(t *testing.T) {
+	db, g := storetest.NewGame(t, "PCs", 5)
+	storetest.AddCharacters(t, db, g.ID,
+		storage.Character{Name: "Mara", Weight: 3, IsPlayer: true},
+		storage.Character{Name: "Gone", IsPlayer: true, Status: "inactive"},
+		storage.Character{Name: "Guard", Weight: 2},
+	)
+
+	for range 50 {
+		res, err := RollNPCs(db, g.ID)
+		if err != nil {
+			t.Fatalf("RollNPCs: %v", err)
+		}
+		if res.Item != nil && res.Name != "Guard" {
+			t.Fatalf("RollNPCs = %+v, want Guard or an empty line", res)
+		}
+		pc, err := RollPC(db, g.ID)
+		if err != nil {
+			t.Fatalf("RollPC: %v", err)
+		}
+		if pc == nil || pc.Name != "Mara" {
+			t.Fatalf("RollPC = %+v, want Mara", pc)
+		}
+	}
+	if pc := PickPC([]storage.Character{{Name: "Guard"}}); pc != nil {
+		t.Fatalf("PickPC without PCs = %+v, want nil", pc)
+	}
+}
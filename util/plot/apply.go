@@ -0,0 +1,230 @@
+package plot
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Special Characters List results.
+const (
+	NewCharacter               = "New Character"
+	ChooseMostLogicalCharacter = "Choose The Most Logical Character"
+)
+
+// maxMetaRolls bounds the re-rolls on the Meta Plot Points Table.
+const maxMetaRolls = 20
+
+// CharacterChange records one change a meta plot point made to a character.
+// The changes of a meta plot point are recorded as one operation in the
+// game's history; undo them with storage.Undo.
+type CharacterChange struct {
+	CharacterID uuid.UUID
+	Name        string
+	OldWeight   int
+	NewWeight   int
+	OldStatus   string
+	NewStatus   string
+}
+
+// String describes the change for the game log.
+func (c CharacterChange) String() string {
+	return fmt.Sprintf("%s (character %s): weight %d -> %d, status %s -> %s",
+		c.Name, c.CharacterID, c.OldWeight, c.NewWeight, c.OldStatus, c.NewStatus)
+}
+
+// MetaResult is a meta plot point applied to a game's Characters List.
+type MetaResult struct {
+	Meta    *MetaPlotPoint    // The meta plot point that was applied
+	Rolls   []int             // Every d100 roll on the Meta Plot Points Table, including re-rolls
+	Result  string            // The Characters List result: a name, NewCharacter or ChooseMostLogicalCharacter
+	Changes []CharacterChange // Changes made to the Characters List
+}
+
+// RollMetaPlotPoint rolls on the Meta Plot Points Table and applies the result
+// to the game's Characters List. See ApplyMetaPlotPoint.
+func RollMetaPlotPoint(db *gorm.DB, gameID uuid.UUID) (*MetaResult, error) {
+	return ApplyMetaPlotPoint(db, gameID, rand.Intn(100)+1)
+}
+
+// ApplyMetaPlotPoint applies the meta plot point for roll to the game's
+// Characters List, following the text of the Meta Plot Points Table:
+// characters exit, return, step up, step down, upgrade or downgrade by
+// changing their Status and Weight, even past 3 slots. Player Characters are
+// never removed from the list; results that cannot be applied are re-rolled.
+// Every change is written to the game log with its old and new values. The
+// database is snapshotted first, see storage.AutoSnapshot.
+func ApplyMetaPlotPoint(db *gorm.DB, gameID uuid.UUID, roll int) (*MetaResult, error) {
+	res := &MetaResult{}
+	if err := storage.AutoSnapshot(db, "meta plot point"); err != nil {
+		return nil, err
+	}
+	err := storage.Record(db, gameID, "Apply meta plot point", func(tx *gorm.DB, rec *storage.Recorder) error {
+		var characters []storage.Character
+		if err := tx.Where("game_id = ?", gameID).Order("created_at").Find(&characters).Error; err != nil {
+			return err
+		}
+
+		for attempt := 0; ; attempt++ {
+			if attempt == maxMetaRolls {
+				return fmt.Errorf("no applicable meta plot point after %d rolls", maxMetaRolls)
+			}
+			if attempt > 0 {
+				roll = rand.Intn(100) + 1
+			}
+			meta, err := GetMetaPlotPoint(roll)
+			if err != nil {
+				return err
+			}
+			res.Rolls = append(res.Rolls, roll)
+			res.Meta = meta
+			if applied := applyMeta(res, characters); applied {
+				break
+			}
+		}
+
+		name := PlotPointName(res.Meta.Text)
+		msg := fmt.Sprintf("Meta plot point %v: %s (%s)", res.Rolls, name, res.Result)
+		summary, err := storage.NewLogEntry(gameID, msg, &storage.NarrationPayload{Text: msg})
+		if err != nil {
+			return err
+		}
+		entries := []*storage.LogEntry{summary}
+		for _, c := range res.Changes {
+			err := rec.Update(&storage.Character{ID: c.CharacterID}, map[string]any{"weight": c.NewWeight, "status": c.NewStatus})
+			if err != nil {
+				return err
+			}
+			entry, err := storage.NewLogEntry(gameID, fmt.Sprintf("%s: %s", name, c), &storage.ListChangePayload{
+				List: storage.CharactersList, RecordID: c.CharacterID, Name: c.Name, Reason: name,
+				OldWeight: c.OldWeight, NewWeight: c.NewWeight, OldStatus: c.OldStatus, NewStatus: c.NewStatus,
+			})
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		for _, entry := range entries {
+			if err := rec.AddLogEntry(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// applyMeta works out the changes for res.Meta and reports whether it could be
+// applied. A false result means the meta plot point must be re-rolled.
+func applyMeta(res *MetaResult, characters []storage.Character) bool {
+	res.Result, res.Changes = "", nil
+	all := make([]*storage.Character, len(characters))
+	for i := range characters {
+		all[i] = &characters[i]
+	}
+	active := filter(all, func(c *storage.Character) bool { return c.Status == "" || c.Status == "active" })
+
+	switch PlotPointName(res.Meta.Text) {
+	case "CHARACTER EXITS THE ADVENTURE":
+		eligible := filter(active, func(c *storage.Character) bool { return !c.IsPlayer })
+		if len(eligible) == 0 {
+			return false
+		}
+		c := rollCharacter(res, active, eligible)
+		res.Changes = append(res.Changes, change(c, 0, "inactive"))
+	case "CHARACTER RETURNS":
+		removed := filter(all, func(c *storage.Character) bool { return c.Status == "inactive" })
+		if len(removed) == 0 {
+			res.Result = NewCharacter
+			return true
+		}
+		c := removed[rand.Intn(len(removed))]
+		res.Result = c.Name
+		if len(removed) > 1 {
+			res.Result = ChooseMostLogicalCharacter + ": " + c.Name
+		}
+		res.Changes = append(res.Changes, change(c, 1, "active"))
+	case "CHARACTER STEPS UP":
+		return stepCharacter(res, active, 1)
+	case "CHARACTER UPGRADE":
+		return stepCharacter(res, active, 2)
+	case "CHARACTER STEPS DOWN":
+		return stepCharacter(res, active, -1)
+	case "CHARACTER DOWNGRADE":
+		return stepCharacter(res, active, -2)
+	default:
+		res.Result = "no change to the Characters List"
+	}
+	return true
+}
+
+// stepCharacter adds or removes list slots for a rolled character. Removing
+// slots may remove a character from the list completely, unless it is a
+// Player Character. It reports false when no character can be chosen.
+func stepCharacter(res *MetaResult, active []*storage.Character, slots int) bool {
+	eligible := active
+	if slots < 0 {
+		eligible = filter(active, func(c *storage.Character) bool { return !c.IsPlayer || c.Weight+slots > 0 })
+	}
+	if len(eligible) == 0 {
+		return false
+	}
+	c := rollCharacter(res, active, eligible)
+	weight, status := c.Weight+slots, c.Status
+	if weight <= 0 {
+		weight, status = 0, "inactive"
+	}
+	res.Changes = append(res.Changes, change(c, weight, status))
+	return true
+}
+
+// rollCharacter rolls on the Characters List, where each active character
+// fills as many of the 25 lines as its Weight and empty lines are "New
+// Character". Results that are not eligible, including "New Character",
+// become "Choose The Most Logical Character", picked from eligible.
+func rollCharacter(res *MetaResult, active, eligible []*storage.Character) *storage.Character {
+	var lines []*storage.Character
+	for _, c := range active {
+		for range max(c.Weight, 1) {
+			lines = append(lines, c)
+		}
+	}
+	if roll := rand.Intn(max(len(lines), 25)); roll < len(lines) {
+		for _, e := range eligible {
+			if e == lines[roll] {
+				res.Result = e.Name
+				return e
+			}
+		}
+	}
+	c := eligible[rand.Intn(len(eligible))]
+	res.Result = ChooseMostLogicalCharacter + ": " + c.Name
+	return c
+}
+
+func change(c *storage.Character, weight int, status string) CharacterChange {
+	return CharacterChange{
+		CharacterID: c.ID,
+		Name:        c.Name,
+		OldWeight:   c.Weight,
+		NewWeight:   weight,
+		OldStatus:   c.Status,
+		NewStatus:   status,
+	}
+}
+
+func filter(characters []*storage.Character, keep func(*storage.Character) bool) []*storage.Character {
+	var out []*storage.Character
+	for _, c := range characters {
+		if keep(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package plot
+
+import (
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"gorm.io/gorm"
+)
+
+func character(t *testing.T, db *gorm.DB, name string) storage.Character {
+	t.Helper()
+	var c storage.Character
+	if err := db.First(&c, "name = ?", name).Error; err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return c
+}
+
+func TestApplyMetaCharacterExits(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	storetest.AddCharacters(t, db, game.ID,
+		storage.Character{Name: "Hero", IsPlayer: true, Weight: 3},
+		storage.Character{Name: "Villain", Weight: 2},
+	)
+	res, err := ApplyMetaPlotPoint(db, game.ID, 10)
+	if err != nil {
+		t.Fatalf("ApplyMetaPlotPoint: %v", err)
+	}
+	if len(res.Rolls) != 1 || len(res.Changes) != 1 || res.Changes[0].Name != "Villain" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if v := character(t, db, "Villain"); v.Status != "inactive" || v.Weight != 0 {
+		t.Errorf("villain should have exited: %+v", v)
+	}
+	if h := character(t, db, "Hero"); h.Status != "active" || h.Weight != 3 {
+		t.Errorf("player character changed: %+v", h)
+	}
+
+	res, err = ApplyMetaPlotPoint(db, game.ID, 20)
+	if err != nil {
+		t.Fatalf("ApplyMetaPlotPoint: %v", err)
+	}
+	if res.Result != "Villain" {
+		t.Fatalf("expected the villain to return, got %q", res.Result)
+	}
+	if v := character(t, db, "Villain"); v.Status != "active" || v.Weight != 1 {
+		t.Errorf("villain should have returned with one slot: %+v", v)
+	}
+
+	var logs []storage.LogEntry
+	db.Where("game_id = ?", game.ID).Find(&logs)
+	if len(logs) != 4 {
+		t.Errorf("expected 4 log entries, got %d", len(logs))
+	}
+}
+
+func TestApplyMetaStepsUpPastThree(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	storetest.AddCharacters(t, db, game.ID, storage.Character{Name: "Mentor", Weight: 3})
+	res, err := ApplyMetaPlotPoint(db, game.ID, 80)
+	if err != nil {
+		t.Fatalf("ApplyMetaPlotPoint: %v", err)
+	}
+	if m := character(t, db, "Mentor"); m.Weight != 5 {
+		t.Errorf("mentor weight = %d, want 5", m.Weight)
+	}
+	if len(res.Changes) != 1 {
+		t.Fatalf("changes = %+v", res.Changes)
+	}
+	if _, err := storage.Undo(db, game.ID); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if m := character(t, db, "Mentor"); m.Weight != 3 {
+		t.Errorf("undone weight = %d, want 3", m.Weight)
+	}
+	if _, err := storage.Redo(db, game.ID); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	if m := character(t, db, "Mentor"); m.Weight != 5 {
+		t.Errorf("redone weight = %d, want 5", m.Weight)
+	}
+}
+
+func TestApplyMetaProtectsPlayerCharacters(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	storetest.AddCharacters(t, db, game.ID, storage.Character{Name: "Hero", IsPlayer: true, Weight: 1})
+	for i := 0; i < 20; i++ {
+		db.Model(&storage.Character{}).Where("game_id = ?", game.ID).Updates(map[string]any{"weight": 1, "status": "active"})
+		res, err := ApplyMetaPlotPoint(db, game.ID, 60)
+		if err != nil {
+			t.Fatalf("ApplyMetaPlotPoint: %v", err)
+		}
+		if len(res.Rolls) < 2 {
+			t.Fatalf("downgrade of the only player character should be re-rolled: %+v", res)
+		}
+		if h := character(t, db, "Hero"); h.Status != "active" {
+			t.Fatalf("player character removed from the list: %+v", h)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package plot
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util/theme"
+	"gorm.io/gorm"
+)
+
+// DefaultDataset is the name of the embedded Adventure Crafter dataset.
+const DefaultDataset = "default"
+
+//go:embed plot_points.json
+var defaultDataset []byte
+
+// Dataset is a named, versioned Plot Points Table, such as a genre pack,
+// a translation or a homebrew table.
+type Dataset struct {
+	Name        string          // Name the dataset is selected by
+	Version     string          // Version of the dataset
+	Description string          // Optional description
+	Chart       *PlotPointChart // The plot points
+}
+
+// datasetFile is the JSON layout of a dataset.
+type datasetFile struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	PlotPoints  []struct {
+		Index  int            `json:"index"`
+		Text   string         `json:"text"`
+		Ranges map[string]int `json:"ranges"`
+	} `json:"plot_points"`
+}
+
+var (
+	datasetsMu sync.RWMutex
+	datasets   = map[string]*Dataset{}
+)
+
+// ParseDataset decodes and validates a dataset without registering it.
+// Unknown fields are rejected.
+func ParseDataset(data []byte) (*Dataset, error) {
+	var f datasetFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode plot points: %w", err)
+	}
+	if f.Name == "" {
+		return nil, fmt.Errorf("plot points dataset has no name")
+	}
+	if f.Version == "" {
+		return nil, fmt.Errorf("plot points dataset %q has no version", f.Name)
+	}
+
+	chart := &PlotPointChart{PlotPoints: make([]PlotPoint, 0, len(f.PlotPoints))}
+	for _, entry := range f.PlotPoints {
+		for name := range entry.Ranges {
+			if _, err := rangeForTheme(&PlotPoint{}, theme.ThemeType(name)); err != nil {
+				return nil, fmt.Errorf("dataset %q: plot point %d: %w", f.Name, entry.Index, err)
+			}
+		}
+		chart.PlotPoints = append(chart.PlotPoints, PlotPoint{
+			Action:      entry.Ranges["Action"],
+			Tension:     entry.Ranges["Tension"],
+			Mystery:     entry.Ranges["Mystery"],
+			Social:      entry.Ranges["Social"],
+			Personal:    entry.Ranges["Personal"],
+			Description: entry.Text,
+		})
+	}
+	if err := chart.Validate(); err != nil {
+		return nil, fmt.Errorf("dataset %q: %w", f.Name, err)
+	}
+
+	return &Dataset{Name: f.Name, Version: f.Version, Description: f.Description, Chart: chart}, nil
+}
+
+// Validate checks that, for every theme, the non-zero ranges of the plot
+// points are increasing and cover 1-100.
+func (c *PlotPointChart) Validate() error {
+	if len(c.PlotPoints) == 0 {
+		return fmt.Errorf("no plot points")
+	}
+	for _, th := range []theme.ThemeType{theme.ThemeAction, theme.ThemeTension, theme.ThemeMystery, theme.ThemeSocial, theme.ThemePersonal} {
+		last := 0
+		for i := range c.PlotPoints {
+			value, _ := rangeForTheme(&c.PlotPoints[i], th)
+			if value == 0 {
+				continue
+			}
+			if value < 0 || value > 100 {
+				return fmt.Errorf("plot point %d: %s range %d out of 1-100", i+1, th, value)
+			}
+			if value <= last {
+				return fmt.Errorf("plot point %d: %s range %d is not greater than %d", i+1, th, value, last)
+			}
+			last = value
+		}
+		if last != 100 {
+			return fmt.Errorf("%s ranges end at %d instead of 100", th, last)
+		}
+	}
+	return nil
+}
+
+// RegisterDataset parses a dataset and makes it available by name,
+// replacing any dataset of the same name.
+func RegisterDataset(data []byte) (*Dataset, error) {
+	ds, err := ParseDataset(data)
+	if err != nil {
+		return nil, err
+	}
+	datasetsMu.Lock()
+	defer datasetsMu.Unlock()
+	datasets[ds.Name] = ds
+	return ds, nil
+}
+
+// LoadDatasetFile reads and registers a dataset file.
+func LoadDatasetFile(path string) (*Dataset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plot points: %w", err)
+	}
+	return RegisterDataset(data)
+}
+
+// LoadDatasetDir registers every *.json dataset in dir.
+func LoadDatasetDir(dir string) ([]*Dataset, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	loaded := make([]*Dataset, 0, len(paths))
+	for _, path := range paths {
+		ds, err := LoadDatasetFile(path)
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		loaded = append(loaded, ds)
+	}
+	return loaded, nil
+}
+
+// GetDataset returns a registered dataset by name. An empty name selects
+// DefaultDataset.
+func GetDataset(name string) (*Dataset, error) {
+	if name == "" {
+		name = DefaultDataset
+	}
+	datasetsMu.RLock()
+	defer datasetsMu.RUnlock()
+	ds, ok := datasets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown plot points dataset %q", name)
+	}
+	return ds, nil
+}
+
+// DatasetNames returns the names of the registered datasets in order.
+func DatasetNames() []string {
+	datasetsMu.RLock()
+	defer datasetsMu.RUnlock()
+	names := make([]string, 0, len(datasets))
+	for name := range datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDataset selects the registered dataset the game's plot points are rolled
+// on, recording the change in the game's history. DefaultDataset is stored as
+// an empty name. It fails with storage.ErrConflict if the game changed since
+// it was loaded.
+func SetDataset(db *gorm.DB, g *storage.Game, name string) error {
+	ds, err := GetDataset(name)
+	if err != nil {
+		return err
+	}
+	if ds.Name == DefaultDataset {
+		name = ""
+	}
+	return storage.Record(db, g.ID, fmt.Sprintf("Use plot points dataset %s %s", ds.Name, ds.Version), func(tx *gorm.DB, rec *storage.Recorder) error {
+		if err := rec.Update(g, map[string]any{"plot_dataset": name}); err != nil {
+			return err
+		}
+		g.PlotDataset = name
+		return nil
+	})
+}
+
+// ForGame returns the chart of the dataset selected for the game.
+func ForGame(g *storage.Game) (*PlotPointChart, error) {
+	ds, err := GetDataset(g.PlotDataset)
+	if err != nil {
+		return nil, err
+	}
+	return ds.Chart, nil
+}
@@ -0,0 +1,119 @@
+package plot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"github.com/DMXMax/mge/util/theme"
+)
+
+const testDataset = `{
+  "name": "noir",
+  "version": "0.1.0",
+  "plot_points": [
+    {"index": 1, "text": "NONE: Nothing happens.", "ranges": {"Action": 50, "Tension": 50, "Mystery": 50, "Social": 50, "Personal": 50}},
+    {"index": 2, "text": "BETRAYAL: Someone turns.", "ranges": {"Action": 100, "Tension": 100, "Mystery": 100, "Social": 100, "Personal": 100}}
+  ]
+}`
+
+func TestDefaultDatasetIsRegistered(t *testing.T) {
+	ds, err := GetDataset("")
+	if err != nil {
+		t.Fatalf("GetDataset returned error: %v", err)
+	}
+	if ds.Name != DefaultDataset || ds.Version == "" || ds.Chart != Chart {
+		t.Fatalf("unexpected default dataset: %s %s", ds.Name, ds.Version)
+	}
+}
+
+func TestLoadDatasetFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "noir.json")
+	if err := os.WriteFile(path, []byte(testDataset), 0644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	ds, err := LoadDatasetFile(path)
+	if err != nil {
+		t.Fatalf("LoadDatasetFile returned error: %v", err)
+	}
+	if ds.Name != "noir" || len(ds.Chart.PlotPoints) != 2 {
+		t.Fatalf("unexpected dataset: %+v", ds)
+	}
+
+	chart, err := ForGame(&storage.Game{PlotDataset: "noir"})
+	if err != nil {
+		t.Fatalf("ForGame returned error: %v", err)
+	}
+	if chart != ds.Chart {
+		t.Fatalf("ForGame did not select the game's dataset")
+	}
+	if _, err := ForGame(&storage.Game{PlotDataset: "missing"}); err == nil {
+		t.Fatalf("expected error for unknown dataset")
+	}
+}
+
+func TestParseDatasetValidation(t *testing.T) {
+	tests := map[string]string{
+		"decreasing range": strings.Replace(testDataset, `"Action": 50`, `"Action": 100`, 1),
+		"incomplete range": strings.Replace(testDataset, `"Social": 100`, `"Social": 90`, 1),
+		"unknown theme":    strings.Replace(testDataset, `"Personal": 50`, `"Romance": 50`, 1),
+		"unknown field":    strings.Replace(testDataset, `"version"`, `"edition": "x", "version"`, 1),
+		"missing version":  strings.Replace(testDataset, `"version": "0.1.0",`, ``, 1),
+		"legacy shape":     `{"plot_point_chart": {"plot_points": []}}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseDataset([]byte(data)); err == nil {
+				t.Fatalf("expected validation error")
+			}
+		})
+	}
+}
+
+func TestGameDatasetChangesTurningPoints(t *testing.T) {
+	siege := strings.NewReplacer(`"noir"`, `"siege"`, "BETRAYAL: Someone turns.", "SIEGE: The walls are surrounded.", `"Action": 50, "Tension": 50, "Mystery": 50, "Social": 50, "Personal": 50`, `"Action": 1, "Tension": 1, "Mystery": 1, "Social": 1, "Personal": 1`).Replace(testDataset)
+	if _, err := RegisterDataset([]byte(siege)); err != nil {
+		t.Fatalf("RegisterDataset: %v", err)
+	}
+	db, g := storetest.NewGame(t, "Siege", 5)
+	g.StoryThemes = theme.GetThemes()
+	names := func() map[string]bool {
+		t.Helper()
+		tp, err := GenerateTurningPoint(nil, g)
+		if err != nil {
+			t.Fatalf("GenerateTurningPoint: %v", err)
+		}
+		seen := map[string]bool{}
+		for _, e := range tp.PlotPoints() {
+			seen[e.Name] = true
+		}
+		return seen
+	}
+
+	if seen := names(); seen["SIEGE"] {
+		t.Fatalf("default dataset rolled %v", seen)
+	}
+	if err := SetDataset(db, g, "siege"); err != nil {
+		t.Fatalf("SetDataset: %v", err)
+	}
+	for range 20 {
+		if seen := names(); len(seen) != 1 || !seen["SIEGE"] {
+			t.Fatalf("siege dataset rolled %v", seen)
+		}
+	}
+	var stored storage.Game
+	db.First(&stored, "id = ?", g.ID)
+	if stored.PlotDataset != "siege" {
+		t.Fatalf("stored dataset = %q", stored.PlotDataset)
+	}
+
+	if err := SetDataset(db, &stored, "missing"); err == nil {
+		t.Fatalf("expected error for unknown dataset")
+	}
+	if err := SetDataset(db, &stored, DefaultDataset); err != nil || stored.PlotDataset != "" {
+		t.Fatalf("SetDataset(default) = %v, dataset %q", err, stored.PlotDataset)
+	}
+}
@@ -1,11 +1,7 @@
 package plot
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
-	"runtime"
 
 	"github.com/DMXMax/mge/util/theme"
 )
@@ -23,48 +19,13 @@ type PlotPointChart struct {
 	PlotPoints []PlotPoint `json:"plot_points"`
 }
 
-// LoadChart reads the plot points JSON dataset and returns it as a Go struct.
+// LoadChart decodes the embedded default plot points dataset.
 func LoadChart() (*PlotPointChart, error) {
-	_, currentFile, _, ok := runtime.Caller(0)
-	if !ok {
-		return nil, fmt.Errorf("unable to resolve caller information")
-	}
-
-	chartPath := filepath.Join(filepath.Dir(currentFile), "plot_points.json")
-
-	data, err := os.ReadFile(chartPath)
+	ds, err := ParseDataset(defaultDataset)
 	if err != nil {
-		return nil, fmt.Errorf("read plot points: %w", err)
-	}
-
-	var rawEntries []struct {
-		Text   string         `json:"text"`
-		Ranges map[string]int `json:"ranges"`
-	}
-
-	if err := json.Unmarshal(data, &rawEntries); err != nil {
-		var legacy struct {
-			PlotPointChart PlotPointChart `json:"plot_point_chart"`
-		}
-		if legacyErr := json.Unmarshal(data, &legacy); legacyErr == nil && len(legacy.PlotPointChart.PlotPoints) > 0 {
-			return &legacy.PlotPointChart, nil
-		}
-		return nil, fmt.Errorf("decode plot points: %w", err)
+		return nil, err
 	}
-
-	chart := &PlotPointChart{PlotPoints: make([]PlotPoint, 0, len(rawEntries))}
-	for _, entry := range rawEntries {
-		chart.PlotPoints = append(chart.PlotPoints, PlotPoint{
-			Action:      entry.Ranges["Action"],
-			Tension:     entry.Ranges["Tension"],
-			Mystery:     entry.Ranges["Mystery"],
-			Social:      entry.Ranges["Social"],
-			Personal:    entry.Ranges["Personal"],
-			Description: entry.Text,
-		})
-	}
-
-	return chart, nil
+	return ds.Chart, nil
 }
 
 // GetChartEntry returns the last plot point whose range for the provided theme
@@ -118,12 +79,14 @@ func rangeForTheme(point *PlotPoint, themeType theme.ThemeType) (int, error) {
 	}
 }
 
+// Chart is the chart of the default dataset. Prefer ForGame, which honours
+// the dataset selected for a game.
 var Chart *PlotPointChart
 
 func init() {
-	var err error
-	Chart, err = LoadChart()
+	ds, err := RegisterDataset(defaultDataset)
 	if err != nil {
 		panic(err)
 	}
+	Chart = ds.Chart
 }
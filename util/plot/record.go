@@ -0,0 +1,59 @@
+package plot
+
+import (
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+)
+
+// PlotlinesFromList converts a stored Plotlines List into entries for
+// PickPlotline and GenerateTurningPoint. "New Plotline" and "Choose Most
+// Logical Plotline" slots become entries with the matching special name.
+func PlotlinesFromList(list []storage.Plotline) []Plotline {
+	plotlines := make([]Plotline, 0, len(list))
+	for _, p := range list {
+		switch p.Kind {
+		case storage.PlotlineKindNew:
+			plotlines = append(plotlines, Plotline{Name: NewPlotline, Weight: p.Weight})
+		case storage.PlotlineKindLogical:
+			plotlines = append(plotlines, Plotline{Name: ChooseMostLogicalPlotline, Weight: p.Weight})
+		default:
+			plotlines = append(plotlines, Plotline{ID: p.ID, Name: p.Name, Weight: p.Weight})
+		}
+	}
+	return plotlines
+}
+
+// Record converts the turning point into a storage.TurningPoint for the game,
+// ready for storage.SaveTurningPoint. Every plot point is recorded as accepted.
+func (tp *TurningPoint) Record(gameID uuid.UUID, sceneID *uuid.UUID) *storage.TurningPoint {
+	rec := &storage.TurningPoint{
+		GameID:     gameID,
+		SceneID:    sceneID,
+		Plotline:   tp.Plotline,
+		Kind:       tp.Kind,
+		PlotPoints: make([]storage.PlotPointEntry, len(tp.Entries)),
+	}
+	if tp.PlotlineID != uuid.Nil {
+		id := tp.PlotlineID
+		rec.PlotlineID = &id
+	}
+	for i, e := range tp.Entries {
+		p := storage.PlotPointEntry{
+			Position: i + 1,
+			Theme:    e.Theme,
+			Roll:     e.Roll,
+			Name:     e.Name,
+			MetaRoll: e.MetaRoll,
+			None:     e.None,
+			Accepted: true,
+		}
+		if e.PlotPoint != nil {
+			p.Description = e.PlotPoint.Description
+		}
+		if e.Meta != nil {
+			p.Meta = e.Meta.Text
+		}
+		rec.PlotPoints[i] = p
+	}
+	return rec
+}
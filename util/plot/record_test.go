@@ -0,0 +1,63 @@
+package plot
+
+import (
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"github.com/DMXMax/mge/util/theme"
+)
+
+func TestSaveTurningPointConcludesPlotline(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	list := []storage.Plotline{
+		{GameID: game.ID, Name: "Stop the cult"},
+		{GameID: game.ID, Kind: storage.PlotlineKindLogical, Weight: 2},
+	}
+	if err := db.Create(&list).Error; err != nil {
+		t.Fatalf("create plotlines: %v", err)
+	}
+
+	stored, err := storage.ListPlotlines(db, game.ID)
+	if err != nil {
+		t.Fatalf("ListPlotlines: %v", err)
+	}
+	plotlines := PlotlinesFromList(stored)
+	if len(plotlines) != 2 || plotlines[0].ID != list[0].ID || plotlines[1].Name != ChooseMostLogicalPlotline {
+		t.Fatalf("unexpected plotlines: %+v", plotlines)
+	}
+
+	tp := &TurningPoint{
+		PlotlineID: plotlines[0].ID,
+		Plotline:   plotlines[0].Name,
+		Kind:       KindConclusion,
+		Entries: []TurningPointEntry{
+			{Theme: theme.ThemeAction, Roll: 5, Name: "CONCLUSION"},
+			{Theme: theme.ThemeAction, Roll: 20, Name: "NONE", None: true},
+			{Theme: theme.ThemeAction, Roll: 98, Name: "META", MetaRoll: 10, Meta: &MetaPlotPointsTable[0]},
+		},
+	}
+	rec := tp.Record(game.ID, nil)
+	if err := storage.SaveTurningPoint(db, rec); err != nil {
+		t.Fatalf("SaveTurningPoint: %v", err)
+	}
+	if rec.Number != 1 {
+		t.Errorf("turning point number = %d, want 1", rec.Number)
+	}
+
+	stored, err = storage.ListPlotlines(db, game.ID)
+	if err != nil {
+		t.Fatalf("ListPlotlines: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Kind != storage.PlotlineKindLogical {
+		t.Fatalf("expected the plotline to be concluded, got %+v", stored)
+	}
+
+	tps, err := storage.ListTurningPoints(db, game.ID)
+	if err != nil {
+		t.Fatalf("ListTurningPoints: %v", err)
+	}
+	if len(tps) != 1 || len(tps[0].PlotPoints) != 3 || tps[0].PlotPoints[2].Meta == "" || tps[0].PlotPoints[1].Position != 2 {
+		t.Fatalf("unexpected turning points: %+v", tps)
+	}
+}
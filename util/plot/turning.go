@@ -0,0 +1,194 @@
+package plot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util/list"
+	"github.com/DMXMax/mge/util/theme"
+	"github.com/google/uuid"
+)
+
+// Special Plotlines List results.
+const (
+	NewPlotline               = "New Plotline"
+	ChooseMostLogicalPlotline = "Choose Most Logical Plotline"
+)
+
+// Turning point kinds.
+const (
+	KindNew         = "new"         // Starts a new plotline
+	KindDevelopment = "development" // Develops an existing plotline
+	KindConclusion  = "conclusion"  // Concludes the plotline
+)
+
+// PlotPointsPerTurningPoint is the number of plot points rolled for a turning point.
+const PlotPointsPerTurningPoint = 5
+
+// MinPlotPoints is the minimum number of plot points that are not "NONE" in a turning point.
+const MinPlotPoints = 2
+
+// Plotline is an entry on the Plotlines List.
+// A plotline appears on the list Weight times.
+type Plotline struct {
+	ID     uuid.UUID // ID of the stored plotline, uuid.Nil if not stored
+	Name   string
+	Weight int
+}
+
+// TurningPointEntry is one plot point rolled for a turning point.
+type TurningPointEntry struct {
+	Theme     theme.ThemeType // Theme the plot point was rolled on
+	Roll      int             // The d100 roll on the Plot Points Table
+	PlotPoint *PlotPoint      // The plot point rolled
+	Name      string          // Plot point name, e.g. "AMBUSH"
+	Meta      *MetaPlotPoint  // The meta plot point, for "META" results
+	MetaRoll  int             // The d100 roll on the Meta Plot Points Table
+	None      bool            // Whether this plot point is left blank
+}
+
+// TurningPoint is an Adventure Crafter turning point for a plotline.
+type TurningPoint struct {
+	PlotlineID uuid.UUID           // ID of the stored plotline, uuid.Nil for special results
+	Plotline   string              // The plotline, or NewPlotline / ChooseMostLogicalPlotline
+	Kind       string              // KindNew, KindDevelopment or KindConclusion
+	Entries    []TurningPointEntry // The plot points in order, including blank ones
+	Roll       list.Result         // The roll on the Plotlines List; no rolls when the list was empty
+}
+
+// PlotPoints returns the entries that are not left blank.
+func (tp *TurningPoint) PlotPoints() []TurningPointEntry {
+	points := make([]TurningPointEntry, 0, len(tp.Entries))
+	for _, e := range tp.Entries {
+		if !e.None {
+			points = append(points, e)
+		}
+	}
+	return points
+}
+
+// String renders the turning point with one plot point per line.
+func (tp *TurningPoint) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Turning Point (%s): %s\n", tp.Kind, tp.Plotline))
+	for i, e := range tp.PlotPoints() {
+		sb.WriteString(fmt.Sprintf("%d. [%s %d] %s", i+1, e.Theme, e.Roll, e.Name))
+		if e.Meta != nil {
+			sb.WriteString(fmt.Sprintf(" -> %s", PlotPointName(e.Meta.Text)))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// GenerateTurningPoint builds a turning point for the game from the Plotlines
+// List, rolling its plot points on the dataset selected for the game, see
+// ForGame, and choosing their themes with g.NextTheme. Save the game's theme
+// state afterwards with g.SaveThemes. Use PlotPointChart.GenerateTurningPoint,
+// which describes the rolls, with other theme choosers.
+func GenerateTurningPoint(plotlines []Plotline, g *storage.Game) (*TurningPoint, error) {
+	chart, err := ForGame(g)
+	if err != nil {
+		return nil, err
+	}
+	return chart.GenerateTurningPoint(plotlines, g)
+}
+
+// GenerateTurningPoint builds a turning point.
+// It picks a plotline from the Plotlines List, then rolls 5 plot points,
+// choosing each theme with themes.NextTheme. "NONE" results are left blank
+// unless that would leave fewer than 2 plot points, in which case they are
+// re-rolled. "CONCLUSION" turns a development into a conclusion and counts as
+// "NONE" otherwise. "META" results are resolved on the Meta Plot Points Table.
+func (c *PlotPointChart) GenerateTurningPoint(plotlines []Plotline, themes theme.Chooser) (*TurningPoint, error) {
+	if c == nil {
+		return nil, fmt.Errorf("plot point chart is nil")
+	}
+
+	p, roll := RollPlotline(plotlines)
+	tp := &TurningPoint{PlotlineID: p.ID, Plotline: p.Name, Kind: KindDevelopment, Roll: roll}
+	if tp.Plotline == NewPlotline {
+		tp.Kind = KindNew
+	}
+
+	points := 0
+	for i := 0; i < PlotPointsPerTurningPoint; i++ {
+		remaining := PlotPointsPerTurningPoint - i - 1
+		for {
+			e, err := c.rollEntry(themes)
+			if err != nil {
+				return nil, err
+			}
+			if e.Name == "CONCLUSION" {
+				if tp.Kind == KindDevelopment {
+					tp.Kind = KindConclusion
+				} else {
+					e.None = true
+				}
+			}
+			if e.None && points+remaining < MinPlotPoints {
+				continue
+			}
+			if !e.None {
+				points++
+			}
+			tp.Entries = append(tp.Entries, e)
+			break
+		}
+	}
+	return tp, nil
+}
+
+func (c *PlotPointChart) rollEntry(themes theme.Chooser) (TurningPointEntry, error) {
+	e := TurningPointEntry{Theme: themes.NextTheme(), Roll: rand.Intn(100) + 1}
+	point, err := c.GetChartEntry(e.Roll, e.Theme)
+	if err != nil {
+		return e, err
+	}
+	e.PlotPoint = point
+	e.Name = PlotPointName(point.Description)
+	switch e.Name {
+	case "NONE":
+		e.None = true
+	case "META":
+		e.MetaRoll = rand.Intn(100) + 1
+		if e.Meta, err = GetMetaPlotPoint(e.MetaRoll); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// PickPlotline rolls on the Plotlines List. See RollPlotline.
+func PickPlotline(plotlines []Plotline) Plotline {
+	p, _ := RollPlotline(plotlines)
+	return p
+}
+
+// RollPlotline rolls on the Plotlines List with the list package, returning
+// the plotline and the roll. Each plotline fills as many of the list's 25
+// lines as its Weight; a roll on an empty line is "Choose Most Logical
+// Plotline". With no plotlines the result is "New Plotline".
+func RollPlotline(plotlines []Plotline) (Plotline, list.Result) {
+	items := make([]list.Item, len(plotlines))
+	for i, p := range plotlines {
+		items[i] = list.Item{ID: p.ID, Name: p.Name, Weight: p.Weight, Active: true}
+	}
+	res, err := list.New(items).Roll()
+	if err != nil {
+		return Plotline{Name: NewPlotline}, res
+	}
+	if res.Item == nil {
+		return Plotline{Name: ChooseMostLogicalPlotline}, res
+	}
+	return Plotline{ID: res.Item.ID, Name: res.Item.Name, Weight: res.Item.Weight}, res
+}
+
+// PlotPointName returns the name of a plot point from its description,
+// which is the text before the first colon.
+func PlotPointName(description string) string {
+	name, _, _ := strings.Cut(description, ":")
+	return strings.TrimSpace(name)
+}
@@ -0,0 +1,82 @@
+package plot
+
+import (
+	"testing"
+
+	"github.com/DMXMax/mge/util/theme"
+)
+
+func TestGenerateTurningPoint(t *testing.T) {
+	chart, err := LoadChart()
+	if err != nil {
+		t.Fatalf("LoadChart returned error: %v", err)
+	}
+	plotlines := []Plotline{{Name: "Stop the cult", Weight: 2}, {Name: "Find the heir", Weight: 1}}
+
+	for i := 0; i < 500; i++ {
+		tp, err := chart.GenerateTurningPoint(plotlines, theme.GetThemes())
+		if err != nil {
+			t.Fatalf("GenerateTurningPoint returned error: %v", err)
+		}
+		if len(tp.Entries) != PlotPointsPerTurningPoint {
+			t.Fatalf("expected %d entries, got %d", PlotPointsPerTurningPoint, len(tp.Entries))
+		}
+		if n := len(tp.PlotPoints()); n < MinPlotPoints {
+			t.Fatalf("expected at least %d plot points, got %d", MinPlotPoints, n)
+		}
+
+		conclusions := 0
+		for _, e := range tp.Entries {
+			if e.PlotPoint == nil || e.Roll < 1 || e.Roll > 100 {
+				t.Fatalf("invalid entry: %+v", e)
+			}
+			if e.Name == "NONE" && !e.None {
+				t.Fatalf("NONE entry not left blank")
+			}
+			if e.Name == "META" && e.Meta == nil {
+				t.Fatalf("META entry not resolved")
+			}
+			if e.Name == "CONCLUSION" && !e.None {
+				conclusions++
+			}
+		}
+		if conclusions > 1 {
+			t.Fatalf("expected at most one conclusion, got %d", conclusions)
+		}
+		if (conclusions == 1) != (tp.Kind == KindConclusion) {
+			t.Fatalf("kind %q does not match %d conclusions", tp.Kind, conclusions)
+		}
+		switch tp.Plotline {
+		case "Stop the cult", "Find the heir", ChooseMostLogicalPlotline:
+		default:
+			t.Fatalf("unexpected plotline %q", tp.Plotline)
+		}
+	}
+}
+
+func TestNewPlotlineIgnoresConclusion(t *testing.T) {
+	chart, err := LoadChart()
+	if err != nil {
+		t.Fatalf("LoadChart returned error: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		tp, err := chart.GenerateTurningPoint(nil, theme.GetThemes())
+		if err != nil {
+			t.Fatalf("GenerateTurningPoint returned error: %v", err)
+		}
+		if tp.Plotline != NewPlotline || tp.Kind != KindNew {
+			t.Fatalf("expected a new plotline, got %q (%s)", tp.Plotline, tp.Kind)
+		}
+		for _, e := range tp.PlotPoints() {
+			if e.Name == "CONCLUSION" {
+				t.Fatalf("CONCLUSION should count as NONE for a new plotline")
+			}
+		}
+	}
+}
+
+func TestPlotPointName(t *testing.T) {
+	if got := PlotPointName("AMBUSH: Whatever is happening"); got != "AMBUSH" {
+		t.Errorf("PlotPointName = %q, want AMBUSH", got)
+	}
+}
@@ -0,0 +1,82 @@
+package scene
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util"
+	"github.com/DMXMax/mge/util/elements"
+)
+
+// Adjustment is a Scene Adjustment Table result resolved against a game.
+type Adjustment struct {
+	Kind   string // The adjustment as rolled, e.g. "Add A Character"
+	Detail string // The concrete detail, empty when the result needs no detail
+}
+
+// String returns the adjustment with its detail, e.g. "Add A Character: Mara".
+func (a Adjustment) String() string {
+	if a.Detail == "" {
+		return a.Kind
+	}
+	return a.Kind + ": " + a.Detail
+}
+
+// ResolveAdjustments turns Scene Adjustment Table results into concrete adjustments.
+// Character adjustments pick from the given Characters List, leaving out Player
+// Characters, which scene adjustments neither add nor remove. "Add An Object"
+// rolls two object descriptors and "Increase An Activity" rolls action meaning words.
+// Other results are returned without detail.
+func ResolveAdjustments(adjustments []string, characters []storage.Character) []Adjustment {
+	resolved := make([]Adjustment, len(adjustments))
+	for i, kind := range adjustments {
+		a := Adjustment{Kind: kind}
+		switch kind {
+		case "Add A Character":
+			if c := pickCharacter(characters); c != nil {
+				a.Detail = c.Name
+			} else {
+				a.Detail = "New Character"
+			}
+		case "Remove A Character":
+			if c := pickCharacter(characters); c != nil {
+				a.Detail = c.Name
+			}
+		case "Add An Object":
+			a.Detail = elements.ObjectDescriptors[rand.Intn(len(elements.ObjectDescriptors))] + " " +
+				elements.ObjectDescriptors[rand.Intn(len(elements.ObjectDescriptors))]
+		case "Increase An Activity":
+			a.Detail = strings.Join(util.GetMeaningActions(), " ")
+		}
+		resolved[i] = a
+	}
+	return resolved
+}
+
+// pickCharacter picks an active non-player character, giving each one as many
+// chances as its Weight. It returns nil when there are no such characters.
+func pickCharacter(characters []storage.Character) *storage.Character {
+	var slots []*storage.Character
+	for i := range characters {
+		c := &characters[i]
+		if c.IsPlayer || (c.Status != "" && c.Status != "active") {
+			continue
+		}
+		for range max(c.Weight, 1) {
+			slots = append(slots, c)
+		}
+	}
+	if len(slots) == 0 {
+		return nil
+	}
+	return slots[rand.Intn(len(slots))]
+}
+
+func joinAdjustments(adjustments []Adjustment) string {
+	strs := make([]string, len(adjustments))
+	for i, a := range adjustments {
+		strs[i] = a.String()
+	}
+	return strings.Join(strs, "; ")
+}
@@ -0,0 +1,46 @@
+package scene
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+)
+
+func TestResolveAdjustments(t *testing.T) {
+	characters := []storage.Character{
+		{Name: "Mara", Status: "active", Weight: 2},
+		{Name: "Old Tom", Status: "inactive", Weight: 3},
+		{Name: "Kade", Status: "active", Weight: 4, IsPlayer: true},
+	}
+	adjustments := []string{"Add A Character", "Remove A Character", "Add An Object", "Increase An Activity", "Remove An Object"}
+
+	for i := 0; i < 20; i++ {
+		got := ResolveAdjustments(adjustments, characters)
+		if len(got) != len(adjustments) {
+			t.Fatalf("got %d adjustments, want %d", len(got), len(adjustments))
+		}
+		if got[0].Detail != "Mara" || got[1].Detail != "Mara" {
+			t.Fatalf("character adjustments should pick the active non-player character: %+v", got[:2])
+		}
+		if len(strings.Fields(got[2].Detail)) < 2 {
+			t.Errorf("object adjustment detail %q should have two descriptors", got[2].Detail)
+		}
+		if got[3].Detail == "" {
+			t.Errorf("activity adjustment has no detail")
+		}
+		if got[4].Detail != "" || got[4].String() != "Remove An Object" {
+			t.Errorf("unexpected detail for %q: %q", got[4].Kind, got[4].Detail)
+		}
+	}
+}
+
+func TestResolveAdjustmentsWithoutCharacters(t *testing.T) {
+	got := ResolveAdjustments([]string{"Add A Character", "Remove A Character"}, nil)
+	if got[0].Detail != "New Character" {
+		t.Errorf("add without characters = %q, want New Character", got[0].Detail)
+	}
+	if got[1].String() != "Remove A Character" {
+		t.Errorf("remove without characters = %q", got[1].String())
+	}
+}
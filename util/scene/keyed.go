@@ -0,0 +1,219 @@
+package scene
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/util"
+	"github.com/DMXMax/mge/util/list"
+	"gorm.io/gorm"
+)
+
+// Trigger checkpoints stored in storage.Trigger.Checkpoint.
+const (
+	OnScene = storage.TriggerOnScene // Checked when a scene starts
+	OnEvent = storage.TriggerOnEvent // Checked when a random event is generated
+)
+
+// EventResult is a random event after keyed events have been applied.
+type EventResult struct {
+	Event *util.Event       // The event as rolled
+	Text  string            // The event text, overridden or augmented by keyed events
+	Fired []storage.Trigger // Keyed events that fired
+
+	// Target is the Player Character a PC Negative or PC Positive event
+	// targets, nil for other events or when the game has no active PCs.
+	Target *storage.Character
+}
+
+// triggerState is the game state keyed triggers are checked against.
+type triggerState struct {
+	chaos int
+	scene int    // Number of the scene being started or played
+	focus string // Rolled event focus text, empty outside events
+}
+
+// RollEvent generates a random event for the game, applies any keyed events
+// whose conditions are met and writes the result to the game log.
+func (m *Manager) RollEvent(game *storage.Game) (*EventResult, error) {
+	var res *EventResult
+	err := storage.Record(m.DB, game.ID, "Roll random event", func(tx *gorm.DB, rec *storage.Recorder) error {
+		number, err := storage.NextSceneNumber(tx, game.ID)
+		if err != nil {
+			return err
+		}
+		if s, err := activeScene(tx, game.ID); err == nil {
+			number = s.Number
+		}
+		if res, err = rollEvent(tx, rec, game, number); err != nil {
+			return err
+		}
+		for _, l := range eventLines(res) {
+			entry := &storage.LogEntry{GameID: game.ID}
+			if err := l.entry(entry); err != nil {
+				return err
+			}
+			if err := rec.AddLogEntry(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func rollEvent(tx *gorm.DB, rec *storage.Recorder, game *storage.Game, sceneNumber int) (*EventResult, error) {
+	event := util.GetEvent()
+	fired, err := fireTriggers(tx, rec, game, OnEvent, triggerState{
+		chaos: int(game.Chaos),
+		scene: sceneNumber,
+		focus: util.EventText[event.Focus],
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &EventResult{Event: event, Fired: fired}
+	normal := event.String()
+	if event.Focus == util.PCNegative || event.Focus == util.PCPositive {
+		if res.Target, err = list.RollPC(tx, game.ID); err != nil {
+			return nil, err
+		}
+		if res.Target != nil {
+			normal += " targeting " + res.Target.Name
+		}
+	}
+	res.Text = applyTriggers(normal, fired)
+	return res, nil
+}
+
+// logLine is a message for the game log with its payload, nil for narration.
+type logLine struct {
+	msg     string
+	payload storage.LogPayload
+}
+
+// entry sets the message, kind and payload of a log entry. Lines without a
+// payload are narration.
+func (l logLine) entry(e *storage.LogEntry) error {
+	e.Msg = l.msg
+	if l.payload == nil {
+		return e.SetPayload(&storage.NarrationPayload{Text: l.msg})
+	}
+	return e.SetPayload(l.payload)
+}
+
+// eventLines returns the log lines for a random event: the event itself and
+// the keyed events that fired.
+func eventLines(res *EventResult) []logLine {
+	event := storage.NewRandomEventPayload(res.Event, res.Text)
+	if res.Target != nil {
+		id := res.Target.ID
+		event.TargetID, event.Target = &id, res.Target.Name
+	}
+	lines := []logLine{{"Random event: " + res.Text, event}}
+	for _, t := range res.Fired {
+		event.Triggers = append(event.Triggers, t.Name)
+		lines = append(lines, logLine{msg: fmt.Sprintf("Keyed event triggered: %s (%s)", t.Name, t.Effect)})
+	}
+	return lines
+}
+
+// applyTriggers overrides or augments normal with the outcomes of the fired triggers.
+func applyTriggers(normal string, fired []storage.Trigger) string {
+	if len(fired) == 0 {
+		return normal
+	}
+	outcomes := make([]string, 0, len(fired))
+	for _, t := range fired {
+		outcomes = append(outcomes, t.Outcome)
+	}
+	if overrides(fired) {
+		return strings.Join(outcomes, "; ")
+	}
+	return normal + " + " + strings.Join(outcomes, "; ")
+}
+
+// overrides reports whether any of the fired triggers overrides the normal outcome.
+func overrides(fired []storage.Trigger) bool {
+	for _, t := range fired {
+		if t.Effect != storage.TriggerAugment {
+			return true
+		}
+	}
+	return false
+}
+
+// fireTriggers returns the game's armed triggers for the checkpoint whose
+// conditions are met, marking them as fired. Triggers that are not repeatable
+// are disarmed. The changes are recorded with rec.
+func fireTriggers(tx *gorm.DB, rec *storage.Recorder, game *storage.Game, checkpoint string, state triggerState) ([]storage.Trigger, error) {
+	var triggers []storage.Trigger
+	if err := tx.Where("game_id = ? AND active = ? AND checkpoint = ?", game.ID, true, checkpoint).Order("created_at").Find(&triggers).Error; err != nil {
+		return nil, err
+	}
+
+	var fired []storage.Trigger
+	for _, t := range triggers {
+		met, err := triggerMet(tx, &t, state)
+		if err != nil {
+			return nil, err
+		}
+		if !met {
+			continue
+		}
+		now := time.Now()
+		t.FiredAt = &now
+		t.Active = t.Repeatable
+		if err := rec.Update(&t, map[string]any{"fired_at": now, "active": t.Repeatable}); err != nil {
+			return nil, err
+		}
+		fired = append(fired, t)
+	}
+	return fired, nil
+}
+
+func triggerMet(tx *gorm.DB, t *storage.Trigger, state triggerState) (bool, error) {
+	switch t.Condition {
+	case storage.TriggerChaos:
+		return state.chaos >= t.Threshold, nil
+	case storage.TriggerSceneCount:
+		return state.scene >= t.Threshold, nil
+	case storage.TriggerEventFocus:
+		return state.focus != "" && strings.EqualFold(state.focus, t.Value), nil
+	case storage.TriggerThreadStatus:
+		if t.ThreadID == nil {
+			return false, fmt.Errorf("trigger %q has no thread", t.Name)
+		}
+		var thread storage.Thread
+		if err := tx.First(&thread, "id = ?", *t.ThreadID).Error; err != nil {
+			return false, err
+		}
+		return strings.EqualFold(thread.Status, t.Value), nil
+	case storage.TriggerScenesElapsed:
+		since := t.CreatedAt
+		if t.FiredAt != nil {
+			since = *t.FiredAt
+		}
+		if t.ThreadID != nil {
+			var thread storage.Thread
+			if err := tx.First(&thread, "id = ?", *t.ThreadID).Error; err != nil {
+				return false, err
+			}
+			if thread.UpdatedAt.After(since) {
+				since = thread.UpdatedAt
+			}
+		}
+		var elapsed int64
+		if err := tx.Model(&storage.Scene{}).Where("game_id = ? AND started_at > ?", t.GameID, since).Count(&elapsed).Error; err != nil {
+			return false, err
+		}
+		return int(elapsed) >= t.Threshold, nil
+	default:
+		return false, fmt.Errorf("trigger %q has unknown condition %q", t.Name, t.Condition)
+	}
+}
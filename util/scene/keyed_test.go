@@ -0,0 +1,167 @@
+package scene
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"github.com/DMXMax/mge/util"
+)
+
+func TestKeyedSceneOverridesChaosDie(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 8)
+	trigger := &storage.Trigger{
+		GameID:     game.ID,
+		Name:       "Dragon attack",
+		Checkpoint: OnScene,
+		Condition:  storage.TriggerChaos,
+		Threshold:  8,
+		Outcome:    "The dragon attacks the village",
+	}
+	if err := storage.AddTrigger(db, trigger, storage.TriggerOptions{}); err != nil {
+		t.Fatalf("AddTrigger: %v", err)
+	}
+	m := NewManager(db)
+
+	s, err := m.StartScene(game, "Rest at the inn")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if s.Type != "keyed" || s.Keyed != "The dragon attacks the village" {
+		t.Fatalf("keyed scene did not override: %+v", s)
+	}
+	if _, err := m.EndScene(game, true, ""); err != nil {
+		t.Fatalf("EndScene: %v", err)
+	}
+
+	var stored storage.Trigger
+	db.First(&stored, "id = ?", trigger.ID)
+	if stored.Active || stored.FiredAt == nil {
+		t.Fatalf("non-repeatable trigger should be disarmed after firing: %+v", stored)
+	}
+
+	game.Chaos = 8
+	s, err = m.StartScene(game, "Rest again")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if s.Type == "keyed" {
+		t.Fatalf("disarmed trigger fired again")
+	}
+
+	if err := game.GetGameLog(db, 100); err != nil {
+		t.Fatalf("GetGameLog: %v", err)
+	}
+	var logged bool
+	for _, e := range game.Log {
+		if strings.HasPrefix(e.Msg, "Keyed scene triggered: Dragon attack") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("fired trigger was not logged")
+	}
+}
+
+func TestKeyedEventAugments(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	thread := &storetest.AddThreads(t, db, game.ID, storage.Thread{Name: "Escape the city"})[0]
+	db.Model(thread).Update("status", "resolved")
+	err := storage.AddTrigger(db, &storage.Trigger{
+		GameID:     game.ID,
+		Name:       "Pursuers",
+		Checkpoint: OnEvent,
+		Condition:  storage.TriggerThreadStatus,
+		ThreadID:   &thread.ID,
+		Value:      "resolved",
+		Effect:     storage.TriggerAugment,
+		Outcome:    "Bounty hunters pick up the trail",
+		Repeatable: true,
+	}, storage.TriggerOptions{})
+	if err != nil {
+		t.Fatalf("AddTrigger: %v", err)
+	}
+	m := NewManager(db)
+
+	for i := 0; i < 2; i++ {
+		res, err := m.RollEvent(game)
+		if err != nil {
+			t.Fatalf("RollEvent: %v", err)
+		}
+		if len(res.Fired) != 1 {
+			t.Fatalf("expected the repeatable trigger to fire, got %d", len(res.Fired))
+		}
+		if want := res.Event.String() + " + Bounty hunters pick up the trail"; res.Text != want {
+			t.Fatalf("Text = %q, want %q", res.Text, want)
+		}
+	}
+}
+
+func TestScenesElapsedTrigger(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 1)
+	thread := &storetest.AddThreads(t, db, game.ID, storage.Thread{Name: "Find the spy"})[0]
+	err := storage.AddTrigger(db, &storage.Trigger{
+		GameID:     game.ID,
+		Name:       "Spy strikes",
+		Checkpoint: OnScene,
+		Condition:  storage.TriggerScenesElapsed,
+		ThreadID:   &thread.ID,
+		Threshold:  2,
+		Effect:     storage.TriggerAugment,
+		Outcome:    "The spy sabotages the fleet",
+	}, storage.TriggerOptions{})
+	if err != nil {
+		t.Fatalf("AddTrigger: %v", err)
+	}
+	m := NewManager(db)
+
+	for i := 1; i <= 3; i++ {
+		s, err := m.StartScene(game, "Search the docks")
+		if err != nil {
+			t.Fatalf("StartScene: %v", err)
+		}
+		if fired := s.Keyed != ""; fired != (i == 3) {
+			t.Fatalf("scene %d: keyed = %q", i, s.Keyed)
+		}
+		if _, err := m.EndScene(game, true, ""); err != nil {
+			t.Fatalf("EndScene: %v", err)
+		}
+	}
+}
+
+func TestPCEventTargetsPC(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	pc := &storetest.AddCharacters(t, db, game.ID,
+		storage.Character{Name: "Mara", IsPlayer: true},
+		storage.Character{Name: "Guard"},
+	)[0]
+	m := NewManager(db)
+
+	for range 500 {
+		res, err := m.RollEvent(game)
+		if err != nil {
+			t.Fatalf("RollEvent: %v", err)
+		}
+		if res.Event.Focus != util.PCNegative && res.Event.Focus != util.PCPositive {
+			if res.Target != nil {
+				t.Fatalf("%s event has a target: %+v", util.EventText[res.Event.Focus], res.Target)
+			}
+			continue
+		}
+		if res.Target == nil || res.Target.ID != pc.ID || !strings.HasSuffix(res.Text, " targeting Mara") {
+			t.Fatalf("PC event = %q, target %+v, want Mara", res.Text, res.Target)
+		}
+		var entry storage.LogEntry
+		db.Where("game_id = ? AND type = ?", game.ID, storage.LogRandomEvent).Order("created_at DESC").First(&entry)
+		p, err := entry.DecodePayload()
+		if err != nil {
+			t.Fatalf("DecodePayload: %v", err)
+		}
+		if e := p.(*storage.RandomEventPayload); e.Target != "Mara" || e.TargetID == nil || *e.TargetID != pc.ID {
+			t.Fatalf("payload = %+v, want target Mara", e)
+		}
+		return
+	}
+	t.Fatalf("no PC event in 500 rolls")
+}
@@ -0,0 +1,255 @@
+package scene
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSceneActive is returned when starting a scene while the game already has one.
+	ErrSceneActive = errors.New("game already has an active scene")
+	// ErrNoActiveScene is returned when ending a scene while the game has none.
+	ErrNoActiveScene = errors.New("game has no active scene")
+)
+
+// Manager drives the scene lifecycle for a game, persisting each scene as a
+// storage.Scene and recording its outcome in the game log.
+// A game has at most one active scene at a time.
+type Manager struct {
+	DB *gorm.DB
+}
+
+// NewManager returns a Manager that stores scenes in db.
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{DB: db}
+}
+
+// ActiveScene returns the active scene for the game, or ErrNoActiveScene.
+func (m *Manager) ActiveScene(gameID uuid.UUID) (*storage.Scene, error) {
+	return activeScene(m.DB, gameID)
+}
+
+// StartScene begins a new scene from the expected concept.
+// It rolls the Chaos Die against the game's chaos factor; altered scenes get
+// scene adjustments resolved against the game's Characters List and interrupt
+// scenes get a random event. Keyed scenes whose conditions are met override the
+// rolled scene type, making it "keyed", or augment it.
+// The scene is saved as the game's only active scene and the outcome is logged.
+func (m *Manager) StartScene(game *storage.Game, concept string) (*storage.Scene, error) {
+	concept = strings.TrimSpace(concept)
+	if concept == "" {
+		return nil, fmt.Errorf("scene concept cannot be empty")
+	}
+
+	var s *storage.Scene
+	err := storage.Record(m.DB, game.ID, "Start scene: "+concept, func(tx *gorm.DB, rec *storage.Recorder) error {
+		if _, err := activeScene(tx, game.ID); err == nil {
+			return ErrSceneActive
+		} else if !errors.Is(err, ErrNoActiveScene) {
+			return err
+		}
+
+		number, err := storage.NextSceneNumber(tx, game.ID)
+		if err != nil {
+			return err
+		}
+
+		roll := RollChaosDie(int(game.Chaos))
+		s = &storage.Scene{
+			GameID:          game.ID,
+			Number:          number,
+			Title:           concept,
+			StartedAt:       time.Now(),
+			Type:            roll.SceneType,
+			ExpectedConcept: concept,
+			ChaosDieRoll:    roll.Roll,
+			IsActive:        true,
+		}
+
+		fired, err := fireTriggers(tx, rec, game, OnScene, triggerState{chaos: int(game.Chaos), scene: number})
+		if err != nil {
+			return err
+		}
+
+		start := &storage.SceneStartPayload{Number: number, Concept: concept, ChaosDie: roll.Roll, Chaos: int(game.Chaos)}
+		lines := []logLine{{fmt.Sprintf("Scene %d: %s. %s", number, concept, roll.Description), start}}
+		if len(fired) > 0 {
+			s.Keyed = applyTriggers("", fired)
+			if overrides(fired) {
+				s.Type = "keyed"
+			}
+			for _, t := range fired {
+				lines = append(lines, logLine{msg: fmt.Sprintf("Keyed scene triggered: %s (%s): %s", t.Name, t.Effect, t.Outcome)})
+			}
+		}
+		switch s.Type {
+		case "altered":
+			var characters []storage.Character
+			if err := tx.Where("game_id = ?", game.ID).Find(&characters).Error; err != nil {
+				return err
+			}
+			adjustments := GetSceneAdjustment()
+			s.Adjustments = strings.Join(adjustments, "; ")
+			s.AdjustmentDetail = joinAdjustments(ResolveAdjustments(adjustments, characters))
+			lines = append(lines, logLine{msg: "Scene adjustment: " + s.AdjustmentDetail})
+		case "interrupt":
+			res, err := rollEvent(tx, rec, game, number)
+			if err != nil {
+				return err
+			}
+			s.Event = res.Text
+			lines = append(lines, eventLines(res)...)
+		}
+		start.Type = s.Type
+
+		if err := rec.Create(s); err != nil {
+			return err
+		}
+		for _, l := range lines {
+			if err := writeLog(rec, s, l); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// EndScene closes the game's active scene, recording its end time and summary.
+// The chaos factor goes down by one when the player characters were in control
+// of the scene and up by one otherwise. Prompts to review the Threads and
+// Characters Lists are written to the game log along with the new chaos factor.
+func (m *Manager) EndScene(game *storage.Game, pcsInControl bool, summary string) (*storage.Scene, error) {
+	var s *storage.Scene
+	old, version := game.Chaos, game.UpdatedAt
+	err := storage.Record(m.DB, game.ID, "End scene", func(tx *gorm.DB, rec *storage.Recorder) error {
+		var err error
+		if s, err = activeScene(tx, game.ID); err != nil {
+			return err
+		}
+		rec.Describe(fmt.Sprintf("End scene %d", s.Number))
+
+		now := time.Now()
+		s.IsActive = false
+		s.EndedAt = &now
+		s.Summary = strings.TrimSpace(summary)
+		err = rec.Update(s, map[string]any{"is_active": false, "ended_at": now, "summary": s.Summary})
+		if err != nil {
+			return err
+		}
+
+		delta := 1
+		if pcsInControl {
+			delta = -1
+		}
+		game.AdjustChaos(delta)
+		if err := rec.Update(game, map[string]any{"chaos": game.Chaos}); err != nil {
+			return err
+		}
+
+		lines := []logLine{{
+			fmt.Sprintf("Scene %d ended: %s. Chaos factor %d -> %d", s.Number, s.Title, old, game.Chaos),
+			&storage.SceneEndPayload{Number: s.Number, Summary: s.Summary, PCsInControl: pcsInControl, ChaosFrom: int(old), ChaosTo: int(game.Chaos)},
+		}}
+		prompts, err := listPrompts(tx, game.ID)
+		if err != nil {
+			return err
+		}
+		for _, msg := range prompts {
+			lines = append(lines, logLine{msg: msg})
+		}
+		for _, l := range lines {
+			if err := writeLog(rec, s, l); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Nothing was saved, so the game is as it was loaded.
+		game.SetChaos(old)
+		game.UpdatedAt = version
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetTitle changes the journal title of a scene. Titles default to the expected concept.
+func (m *Manager) SetTitle(sceneID uuid.UUID, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return fmt.Errorf("scene title cannot be empty")
+	}
+	var s storage.Scene
+	if err := m.DB.First(&s, "id = ?", sceneID).Error; err != nil {
+		return err
+	}
+	desc := fmt.Sprintf("Retitle scene %d: %s -> %s", s.Number, s.Title, title)
+	return storage.Record(m.DB, s.GameID, desc, func(tx *gorm.DB, rec *storage.Recorder) error {
+		return rec.Update(&s, map[string]any{"title": title})
+	})
+}
+
+// listPrompts builds the end-of-scene bookkeeping prompts for the Threads and
+// Characters Lists from the game's active entries. Player Characters are not
+// on the Characters List.
+func listPrompts(db *gorm.DB, gameID uuid.UUID) ([]string, error) {
+	var threads []storage.Thread
+	if err := db.Where("game_id = ? AND status = ?", gameID, "active").Order("created_at").Find(&threads).Error; err != nil {
+		return nil, err
+	}
+	var characters []storage.Character
+	if err := db.Where("game_id = ? AND status = ? AND is_player = ?", gameID, "active", false).Order("created_at").Find(&characters).Error; err != nil {
+		return nil, err
+	}
+
+	threadNames := make([]string, len(threads))
+	for i, t := range threads {
+		threadNames[i] = t.Name
+	}
+	characterNames := make([]string, len(characters))
+	for i, c := range characters {
+		characterNames[i] = c.Name
+	}
+
+	return []string{
+		"Threads List: add new threads, close resolved ones. Current: " + listOrNone(threadNames),
+		"Characters List: add new characters, remove departed ones. Current: " + listOrNone(characterNames),
+	}, nil
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+func activeScene(db *gorm.DB, gameID uuid.UUID) (*storage.Scene, error) {
+	var s storage.Scene
+	err := db.Where("game_id = ? AND is_active = ?", gameID, true).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoActiveScene
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func writeLog(rec *storage.Recorder, s *storage.Scene, l logLine) error {
+	entry := &storage.LogEntry{GameID: s.GameID, SceneID: &s.ID}
+	if err := l.entry(entry); err != nil {
+		return err
+	}
+	return rec.AddLogEntry(entry)
+}
@@ -0,0 +1,341 @@
+package scene
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DMXMax/mge/storage"
+	"github.com/DMXMax/mge/storage/storetest"
+	"gorm.io/gorm"
+)
+
+func TestManagerSceneLifecycle(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	storetest.AddThreads(t, db, game.ID, storage.Thread{Name: "Find the relic"})
+	m := NewManager(db)
+
+	s, err := m.StartScene(game, "Arrive at the ruins")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if !s.IsActive || s.ChaosDieRoll < 1 || s.ChaosDieRoll > 10 {
+		t.Fatalf("unexpected scene: %+v", s)
+	}
+	switch s.Type {
+	case "expected":
+	case "altered":
+		if s.Adjustments == "" {
+			t.Errorf("altered scene has no adjustments")
+		}
+	case "interrupt":
+		if s.Event == "" {
+			t.Errorf("interrupt scene has no event")
+		}
+	default:
+		t.Fatalf("unknown scene type %q", s.Type)
+	}
+
+	if _, err := m.StartScene(game, "Another scene"); !errors.Is(err, ErrSceneActive) {
+		t.Fatalf("expected ErrSceneActive, got %v", err)
+	}
+
+	ended, err := m.EndScene(game, true, "Found the entrance")
+	if err != nil {
+		t.Fatalf("EndScene: %v", err)
+	}
+	if ended.ID != s.ID {
+		t.Fatalf("ended scene %v, want %v", ended.ID, s.ID)
+	}
+	if game.Chaos != 4 {
+		t.Errorf("chaos = %d, want 4", game.Chaos)
+	}
+	var stored storage.Game
+	db.First(&stored, "id = ?", game.ID)
+	if stored.Chaos != 4 {
+		t.Errorf("stored chaos = %d, want 4", stored.Chaos)
+	}
+
+	if _, err := m.ActiveScene(game.ID); !errors.Is(err, ErrNoActiveScene) {
+		t.Fatalf("expected ErrNoActiveScene, got %v", err)
+	}
+	if _, err := m.EndScene(game, false, ""); !errors.Is(err, ErrNoActiveScene) {
+		t.Fatalf("expected ErrNoActiveScene, got %v", err)
+	}
+
+	if err := game.GetGameLog(db, 100); err != nil {
+		t.Fatalf("GetGameLog: %v", err)
+	}
+	var foundThreads bool
+	for _, e := range game.Log {
+		if e.Msg == "Threads List: add new threads, close resolved ones. Current: Find the relic" {
+			foundThreads = true
+		}
+	}
+	if !foundThreads {
+		t.Errorf("threads prompt missing from log: %+v", game.Log)
+	}
+}
+
+func TestManagerEndSceneClampsChaos(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", storage.MaxChaos)
+	m := NewManager(db)
+	if _, err := m.StartScene(game, "Chase"); err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if _, err := m.EndScene(game, false, ""); err != nil {
+		t.Fatalf("EndScene: %v", err)
+	}
+	if game.Chaos != storage.MaxChaos {
+		t.Errorf("chaos = %d, want %d", game.Chaos, storage.MaxChaos)
+	}
+}
+
+func TestManagerEndSceneFailureKeepsGame(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	m := NewManager(db)
+	if _, err := m.StartScene(game, "Chase"); err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	var stale storage.Game
+	db.First(&stale, "id = ?", game.ID)
+	if err := game.SaveChaos(db, 7); err != nil {
+		t.Fatalf("SaveChaos: %v", err)
+	}
+
+	version := stale.UpdatedAt
+	if _, err := m.EndScene(&stale, true, ""); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("EndScene of a stale game error = %v, want ErrConflict", err)
+	}
+	if stale.Chaos != 5 || !stale.UpdatedAt.Equal(version) {
+		t.Fatalf("failed EndScene changed the game: chaos %d, updated %v", stale.Chaos, stale.UpdatedAt)
+	}
+	if _, err := m.ActiveScene(game.ID); err != nil {
+		t.Fatalf("scene ended by a failed EndScene: %v", err)
+	}
+}
+
+func TestManagerSceneJournal(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	m := NewManager(db)
+
+	first, err := m.StartScene(game, "Meet the contact")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if err := storage.AddLogEntry(db, &storage.LogEntry{GameID: game.ID, Msg: "Is the contact nervous? Yes"}); err != nil {
+		t.Fatalf("AddLogEntry: %v", err)
+	}
+	if _, err := m.EndScene(game, true, "The contact gave us the map"); err != nil {
+		t.Fatalf("EndScene: %v", err)
+	}
+	second, err := m.StartScene(game, "Follow the map")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if first.Number != 1 || second.Number != 2 {
+		t.Fatalf("scene numbers = %d, %d; want 1, 2", first.Number, second.Number)
+	}
+	if err := m.SetTitle(second.ID, "Into the marsh"); err != nil {
+		t.Fatalf("SetTitle: %v", err)
+	}
+
+	scenes, err := storage.ListScenes(db, game.ID)
+	if err != nil {
+		t.Fatalf("ListScenes: %v", err)
+	}
+	if len(scenes) != 2 || scenes[0].Summary != "The contact gave us the map" || scenes[0].EndedAt == nil || scenes[1].Title != "Into the marsh" {
+		t.Fatalf("unexpected scenes: %+v", scenes)
+	}
+
+	transcript, err := storage.SceneTranscript(db, first.ID)
+	if err != nil {
+		t.Fatalf("SceneTranscript: %v", err)
+	}
+	var linked bool
+	for _, e := range transcript {
+		if e.Msg == "Is the contact nervous? Yes" {
+			linked = true
+		}
+	}
+	if !linked {
+		t.Errorf("log entry not linked to the active scene: %+v", transcript)
+	}
+	kinds := map[storage.LogKind]storage.LogPayload{}
+	for _, e := range transcript {
+		p, err := e.DecodePayload()
+		if err != nil {
+			t.Fatalf("DecodePayload: %v", err)
+		}
+		kinds[e.Type] = p
+	}
+	if p, ok := kinds[storage.LogSceneStart].(*storage.SceneStartPayload); !ok || p.Number != 1 || p.Type != first.Type || p.ChaosDie != first.ChaosDieRoll {
+		t.Errorf("scene start payload = %+v", kinds[storage.LogSceneStart])
+	}
+	if p, ok := kinds[storage.LogSceneEnd].(*storage.SceneEndPayload); !ok || !p.PCsInControl || p.ChaosFrom != 5 || p.ChaosTo != 4 {
+		t.Errorf("scene end payload = %+v", kinds[storage.LogSceneEnd])
+	}
+
+	since, err := storage.LogSinceScene(db, game.ID, 2)
+	if err != nil {
+		t.Fatalf("LogSinceScene: %v", err)
+	}
+	for _, e := range since {
+		if e.SceneID == nil || *e.SceneID != second.ID {
+			t.Errorf("entry %q is not from scene 2", e.Msg)
+		}
+	}
+	if len(since) == 0 {
+		t.Errorf("expected entries since scene 2")
+	}
+}
+
+func TestManagerUndoEndScene(t *testing.T) {
+	db, game := storetest.NewGame(t, "Test Game", 5)
+	m := NewManager(db)
+	s, err := m.StartScene(game, "Storm the gate")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+	if _, err := m.EndScene(game, false, "Repelled"); err != nil {
+		t.Fatalf("EndScene: %v", err)
+	}
+
+	op, err := storage.Undo(db, game.ID)
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if op.Description != "End scene 1" {
+		t.Fatalf("undid %q", op.Description)
+	}
+	active, err := m.ActiveScene(game.ID)
+	if err != nil || active.ID != s.ID || active.EndedAt != nil || active.Summary != "" {
+		t.Fatalf("scene not restored: %+v, %v", active, err)
+	}
+	var g storage.Game
+	db.First(&g, "id = ?", game.ID)
+	if g.Chaos != 5 {
+		t.Fatalf("chaos = %d after undo, want 5", g.Chaos)
+	}
+	log, _ := storage.SceneTranscript(db, s.ID)
+	for _, l := range log {
+		if strings.HasPrefix(l.Msg, "Scene 1 ended") {
+			t.Fatalf("end of scene still logged: %q", l.Msg)
+		}
+	}
+
+	if _, err := storage.Undo(db, game.ID); err != nil {
+		t.Fatalf("Undo StartScene: %v", err)
+	}
+	if _, err := m.ActiveScene(game.ID); !errors.Is(err, ErrNoActiveScene) {
+		t.Fatalf("undone scene still active: %v", err)
+	}
+}
+
+func TestManagerEndSceneConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db1, err := storage.InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	db2, err := storage.InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	game := &storage.Game{Name: "Shared", Chaos: 5}
+	db1.Create(game)
+	s, err := NewManager(db1).StartScene(game, "Duel")
+	if err != nil {
+		t.Fatalf("StartScene: %v", err)
+	}
+
+	// Both sessions end the scene at once. Their games are not loaded from
+	// the database, so they are not checked for conflicts: only reading the
+	// active scene in the transaction keeps the scene from ending twice.
+	games := []storage.Game{{ID: game.ID, Name: game.Name, Chaos: 5}, {ID: game.ID, Name: game.Name, Chaos: 5}}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, db := range []*gorm.DB{db1, db2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = NewManager(db).EndScene(&games[i], i == 0, "")
+		}()
+	}
+	wg.Wait()
+
+	ended := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			ended++
+		case errors.Is(err, ErrNoActiveScene):
+			if games[i].Chaos != 5 {
+				t.Errorf("session %d: chaos = %d after a failed EndScene", i+1, games[i].Chaos)
+			}
+		default:
+			t.Fatalf("session %d: EndScene: %v", i+1, err)
+		}
+	}
+	if ended != 1 {
+		t.Fatalf("scene ended %d times, want once: %v", ended, errs)
+	}
+	var g storage.Game
+	db1.First(&g, "id = ?", game.ID)
+	if g.Chaos != 4 && g.Chaos != 6 {
+		t.Fatalf("chaos = %d, want one change from 5", g.Chaos)
+	}
+	var ends int64
+	db1.Model(&storage.LogEntry{}).Where("scene_id = ? AND type = ?", s.ID, storage.LogSceneEnd).Count(&ends)
+	if ends != 1 {
+		t.Fatalf("scene end logged %d times", ends)
+	}
+}
+
+func TestManagerStartSceneConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db1, err := storage.InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	db2, err := storage.InitDatabase(path)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	game := &storage.Game{Name: "Shared", Chaos: 5}
+	db1.Create(game)
+
+	// Both sessions start a scene at once; a game has a single active scene.
+	games := []storage.Game{{ID: game.ID, Name: game.Name, Chaos: 5}, {ID: game.ID, Name: game.Name, Chaos: 5}}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, db := range []*gorm.DB{db1, db2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = NewManager(db).StartScene(&games[i], "Duel")
+		}()
+	}
+	wg.Wait()
+
+	started := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case errors.Is(err, ErrSceneActive):
+		default:
+			t.Fatalf("session %d: StartScene: %v", i+1, err)
+		}
+	}
+	if started != 1 {
+		t.Fatalf("scene started %d times, want once: %v", started, errs)
+	}
+	var active int64
+	db1.Model(&storage.Scene{}).Where("game_id = ? AND is_active", game.ID).Count(&active)
+	if active != 1 {
+		t.Fatalf("%d active scenes, want 1", active)
+	}
+}
@@ -0,0 +1,48 @@
+package theme
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxThemeHistory is the number of chosen themes kept in State.History.
+const MaxThemeHistory = 100
+
+// State is the theme selection state of a game, saved alongside its Themes.
+type State struct {
+	NextAlternate int         `json:"next_alternate"` // 0 when the 4th theme is next on a roll of 10, 1 for the 5th
+	History       []ThemeType `json:"history"`        // Chosen themes, oldest first
+}
+
+// Value implements the driver.Valuer interface for Gorm.
+// The state is stored as JSON text.
+func (s State) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface for Gorm.
+// NULL and empty values scan to the zero State.
+func (s *State) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*s = State{}
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("unsupported type for State scan: %T", value)
+	}
+	if len(b) == 0 {
+		*s = State{}
+		return nil
+	}
+	return json.Unmarshal(b, s)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math/rand/v2"
 	"strings"
-	"time"
 )
 
 type ThemeType string
@@ -30,28 +29,85 @@ func (t ThemeType) String() string {
 // The list is: ThemeAction, ThemeTension, ThemeMystery, ThemeSocial, ThemePersonal.
 func GetThemes() Themes {
 	themes := Themes{ThemeAction, ThemeTension, ThemeMystery, ThemeSocial, ThemePersonal}
-	r := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))
-	r.Shuffle(len(themes), func(i, j int) { themes[i], themes[j] = themes[j], themes[i] })
+	rand.Shuffle(len(themes), func(i, j int) { themes[i], themes[j] = themes[j], themes[i] })
 	return themes
 }
 
+// Chooser picks the theme for the next plot point.
+type Chooser interface {
+	NextTheme() ThemeType
+}
+
+// NextTheme implements Chooser using GetRandomTheme.
+func (ts Themes) NextTheme() ThemeType {
+	return ts.GetRandomTheme()
+}
+
+// GetRandomTheme rolls 1d10 for a theme: 1-4 is the 1st theme, 5-7 the 2nd,
+// 8-9 the 3rd and 10 the 4th or 5th with equal chance.
+// Use Choose to alternate the 4th and 5th themes as the Adventure Crafter does.
 func (ts Themes) GetRandomTheme() ThemeType {
-	r := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))
-	roll := r.IntN(10) + 1
+	if i := themeIndex(rand.IntN(10) + 1); i < 3 {
+		return ts[i]
+	}
+	return ts[3+rand.IntN(2)]
+}
+
+// Choose rolls 1d10 for a theme like GetRandomTheme, but a roll of 10
+// alternates between the 4th and 5th themes, starting with the 4th.
+// The alternation and the chosen theme are recorded in state.
+func (ts Themes) Choose(state *State) ThemeType {
+	i := themeIndex(rand.IntN(10) + 1)
+	if i == 3 {
+		i += state.NextAlternate
+		state.NextAlternate = 1 - state.NextAlternate
+	}
+	state.History = append(state.History, ts[i])
+	if n := len(state.History); n > MaxThemeHistory {
+		state.History = state.History[n-MaxThemeHistory:]
+	}
+	return ts[i]
+}
 
+// themeIndex maps a d10 roll to a theme position; 3 stands for the 4th or 5th theme.
+func themeIndex(roll int) int {
 	switch {
 	case roll <= 4:
-		return ts[0]
+		return 0
 	case roll <= 7:
-		return ts[1]
+		return 1
 	case roll <= 9:
-		return ts[2]
+		return 2
 	default:
-		if r.IntN(2) == 0 {
-			return ts[3]
+		return 3
+	}
+}
+
+// Move changes the priority of a theme, moving it to position (1-5) and
+// shifting the themes in between.
+func (ts *Themes) Move(t ThemeType, position int) error {
+	if position < 1 || position > len(ts) {
+		return fmt.Errorf("theme position out of range (1-%d): %d", len(ts), position)
+	}
+	from := -1
+	for i, theme := range ts {
+		if theme == t {
+			from = i
 		}
-		return ts[4]
 	}
+	if from < 0 {
+		return fmt.Errorf("theme %q is not in %v", t, *ts)
+	}
+	to := position - 1
+	for from < to {
+		ts[from], ts[from+1] = ts[from+1], ts[from]
+		from++
+	}
+	for from > to {
+		ts[from], ts[from-1] = ts[from-1], ts[from]
+		from--
+	}
+	return nil
 }
 
 // Value implements the driver.Valuer interface for Gorm.
@@ -89,3 +89,65 @@ func TestThemesGetTheme(t *testing.T) {
 		t.Fatalf("expected last two themes to be roughly even, diff=%d", diff)
 	}
 }
+
+func TestThemesChooseAlternates(t *testing.T) {
+	themes := GetThemes()
+	var state State
+	var alternates []ThemeType
+
+	for i := 0; i < 10000 && len(alternates) < 6; i++ {
+		if got := themes.Choose(&state); got == themes[3] || got == themes[4] {
+			alternates = append(alternates, got)
+		}
+	}
+	if len(alternates) < 6 {
+		t.Fatalf("expected at least 6 rolls of 10, got %d", len(alternates))
+	}
+	for i, got := range alternates {
+		if want := themes[3+i%2]; got != want {
+			t.Fatalf("alternate %d = %q, want %q", i, got, want)
+		}
+	}
+	if len(state.History) == 0 || len(state.History) > MaxThemeHistory {
+		t.Fatalf("unexpected history length %d", len(state.History))
+	}
+}
+
+func TestThemesMove(t *testing.T) {
+	themes := Themes{ThemeAction, ThemeTension, ThemeMystery, ThemeSocial, ThemePersonal}
+	if err := themes.Move(ThemePersonal, 1); err != nil {
+		t.Fatalf("Move returned error: %v", err)
+	}
+	want := Themes{ThemePersonal, ThemeAction, ThemeTension, ThemeMystery, ThemeSocial}
+	if themes != want {
+		t.Fatalf("Move(Personal, 1) = %v, want %v", themes, want)
+	}
+	if err := themes.Move(ThemeAction, 5); err != nil {
+		t.Fatalf("Move returned error: %v", err)
+	}
+	want = Themes{ThemePersonal, ThemeTension, ThemeMystery, ThemeSocial, ThemeAction}
+	if themes != want {
+		t.Fatalf("Move(Action, 5) = %v, want %v", themes, want)
+	}
+	if err := themes.Move(ThemeAction, 6); err == nil {
+		t.Fatalf("expected error for position out of range")
+	}
+}
+
+func TestStateValueScan(t *testing.T) {
+	state := State{NextAlternate: 1, History: []ThemeType{ThemeAction, ThemeSocial}}
+	v, err := state.Value()
+	if err != nil {
+		t.Fatalf("Value returned error: %v", err)
+	}
+	var got State
+	if err := got.Scan(v); err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if got.NextAlternate != 1 || len(got.History) != 2 || got.History[1] != ThemeSocial {
+		t.Fatalf("round trip = %+v, want %+v", got, state)
+	}
+	if err := got.Scan(nil); err != nil || got.NextAlternate != 0 || got.History != nil {
+		t.Fatalf("Scan(nil) = %+v, %v", got, err)
+	}
+}